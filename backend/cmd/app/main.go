@@ -8,13 +8,20 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/db"
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/discovery"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/library"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
 	httpapi "github.com/bhawani-prajapat2006/0Xnet/backend/internal/http"
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/streaming"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/webhooks"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/websocket"
 
 	"github.com/google/uuid"
 )
@@ -83,12 +90,29 @@ func main() {
 	// Clean up stale sessions from previous runs (deviceID changes on each restart)
 	service.CleanupStaleSessions(dbConn, deviceID)
 
-	// Initialize session discovery
-	sessionDiscovery := discovery.NewSessionDiscovery(deviceID)
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Domain event bus: services publish, transports and side effects subscribe
+	bus := events.NewBus()
+	hubs := websocket.NewSessionManager()
+	hubs.ForwardEvents(ctx, bus)
+	service.StartAuditLog(ctx, dbConn, bus)
+
+	// Optional webhooks: WEBHOOK_URLS is a comma-separated list of endpoints
+	if urls := os.Getenv("WEBHOOK_URLS"); urls != "" {
+		var endpoints []string
+		for _, u := range strings.Split(urls, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				endpoints = append(endpoints, u)
+			}
+		}
+		webhooks.NewDispatcher(endpoints, os.Getenv("WEBHOOK_SECRET")).Run(ctx, bus)
+	}
+
+	// Initialize session discovery
+	sessionDiscovery := discovery.NewSessionDiscovery(deviceID, bus)
+
 	log.Println("╔════════════════════════════════════════╗")
 	log.Println("║  🚀 0Xnet PEER MODE ACTIVATED         ║")
 	log.Println("╚════════════════════════════════════════╝")
@@ -100,18 +124,145 @@ func main() {
 	// Start Subnet Sweep discovery loop (replaces mDNS)
 	go discovery.StartSubnetDiscoveryLoop(ctx, sessionDiscovery, port, localIP)
 
-	// Initialize stream manager
-	streamMgr := streaming.NewStreamManager()
+	// ABR ladder, e.g. HLS_RENDITIONS=source,1080p,720p,480p,audio
+	renditions, err := streaming.ParseRenditions(os.Getenv("HLS_RENDITIONS"))
+	if err != nil {
+		log.Fatal("Invalid HLS_RENDITIONS:", err)
+	}
+
+	// Segment container: HLS_SEGMENT_FORMAT=fmp4 for CMAF; DASH_MANIFEST=1
+	// also serves manifest.mpd
+	dash, _ := strconv.ParseBool(os.Getenv("DASH_MANIFEST"))
+	format, err := streaming.ParseOutputFormat(os.Getenv("HLS_SEGMENT_FORMAT"), dash)
+	if err != nil {
+		log.Fatal("Invalid HLS_SEGMENT_FORMAT:", err)
+	}
+
+	// Transcode cache: TRANSCODE_CACHE_MB=0 disables it
+	var cache *streaming.TranscodeCache
+	cacheMB := int64(10 * 1024)
+	if mb := os.Getenv("TRANSCODE_CACHE_MB"); mb != "" {
+		if v, err := strconv.ParseInt(mb, 10, 64); err == nil {
+			cacheMB = v
+		}
+	}
+	if cacheMB > 0 {
+		cacheDir := os.Getenv("TRANSCODE_CACHE_DIR")
+		if cacheDir == "" {
+			cacheDir = streaming.DefaultCacheDir
+		}
+		if cache, err = streaming.NewTranscodeCache(cacheDir, cacheMB*1024*1024); err != nil {
+			log.Printf("⚠️ Transcode cache disabled: %v", err)
+			cache = nil
+		}
+	}
+
+	// Initialize stream manager and per-session media queues
+	streamMgr := streaming.NewStreamManager(bus, renditions, format, cache)
+
+	// Finished streams stay replayable for STREAM_RETENTION (e.g. "45m")
+	gcPolicy := streaming.DefaultGCPolicy
+	if retention := os.Getenv("STREAM_RETENTION"); retention != "" {
+		if d, err := time.ParseDuration(retention); err == nil {
+			gcPolicy.FinishedRetention = d
+		}
+	}
+	streamMgr.StartGC(ctx, gcPolicy)
+
+	// videoCall SFU whose presenters can be bridged to HLS, e.g. SFU_URL=http://localhost:8081,
+	// and the SFU_TOKEN it was started with
+	if sfuURL := os.Getenv("SFU_URL"); sfuURL != "" {
+		streamMgr.SetSFU(sfuURL, os.Getenv("SFU_TOKEN"))
+	}
+
+	// Recordings of sessions: RECORDINGS_DIR holds the kept HLS output
+	recordingsDir := os.Getenv("RECORDINGS_DIR")
+	if recordingsDir == "" {
+		recordingsDir = streaming.DefaultRecordingsDir
+	}
+	err = streamMgr.SetRecordings(recordingsDir, func(rec *models.Recording) error {
+		return service.SaveRecording(dbConn, bus, rec)
+	})
+	if err != nil {
+		log.Printf("⚠️ Recording disabled: %v", err)
+	}
+
+	// Media library: MEDIA_ROOTS lists the folders files may be streamed from
+	mediaRoots, err := streaming.ParseMediaRoots(os.Getenv("MEDIA_ROOTS"))
+	if err != nil {
+		log.Fatal("Invalid MEDIA_ROOTS:", err)
+	}
+	streamMgr.SetMediaRoots(mediaRoots)
+	if dirs := mediaRoots.Dirs(); len(dirs) > 0 {
+		log.Printf("📁 Media roots: %s", strings.Join(dirs, ", "))
+	} else {
+		log.Println("📁 No media roots; only uploaded files can be streamed")
+	}
+
+	// ffmpeg limits: FFMPEG_MAX_JOBS transcodes at once (more queue),
+	// FFMPEG_NICE niceness and FFMPEG_THREADS threads each
+	jobLimits := streaming.DefaultJobLimits
+	if n, err := strconv.Atoi(os.Getenv("FFMPEG_MAX_JOBS")); err == nil && n > 0 {
+		jobLimits.MaxTranscodes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("FFMPEG_NICE")); err == nil && n >= 0 && n <= 19 {
+		jobLimits.Nice = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("FFMPEG_THREADS")); err == nil && n >= 0 {
+		jobLimits.Threads = n
+	}
+	streamMgr.SetJobLimits(jobLimits)
+	log.Printf("🎬 Up to %d transcodes at once", jobLimits.MaxTranscodes)
+
+	// Library of the media roots, rescanned every LIBRARY_SCAN_INTERVAL (e.g. "5m")
+	scanInterval := library.DefaultScanInterval
+	if v := os.Getenv("LIBRARY_SCAN_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			scanInterval = d
+		}
+	}
+	mediaLibrary, err := library.NewScanner(dbConn, bus, mediaRoots, streamMgr.Probe, library.DefaultThumbnailDir, scanInterval)
+	if err != nil {
+		log.Printf("⚠️ Media library disabled: %v", err)
+	} else {
+		mediaLibrary.Run(ctx)
+	}
+
+	// Folders other nodes may stream from (LIBRARY_SHARED, inside the media
+	// roots), optionally only to LIBRARY_SHARE_PEERS (IPs or CIDRs)
+	sharing, err := library.NewSharing(dbConn, sessionDiscovery, deviceID, mediaRoots,
+		os.Getenv("LIBRARY_SHARED"), os.Getenv("LIBRARY_SHARE_PEERS"))
+	if err != nil {
+		log.Fatal("Invalid LIBRARY_SHARED / LIBRARY_SHARE_PEERS:", err)
+	}
+	if folders := sharing.Folders(); len(folders) > 0 {
+		log.Printf("📚 Sharing with the LAN: %s", strings.Join(folders, ", "))
+	}
+	queueMgr := streaming.NewQueueManager(bus)
+
+	// Resumable uploads: UPLOAD_MAX_MB caps a single file
+	uploadLimits := streaming.DefaultUploadLimits
+	if mb := os.Getenv("UPLOAD_MAX_MB"); mb != "" {
+		if v, err := strconv.ParseInt(mb, 10, 64); err == nil && v > 0 {
+			uploadLimits.MaxSize = v * 1024 * 1024
+			if uploadLimits.SessionQuota < uploadLimits.MaxSize {
+				uploadLimits.SessionQuota = uploadLimits.MaxSize
+			}
+		}
+	}
+	uploads := streaming.NewUploadStore(uploadLimits)
+	uploads.StartExpiry(ctx)
 
 	// Start the HTTP API server
 	go func() {
-		server := httpapi.NewServer(dbConn, deviceID, sessionDiscovery, port, streamMgr)
+		server := httpapi.NewServer(dbConn, deviceID, sessionDiscovery, port, streamMgr, queueMgr, uploads, bus, hubs, mediaLibrary, sharing)
 		server.Start()
 	}()
 
 	log.Println("📱 Access from other devices:")
 	log.Printf("   → http://%s:%d/devices", localIP, port)
 	log.Printf("   → http://%s:%d/session/list", localIP, port)
+	log.Printf("   → http://%s:%d/events", localIP, port)
 	log.Println("")
 
 	// Keep main alive until signal
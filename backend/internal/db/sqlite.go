@@ -11,7 +11,9 @@ func Connect() (*sql.DB, error) {
 	if err := os.MkdirAll("./data", 0755); err != nil {
 		return nil, err
 	}
-	db, err := sql.Open("sqlite", "./data/0xnet.db")
+	// busy_timeout: background writers (audit log) share the file with
+	// request handlers, so wait for locks instead of failing with SQLITE_BUSY
+	db, err := sql.Open("sqlite", "./data/0xnet.db?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +32,80 @@ func Connect() (*sql.DB, error) {
 		session_id TEXT,
 		device_id TEXT,
 		status TEXT
-	);`
+	);
+
+	CREATE TABLE IF NOT EXISTS polls (
+		id TEXT PRIMARY KEY,
+		session_id TEXT,
+		question TEXT,
+		multi_choice INTEGER,
+		anonymous INTEGER,
+		enqueue_winner INTEGER,
+		created_by TEXT,
+		created_at DATETIME,
+		closes_at DATETIME,
+		closed INTEGER DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS poll_options (
+		id TEXT PRIMARY KEY,
+		poll_id TEXT,
+		position INTEGER,
+		label TEXT,
+		file_path TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS poll_votes (
+		poll_id TEXT,
+		option_id TEXT,
+		device_id TEXT,
+		voted_at DATETIME,
+		PRIMARY KEY (poll_id, option_id, device_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT,
+		session_id TEXT,
+		data TEXT,
+		created_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS recordings (
+		id TEXT PRIMARY KEY,
+		session_id TEXT,
+		kind TEXT,
+		title TEXT,
+		participant TEXT,
+		path TEXT,
+		size INTEGER,
+		duration REAL,
+		created_by TEXT,
+		created_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS library_items (
+		id TEXT PRIMARY KEY,
+		path TEXT UNIQUE,
+		root TEXT,
+		folder TEXT,
+		file_name TEXT,
+		title TEXT,
+		size INTEGER,
+		mod_time DATETIME,
+		duration REAL,
+		container TEXT,
+		video_codec TEXT,
+		audio_codec TEXT,
+		width INTEGER,
+		height INTEGER,
+		audio_tracks INTEGER,
+		subtitles INTEGER,
+		thumbnail INTEGER,
+		indexed_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS library_items_folder ON library_items (root, folder);`
 
 	_, err = db.Exec(schema)
 	return db, err
@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
 )
 
@@ -24,12 +25,20 @@ type SessionDiscovery struct {
 	localDeviceID string
 	devices       map[string]*DiscoveredDevice
 	mutex         sync.RWMutex
+	bus           *events.Bus
+
+	// Last known remote sessions, used to publish created/updated/deleted
+	// events. Only maintained while someone is subscribed to the bus.
+	remoteSessions map[string]models.Session
+	remotePrimed   bool
 }
 
-func NewSessionDiscovery(deviceID string) *SessionDiscovery {
+func NewSessionDiscovery(deviceID string, bus *events.Bus) *SessionDiscovery {
 	return &SessionDiscovery{
-		localDeviceID: deviceID,
-		devices:       make(map[string]*DiscoveredDevice),
+		localDeviceID:  deviceID,
+		devices:        make(map[string]*DiscoveredDevice),
+		bus:            bus,
+		remoteSessions: make(map[string]models.Session),
 	}
 }
 
@@ -44,20 +53,32 @@ func (sd *SessionDiscovery) RegisterDevice(id, address string, port int) {
 		// Invalid or placeholder port, ignore registration
 		return
 	}
-	sd.mutex.Lock()
-	defer sd.mutex.Unlock()
-	sd.devices[id] = &DiscoveredDevice{
+	device := &DiscoveredDevice{
 		DeviceID: id,
 		Address:  address,
 		Port:     port,
 	}
+
+	sd.mutex.Lock()
+	_, known := sd.devices[id]
+	sd.devices[id] = device
+	sd.mutex.Unlock()
+
+	if !known {
+		sd.bus.Publish("", events.DeviceDiscovered{DeviceID: device.DeviceID, Address: device.Address, Port: device.Port})
+	}
 }
 
 // UnregisterDevice removes a device from the registry
 func (sd *SessionDiscovery) UnregisterDevice(id string) {
 	sd.mutex.Lock()
-	defer sd.mutex.Unlock()
+	device, known := sd.devices[id]
 	delete(sd.devices, id)
+	sd.mutex.Unlock()
+
+	if known {
+		sd.bus.Publish("", events.DeviceLost{DeviceID: device.DeviceID, Address: device.Address, Port: device.Port})
+	}
 }
 
 // GetDiscoveredDevices returns the list of discovered devices
@@ -108,6 +129,51 @@ func (sd *SessionDiscovery) GetRemoteSessions() []models.Session {
 	return remoteSessions
 }
 
+// RefreshRemoteSessions re-fetches sessions from all discovered devices and
+// publishes the differences since the last refresh. It does nothing while
+// the event bus has no subscribers, so idle nodes don't poll their peers.
+func (sd *SessionDiscovery) RefreshRemoteSessions() {
+	if !sd.bus.HasSubscribers() {
+		sd.mutex.Lock()
+		sd.remotePrimed = false
+		sd.mutex.Unlock()
+		return
+	}
+
+	current := make(map[string]models.Session)
+	for _, session := range sd.GetRemoteSessions() {
+		current[session.ID] = session
+	}
+
+	sd.mutex.Lock()
+	previous := sd.remoteSessions
+	primed := sd.remotePrimed
+	sd.remoteSessions = current
+	sd.remotePrimed = true
+	sd.mutex.Unlock()
+
+	// The first refresh only records a baseline
+	if !primed {
+		return
+	}
+
+	for id, session := range current {
+		old, existed := previous[id]
+		switch {
+		case !existed:
+			sd.bus.Publish(id, events.SessionCreated{Session: session})
+		case old.Name != session.Name || len(old.Members) != len(session.Members):
+			sd.bus.Publish(id, events.SessionUpdated{Session: session})
+		}
+	}
+	for id, session := range previous {
+		if _, stillThere := current[id]; !stillThere {
+			session := session
+			sd.bus.Publish(id, events.SessionDeleted{Session: &session})
+		}
+	}
+}
+
 // fetchSessionsFromDevice fetches sessions from a specific device via HTTP
 // and filters out stale sessions by checking the remote device's current ID
 func (sd *SessionDiscovery) fetchSessionsFromDevice(device *DiscoveredDevice) []models.Session {
@@ -220,4 +220,7 @@ func sweepAndUpdate(sd *SessionDiscovery, port int, selfIP string) {
 			}
 		}
 	}
+
+	// Publish remote session changes for event subscribers
+	sd.RefreshRemoteSessions()
 }
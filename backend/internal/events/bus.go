@@ -0,0 +1,231 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Type identifies what happened.
+type Type string
+
+const (
+	TypeSessionCreated   Type = "session.created"
+	TypeSessionDeleted   Type = "session.deleted"
+	TypeSessionUpdated   Type = "session.updated"
+	TypeSessionEnded     Type = "session.ended"
+	TypeHostLeft         Type = "host.left"
+	TypeMemberJoined     Type = "member.joined"
+	TypeMemberLeft       Type = "member.left"
+	TypeDeviceDiscovered Type = "device.discovered"
+	TypeDeviceLost       Type = "device.lost"
+	TypeStreamStarted    Type = "stream.started"
+	TypeStreamStopped    Type = "stream.stopped"
+	TypeStreamProgress   Type = "stream.progress"
+	TypeStreamQueued     Type = "stream.queued"
+	TypeStreamFailed     Type = "stream.failed"
+	TypeStreamTracks     Type = "stream.tracks"
+	TypeQueueUpdated     Type = "queue.updated"
+	TypePollUpdated      Type = "poll.updated"
+	TypePollClosed       Type = "poll.closed"
+	TypeRecordingStarted Type = "recording.started"
+	TypeRecordingStopped Type = "recording.stopped"
+	TypeRecordingSaved   Type = "recording.saved"
+	TypeLibraryUpdated   Type = "library.updated"
+)
+
+// Payload is the typed body of an event. Each payload struct in
+// payloads.go reports the event type it belongs to.
+type Payload interface {
+	EventType() Type
+}
+
+// historySize is how many recent events are kept so reconnecting
+// subscribers can catch up on what they missed.
+const historySize = 256
+
+// Event is a single change published on the bus.
+type Event struct {
+	ID        uint64    `json:"id"`
+	Type      Type      `json:"type"`
+	SessionID string    `json:"sessionId,omitempty"`
+	Data      Payload   `json:"data"`
+	Time      time.Time `json:"time"`
+}
+
+// Bus is an in-process publish/subscribe hub for domain events. Services
+// publish what happened; transports (WebSocket hub, SSE) and side effects
+// (audit log, webhooks) subscribe. Publishing never blocks. Listen
+// callbacks get every event, queued for as long as they need; a Subscribe
+// channel that falls behind loses events instead (its reader can catch up
+// with Since). A nil *Bus is valid and drops everything, so components can
+// run without one.
+type Bus struct {
+	mu        sync.RWMutex
+	subs      map[int]chan Event
+	listeners map[int]*listener
+	nextSub   int
+	lastID    uint64
+	history   []Event
+}
+
+// listener is a Listen callback's queue of events not yet handled.
+type listener struct {
+	mu    sync.Mutex
+	queue []Event
+	wake  chan struct{}
+}
+
+func (l *listener) push(ev Event) {
+	l.mu.Lock()
+	l.queue = append(l.queue, ev)
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default: // already woken
+	}
+}
+
+func (l *listener) take() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	queued := l.queue
+	l.queue = nil
+	return queued
+}
+
+// NewBus creates an empty event bus.
+func NewBus() *Bus {
+	return &Bus{
+		subs:      make(map[int]chan Event),
+		listeners: make(map[int]*listener),
+	}
+}
+
+// Publish sends an event to every current subscriber. sessionID may be
+// empty for events that aren't tied to a session (e.g. device changes).
+func (b *Bus) Publish(sessionID string, data Payload) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.lastID++
+	ev := Event{
+		ID:        b.lastID,
+		Type:      data.EventType(),
+		SessionID: sessionID,
+		Data:      data,
+		Time:      time.Now(),
+	}
+	b.history = append(b.history, ev)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+	// Queued under the lock so listeners see events in ID order
+	for _, l := range b.listeners {
+		l.push(ev)
+	}
+	subs := make([]chan Event, 0, len(b.subs))
+	for _, ch := range b.subs {
+		subs = append(subs, ch)
+	}
+	b.mu.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- ev:
+		default: // slow subscriber — drop rather than block
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. Events published after the call
+// are delivered on the returned channel until cancel is called; while the
+// channel's buffer is full, events are dropped.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	if b == nil {
+		return ch, func() {}
+	}
+
+	b.mu.Lock()
+	id := b.nextSub
+	b.nextSub++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+		})
+	}
+	return ch, cancel
+}
+
+// Listen calls fn for every event published after the call, in publish
+// order, from a background goroutine until ctx is cancelled. No event is
+// dropped: while fn is busy, later ones wait in an unbounded queue.
+func (b *Bus) Listen(ctx context.Context, fn func(Event)) {
+	if b == nil {
+		return
+	}
+	l := &listener{wake: make(chan struct{}, 1)}
+
+	b.mu.Lock()
+	id := b.nextSub
+	b.nextSub++
+	b.listeners[id] = l
+	b.mu.Unlock()
+
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			delete(b.listeners, id)
+			b.mu.Unlock()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.wake:
+			}
+			for _, ev := range l.take() {
+				fn(ev)
+			}
+		}
+	}()
+}
+
+// Since returns the retained events with an ID greater than lastID,
+// oldest first. Used to replay events a reconnecting client missed.
+func (b *Bus) Since(lastID uint64) []Event {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var missed []Event
+	for _, ev := range b.history {
+		if ev.ID > lastID {
+			missed = append(missed, ev)
+		}
+	}
+	return missed
+}
+
+// HasSubscribers returns true if anyone is listening. Lets publishers
+// skip expensive work (like polling remote devices) when nobody cares.
+func (b *Bus) HasSubscribers() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) > 0 || len(b.listeners) > 0
+}
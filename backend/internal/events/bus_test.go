@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestListenGetsEveryEventInOrder(t *testing.T) {
+	bus := NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const n = 5000
+	got := make(chan Event, n)
+	bus.Listen(ctx, func(ev Event) {
+		if ev.ID == 1 {
+			time.Sleep(50 * time.Millisecond) // fall behind the publisher
+		}
+		got <- ev
+	})
+	// A subscriber that never reads only loses its own events
+	bus.Subscribe(1)
+
+	for range n - 1 {
+		bus.Publish("s1", StreamProgress{})
+	}
+	bus.Publish("s1", SessionEnded{})
+
+	for i := uint64(1); i <= n; i++ {
+		select {
+		case ev := <-got:
+			if ev.ID != i {
+				t.Fatalf("event %d arrived as number %d", ev.ID, i)
+			}
+			if i == n && ev.Type != TypeSessionEnded {
+				t.Errorf("last event is %s, want %s", ev.Type, TypeSessionEnded)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d events arrived", i-1, n)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package events
+
+import "github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+
+// SessionCreated is published when a session is created locally or
+// first seen on a remote device.
+type SessionCreated struct {
+	Session models.Session `json:"session"`
+}
+
+// SessionUpdated is published when a remote session's name or members change.
+type SessionUpdated struct {
+	Session models.Session `json:"session"`
+}
+
+// SessionDeleted is published when a session is removed from the database
+// or disappears from a remote device.
+type SessionDeleted struct {
+	Session *models.Session `json:"session,omitempty"`
+}
+
+// HostLeft is published when the host leaves; guests get Countdown
+// seconds before SessionEnded follows.
+type HostLeft struct {
+	DeviceID  string `json:"deviceId"`
+	Countdown int    `json:"countdown"`
+}
+
+// SessionEnded is published once a departed host's grace period is over.
+type SessionEnded struct{}
+
+// MemberJoined is published when a device joins a session for the first time.
+type MemberJoined struct {
+	Member models.SessionMember `json:"member"`
+}
+
+// MemberLeft is published when a device leaves a session.
+type MemberLeft struct {
+	DeviceID string `json:"deviceId"`
+}
+
+// DeviceDiscovered is published when a 0Xnet node shows up on the LAN.
+type DeviceDiscovered struct {
+	DeviceID string `json:"deviceId"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+}
+
+// DeviceLost is published when a previously discovered node stops answering.
+type DeviceLost struct {
+	DeviceID string `json:"deviceId"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+}
+
+// StreamStarted is published once ffmpeg has written the first playlist.
+type StreamStarted struct {
+	PlaylistURL string `json:"playlistUrl"`
+	DASHURL     string `json:"dashUrl,omitempty"` // when DASH is enabled
+}
+
+// StreamStopped is published when a session's stream is stopped.
+type StreamStopped struct{}
+
+// StreamProgress is published periodically while ffmpeg transcodes, and
+// once more when it finishes.
+type StreamProgress struct {
+	Status models.StreamStatus `json:"status"`
+}
+
+// StreamQueued is published when a stream has to wait for a transcode
+// slot, and again each time its place in the queue changes.
+type StreamQueued struct {
+	Position int `json:"position"` // 1 is next
+	Running  int `json:"running"`  // transcodes running now
+}
+
+// StreamFailed is published when ffmpeg exits with an error on its own
+// (not when the stream is stopped).
+type StreamFailed struct {
+	Error  string              `json:"error"`
+	Status models.StreamStatus `json:"status"`
+}
+
+// StreamTracks is published when a stream with alternate audio or
+// subtitle tracks is announced, when a subtitle is added, and when the
+// host picks different tracks for the session.
+type StreamTracks struct {
+	Tracks models.StreamTracks `json:"tracks"`
+}
+
+// QueueUpdated carries the full media queue after any change.
+type QueueUpdated struct {
+	Items []models.QueueItem `json:"items"`
+}
+
+// PollUpdated is published when a poll is created or receives a vote.
+type PollUpdated struct {
+	Poll models.Poll `json:"poll"`
+}
+
+// PollClosed carries a poll's final tally and its winner (nil if no votes).
+type PollClosed struct {
+	Poll   models.Poll        `json:"poll"`
+	Winner *models.PollOption `json:"winner"`
+}
+
+// RecordingStarted is published when the host starts recording a
+// session, so viewers know they are being recorded.
+type RecordingStarted struct {
+	StartedBy string `json:"startedBy"`
+	Call      bool   `json:"call"` // the SFU call is recorded too
+}
+
+// RecordingStopped is published when the host stops recording.
+type RecordingStopped struct{}
+
+// RecordingSaved is published for each recording added to the index.
+type RecordingSaved struct {
+	Recording models.Recording `json:"recording"`
+}
+
+// LibraryUpdated is published after a scan of the media library that
+// found changes. It isn't tied to a session.
+type LibraryUpdated struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+}
+
+func (SessionCreated) EventType() Type   { return TypeSessionCreated }
+func (SessionUpdated) EventType() Type   { return TypeSessionUpdated }
+func (SessionDeleted) EventType() Type   { return TypeSessionDeleted }
+func (HostLeft) EventType() Type         { return TypeHostLeft }
+func (SessionEnded) EventType() Type     { return TypeSessionEnded }
+func (MemberJoined) EventType() Type     { return TypeMemberJoined }
+func (MemberLeft) EventType() Type       { return TypeMemberLeft }
+func (DeviceDiscovered) EventType() Type { return TypeDeviceDiscovered }
+func (DeviceLost) EventType() Type       { return TypeDeviceLost }
+func (StreamStarted) EventType() Type    { return TypeStreamStarted }
+func (StreamStopped) EventType() Type    { return TypeStreamStopped }
+func (StreamProgress) EventType() Type   { return TypeStreamProgress }
+func (StreamQueued) EventType() Type     { return TypeStreamQueued }
+func (StreamFailed) EventType() Type     { return TypeStreamFailed }
+func (StreamTracks) EventType() Type     { return TypeStreamTracks }
+func (QueueUpdated) EventType() Type     { return TypeQueueUpdated }
+func (PollUpdated) EventType() Type      { return TypePollUpdated }
+func (PollClosed) EventType() Type       { return TypePollClosed }
+func (RecordingStarted) EventType() Type { return TypeRecordingStarted }
+func (RecordingStopped) EventType() Type { return TypeRecordingStopped }
+func (RecordingSaved) EventType() Type   { return TypeRecordingSaved }
+func (LibraryUpdated) EventType() Type   { return TypeLibraryUpdated }
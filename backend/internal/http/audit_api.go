@@ -0,0 +1,30 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
+)
+
+// listAuditLog handles GET /audit?sessionId=X&limit=N
+// Returns recorded domain events, newest first (default 100, max 1000)
+func (s *Server) listAuditLog(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	entries, err := service.ListAuditLog(s.db, r.URL.Query().Get("sessionId"), limit)
+	if err != nil {
+		http.Error(w, "Failed to read audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+)
+
+// sseHeartbeat keeps idle connections (and proxies in between) from
+// timing out the stream.
+const sseHeartbeat = 15 * time.Second
+
+// streamEvents handles GET /events
+// Server-Sent Events feed of local changes. Optional filters:
+//
+//	?sessionId=X            only events for that session (device events always pass)
+//	?types=a,b              only the listed event types, e.g. "stream.started"
+//	?lastEventId=N          replay retained events after N (same as Last-Event-ID)
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := r.URL.Query().Get("sessionId")
+	var types map[events.Type]bool
+	if raw := r.URL.Query().Get("types"); raw != "" {
+		types = make(map[events.Type]bool)
+		for _, t := range strings.Split(raw, ",") {
+			types[events.Type(strings.TrimSpace(t))] = true
+		}
+	}
+
+	wanted := func(ev events.Event) bool {
+		if types != nil && !types[ev.Type] {
+			return false
+		}
+		if sessionID != "" && ev.SessionID != "" && ev.SessionID != sessionID {
+			return false
+		}
+		return true
+	}
+
+	// Subscribe before replaying so nothing falls in between
+	ch, cancel := s.bus.Subscribe(64)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	// Browsers send Last-Event-ID on reconnect; scripts can use ?lastEventId=
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	var lastSent uint64
+	if lastID, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		for _, ev := range s.bus.Since(lastID) {
+			if wanted(ev) {
+				if err := writeSSE(w, ev); err != nil {
+					return
+				}
+			}
+			lastSent = ev.ID
+		}
+		flusher.Flush()
+	}
+
+	log.Printf("📣 [Events] SSE client connected from %s", r.RemoteAddr)
+	defer log.Printf("📣 [Events] SSE client disconnected from %s", r.RemoteAddr)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev := <-ch:
+			if ev.ID <= lastSent || !wanted(ev) {
+				continue // already replayed, or filtered out
+			}
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes one event in text/event-stream framing.
+func writeSSE(w http.ResponseWriter, ev events.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
@@ -2,12 +2,9 @@ package httpapi
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
-	"time"
 
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
-	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/websocket"
 )
 
 // joinSession handles POST /session/join
@@ -32,7 +29,7 @@ func (s *Server) joinSession(w http.ResponseWriter, r *http.Request) {
 		body.DeviceName = body.DeviceID // fallback to deviceId as name
 	}
 
-	member, err := service.JoinSession(s.db, body.SessionID, body.DeviceID, body.DeviceName)
+	member, err := service.JoinSession(s.db, s.bus, body.SessionID, body.DeviceID, body.DeviceName)
 	if err != nil {
 		http.Error(w, "Failed to join session: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -62,34 +59,18 @@ func (s *Server) leaveSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if this is the host leaving
-	isHost := service.IsHost(s.db, body.SessionID, body.DeviceID)
-
-	if isHost {
-		// Notify all guests that the host is leaving — they have 10 seconds
-		log.Printf("🔔 Host %s leaving session %s — notifying guests", body.DeviceID, body.SessionID)
-		websocket.GlobalManager.GetHub(body.SessionID).Broadcast(map[string]interface{}{
-			"type":       "host-left",
-			"countdown":  10,
-			"message":    "Host has left. Session ending in 10 seconds…",
-		})
-
-		// Stop any active media stream
+	// A departing host takes the media stream and queue down with the
+	// session; guests hear about it through the HostLeft event. A
+	// recording keeps what was streamed.
+	if service.IsHost(s.db, body.SessionID, body.DeviceID) {
 		s.streamMgr.Stop(body.SessionID)
-
-		// Schedule cleanup after 10 seconds so guests have time to see the message
-		go func() {
-			time.Sleep(10 * time.Second)
-			// Broadcast final session-ended event
-			websocket.GlobalManager.GetHub(body.SessionID).Broadcast(map[string]interface{}{
-				"type":    "session-ended",
-				"message": "Session has been closed by the host.",
-			})
-			log.Printf("🧹 Cleaning up session %s after host departure", body.SessionID)
-		}()
+		s.queue.Clear(body.SessionID)
+		if s.streamMgr.IsRecording(body.SessionID) {
+			s.streamMgr.StopRecording(body.SessionID)
+		}
 	}
 
-	sessionDeleted, err := service.LeaveSession(s.db, body.SessionID, body.DeviceID)
+	sessionDeleted, err := service.LeaveSession(s.db, s.bus, body.SessionID, body.DeviceID)
 	if err != nil {
 		http.Error(w, "Failed to leave session: "+err.Error(), http.StatusNotFound)
 		return
@@ -0,0 +1,276 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
+)
+
+const (
+	libraryPageSize    = 50
+	libraryMaxPageSize = 500
+)
+
+// listLibrary handles GET /library
+//
+//	?q=words                search titles and file names in every root
+//	?root=R&folder=a/b      browse: the items directly in a folder, and its subfolders
+//	&limit=N&offset=M       paging (default 50 items)
+//
+// Every response lists the roots, so a client can start browsing.
+func (s *Server) listLibrary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Use GET", 405)
+		return
+	}
+	if s.library == nil {
+		http.Error(w, `{"error":"the media library is disabled"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	q := service.LibraryQuery{
+		Query: query.Get("q"),
+		Root:  query.Get("root"),
+		Limit: libraryPageSize,
+	}
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		q.Limit = min(n, libraryMaxPageSize)
+	}
+	if n, err := strconv.Atoi(query.Get("offset")); err == nil && n > 0 {
+		q.Offset = n
+	}
+
+	resp := map[string]interface{}{"roots": s.library.Roots()}
+	browsing := q.Root != "" && strings.TrimSpace(q.Query) == ""
+	if browsing {
+		folder := strings.Trim(query.Get("folder"), "/")
+		q.Folder = &folder
+		folders, err := service.LibrarySubfolders(s.db, q.Root, folder)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		resp["folders"] = folders
+	}
+
+	items, total, err := service.SearchLibrary(s.db, q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	resp["items"] = items
+	resp["total"] = total
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleLibraryItem handles the library's other routes:
+//
+//	GET  /library/<id>                 one item
+//	GET  /library/<id>/thumbnail.jpg   its poster frame
+//	POST /library/scan                 look for changes now instead of at the next interval (host only)
+func (s *Server) handleLibraryItem(w http.ResponseWriter, r *http.Request) {
+	if s.library == nil {
+		http.Error(w, `{"error":"the media library is disabled"}`, http.StatusServiceUnavailable)
+		return
+	}
+	id, file, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/library/"), "/")
+
+	if id == "scan" && file == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Use POST", 405)
+			return
+		}
+		// A scan probes every changed file, so guests can't keep the node busy
+		var body struct {
+			SessionID string `json:"sessionId"`
+			DeviceID  string `json:"deviceId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, `{"error":"sessionId and deviceId required"}`, http.StatusBadRequest)
+			return
+		}
+		if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+			http.Error(w, `{"error":"only the host can rescan the library"}`, http.StatusForbidden)
+			return
+		}
+		s.library.Rescan()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "scanning"})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Use GET", 405)
+		return
+	}
+	item, err := service.GetLibraryItem(s.db, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch file {
+	case "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	case "thumbnail.jpg":
+		path := s.library.Thumbnail(item)
+		if path == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		http.ServeFile(w, r, path)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// listPeers handles GET /library/peers (the nodes whose shared libraries
+// can be browsed) and GET /library/peers/<peerId>?q=&limit=&offset= (a
+// page of one node's shared library, fetched from it).
+func (s *Server) listPeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Use GET", 405)
+		return
+	}
+
+	peer := strings.Trim(strings.TrimPrefix(r.URL.Path, "/library/peers"), "/")
+	w.Header().Set("Content-Type", "application/json")
+	if peer == "" {
+		json.NewEncoder(w).Encode(s.sharing.Peers())
+		return
+	}
+	listing, err := s.sharing.Search(r.Context(), peer, r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadGateway)
+		return
+	}
+	json.NewEncoder(w).Encode(listing)
+}
+
+// handlePeerLibrary serves this node's shared folders to other nodes:
+//
+//	GET  /peer/library?q=&limit=&offset=     a page of the shared items
+//	POST /peer/library/<id>/grant            a token URL to read one file from
+//	GET  /peer/library/<id>/file?token=T     the file, with range requests
+//
+// The first two only answer nodes discovery knows (see Sharing.Authorize);
+// the file is read by the asking node's ffmpeg, which can't send headers,
+// so the grant's token stands in.
+func (s *Server) handlePeerLibrary(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/peer/library"), "/"), "/")
+
+	if action == "file" {
+		s.servePeerFile(w, r, id)
+		return
+	}
+
+	deviceID, err := s.sharing.Authorize(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		q := service.LibraryQuery{Query: r.URL.Query().Get("q"), Under: s.sharing.Folders(), Limit: libraryPageSize}
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+			q.Limit = min(n, libraryMaxPageSize)
+		}
+		if n, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && n > 0 {
+			q.Offset = n
+		}
+		items, total, err := service.SearchLibrary(s.db, q)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "total": total})
+
+	case action == "grant" && r.Method == http.MethodPost:
+		item, err := service.GetLibraryItem(s.db, id)
+		if err != nil {
+			http.Error(w, `{"error":"library item not found"}`, http.StatusNotFound)
+			return
+		}
+		token, err := s.sharing.Grant(item, deviceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+			return
+		}
+		log.Printf("📚 [Library] Sharing %s with %s", item.FileName, r.RemoteAddr)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"url":  "/peer/library/" + item.ID + "/file?token=" + token,
+			"item": item,
+		})
+
+	default:
+		http.Error(w, "Use GET /peer/library or POST /peer/library/<id>/grant", 405)
+	}
+}
+
+// servePeerFile sends a shared file to a node holding a grant for it.
+// http.ServeContent answers the range requests ffmpeg seeks with.
+func (s *Server) servePeerFile(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Use GET", 405)
+		return
+	}
+	if !s.sharing.Redeem(id, r.URL.Query().Get("token")) {
+		http.Error(w, `{"error":"no valid grant for this file"}`, http.StatusForbidden)
+		return
+	}
+	item, err := service.GetLibraryItem(s.db, id)
+	if err != nil || !s.sharing.IsShared(item) {
+		http.NotFound(w, r)
+		return
+	}
+	// The index may be behind the disk: check the file as it is now
+	path, err := s.streamMgr.ResolveMedia("", item.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, item.FileName, fi.ModTime(), f)
+}
+
+// startPeerStream streams a file from another node's shared library: the
+// owner grants this node a URL, which ffmpeg reads over HTTP.
+func (s *Server) startPeerStream(w http.ResponseWriter, r *http.Request, sessionID, peerID, itemID string) {
+	url, item, err := s.sharing.Open(r.Context(), peerID, itemID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadGateway)
+		return
+	}
+	playlistURL, err := s.streamMgr.StartRemote(sessionID, url, item.FileName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"playlistUrl": playlistURL})
+}
@@ -0,0 +1,224 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/websocket"
+)
+
+// listPolls handles GET /poll/list?sessionId=X
+// Returns every poll of the session with its current tally
+func (s *Server) listPolls(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionId query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	polls, err := service.ListPolls(s.db, sessionID)
+	if err != nil {
+		http.Error(w, "Failed to list polls: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(polls)
+}
+
+// handlePollMessage handles the poll-create, poll-vote and poll-close
+// WebSocket messages. Returns false for message types it doesn't know.
+func (s *Server) handlePollMessage(client *websocket.Client, msg map[string]interface{}) bool {
+	msgType, _ := msg["type"].(string)
+
+	switch msgType {
+	case "poll-create":
+		var body struct {
+			Question string `json:"question"`
+			Options  []struct {
+				Label    string `json:"label"`
+				FilePath string `json:"filePath"`
+			} `json:"options"`
+			MultiChoice     bool `json:"multiChoice"`
+			Anonymous       bool `json:"anonymous"`
+			EnqueueWinner   bool `json:"enqueueWinner"`
+			ClosesInSeconds int  `json:"closesInSeconds"`
+		}
+		if err := decodeMessage(msg, &body); err != nil || strings.TrimSpace(body.Question) == "" {
+			sendPollError(client, "question and options are required")
+			return true
+		}
+
+		// Options pointing at media files make the server read from disk,
+		// so only the host may create polls that enqueue their winner.
+		isHost := service.IsHost(s.db, client.Session, client.DeviceID)
+		if body.EnqueueWinner && !isHost {
+			sendPollError(client, "only the host can create polls that enqueue media")
+			return true
+		}
+
+		poll := &models.Poll{
+			SessionID:     client.Session,
+			Question:      strings.TrimSpace(body.Question),
+			MultiChoice:   body.MultiChoice,
+			Anonymous:     body.Anonymous,
+			EnqueueWinner: body.EnqueueWinner,
+			CreatedBy:     client.DeviceID,
+		}
+		for _, opt := range body.Options {
+			label := strings.TrimSpace(opt.Label)
+			if label == "" {
+				continue
+			}
+			option := models.PollOption{Label: label}
+			if isHost && opt.FilePath != "" {
+				filePath, err := s.streamMgr.ResolveMedia(client.Session, opt.FilePath)
+				if err != nil {
+					sendPollError(client, fmt.Sprintf("option %q: %v", label, err))
+					return true
+				}
+				option.FilePath = filePath
+			}
+			poll.Options = append(poll.Options, option)
+		}
+		if body.ClosesInSeconds > 0 {
+			closesAt := time.Now().Add(time.Duration(body.ClosesInSeconds) * time.Second)
+			poll.ClosesAt = &closesAt
+		}
+
+		created, err := service.CreatePoll(s.db, s.bus, poll)
+		if err != nil {
+			sendPollError(client, err.Error())
+			return true
+		}
+
+		if created.ClosesAt != nil {
+			s.schedulePollClose(created.ID, *created.ClosesAt)
+		}
+
+		log.Printf("📊 [Poll] %s created poll %q in session %s", client.DeviceID, created.Question, client.Session)
+		return true
+
+	case "poll-vote":
+		var body struct {
+			PollID    string   `json:"pollId"`
+			OptionID  string   `json:"optionId"`
+			OptionIDs []string `json:"optionIds"`
+		}
+		if err := decodeMessage(msg, &body); err != nil || body.PollID == "" {
+			sendPollError(client, "pollId is required")
+			return true
+		}
+		if body.OptionID != "" {
+			body.OptionIDs = append(body.OptionIDs, body.OptionID)
+		}
+
+		if !s.pollInSession(body.PollID, client.Session) {
+			sendPollError(client, "poll not found")
+			return true
+		}
+
+		if err := service.CastVote(s.db, s.bus, body.PollID, client.DeviceID, body.OptionIDs); err != nil {
+			sendPollError(client, err.Error())
+		}
+		return true
+
+	case "poll-close":
+		var body struct {
+			PollID string `json:"pollId"`
+		}
+		if err := decodeMessage(msg, &body); err != nil || body.PollID == "" {
+			sendPollError(client, "pollId is required")
+			return true
+		}
+
+		poll, err := service.GetPoll(s.db, body.PollID)
+		if err != nil || poll.SessionID != client.Session {
+			sendPollError(client, "poll not found")
+			return true
+		}
+		if poll.CreatedBy != client.DeviceID && !service.IsHost(s.db, client.Session, client.DeviceID) {
+			sendPollError(client, "only the host or the poll creator can close it")
+			return true
+		}
+
+		s.closePoll(body.PollID)
+		return true
+
+	default:
+		return false
+	}
+}
+
+// schedulePollClose closes a timed poll when its time comes; one that
+// is already due closes right away.
+func (s *Server) schedulePollClose(pollID string, closesAt time.Time) {
+	time.AfterFunc(time.Until(closesAt), func() {
+		s.closePoll(pollID)
+	})
+}
+
+// resumePolls reschedules the timed polls a previous run left open. The
+// timers died with it, and a poll only read as closed afterwards would
+// never queue its winner.
+func (s *Server) resumePolls() {
+	polls, err := service.OpenTimedPolls(s.db)
+	if err != nil {
+		log.Printf("⚠️ [Poll] Failed to load open polls: %v", err)
+		return
+	}
+	for id, closesAt := range polls {
+		s.schedulePollClose(id, closesAt)
+	}
+	if len(polls) > 0 {
+		log.Printf("📊 [Poll] Rescheduled %d open polls", len(polls))
+	}
+}
+
+// closePoll closes a poll (which announces the result) and, if the poll
+// asked for it, queues the winning option's media for the session.
+func (s *Server) closePoll(pollID string) {
+	poll, err := service.ClosePoll(s.db, s.bus, pollID)
+	if err != nil {
+		if err != service.ErrPollClosed {
+			log.Printf("⚠️ [Poll] Failed to close poll %s: %v", pollID, err)
+		}
+		return
+	}
+
+	winner := service.PollWinner(poll)
+	if poll.EnqueueWinner && winner != nil && winner.FilePath != "" {
+		log.Printf("📊 [Poll] Queueing poll winner %q for session %s", winner.Label, poll.SessionID)
+		s.queue.Add(poll.SessionID, winner.FilePath, winner.Label, poll.CreatedBy, true)
+	}
+}
+
+// pollInSession returns true if the poll exists and belongs to the session.
+func (s *Server) pollInSession(pollID, sessionID string) bool {
+	poll, err := service.GetPoll(s.db, pollID)
+	return err == nil && poll.SessionID == sessionID
+}
+
+// sendPollError reports a rejected poll action back to the sender only.
+func sendPollError(client *websocket.Client, message string) {
+	client.WriteJSON(map[string]string{
+		"type":    "poll-error",
+		"message": message,
+	})
+}
+
+// decodeMessage round-trips a generic WebSocket message through JSON
+// into a typed struct.
+func decodeMessage(msg map[string]interface{}, dst interface{}) error {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dst)
+}
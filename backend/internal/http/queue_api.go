@@ -0,0 +1,238 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/websocket"
+)
+
+// listQueue handles GET /queue/list?sessionId=X
+// Returns the session's media queue in play order
+func (s *Server) listQueue(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "sessionId query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.queue.List(sessionID))
+}
+
+// proposeQueueItem handles POST /queue/propose
+// Any member can propose media; items added by the host are approved immediately
+func (s *Server) proposeQueueItem(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SessionID string `json:"sessionId"`
+		DeviceID  string `json:"deviceId"`
+		FilePath  string `json:"filePath"`
+		Title     string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.SessionID == "" || body.DeviceID == "" || body.FilePath == "" {
+		http.Error(w, "sessionId, deviceId and filePath are required", http.StatusBadRequest)
+		return
+	}
+
+	isHost := service.IsHost(s.db, body.SessionID, body.DeviceID)
+	if !isHost && !service.IsSessionMember(s.db, body.SessionID, body.DeviceID) {
+		http.Error(w, "Only session members can propose media", http.StatusForbidden)
+		return
+	}
+
+	// Checked now so nobody gets a proposal approved that can't play
+	filePath, err := s.streamMgr.ResolveMedia(body.SessionID, body.FilePath)
+	if err != nil {
+		http.Error(w, "Cannot queue this file: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	item := s.queue.Add(body.SessionID, filePath, body.Title, body.DeviceID, isHost)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// approveQueueItem handles POST /queue/approve (host only)
+func (s *Server) approveQueueItem(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SessionID string `json:"sessionId"`
+		DeviceID  string `json:"deviceId"`
+		ItemID    string `json:"itemId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+		http.Error(w, "Only the host can approve media", http.StatusForbidden)
+		return
+	}
+
+	if err := s.queue.Approve(body.SessionID, body.ItemID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.queue.List(body.SessionID))
+}
+
+// reorderQueue handles POST /queue/reorder (host only)
+// Items listed in itemIds move to the front of the queue in that order
+func (s *Server) reorderQueue(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SessionID string   `json:"sessionId"`
+		DeviceID  string   `json:"deviceId"`
+		ItemIDs   []string `json:"itemIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+		http.Error(w, "Only the host can reorder the queue", http.StatusForbidden)
+		return
+	}
+
+	if err := s.queue.Reorder(body.SessionID, body.ItemIDs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.queue.List(body.SessionID))
+}
+
+// removeQueueItem handles POST /queue/remove
+// The host can remove any item; members can withdraw their own proposals
+func (s *Server) removeQueueItem(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SessionID string `json:"sessionId"`
+		DeviceID  string `json:"deviceId"`
+		ItemID    string `json:"itemId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !service.IsHost(s.db, body.SessionID, body.DeviceID) && !s.isQueueItemOwner(body.SessionID, body.ItemID, body.DeviceID) {
+		http.Error(w, "Only the host or the proposer can remove this item", http.StatusForbidden)
+		return
+	}
+
+	if err := s.queue.Remove(body.SessionID, body.ItemID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.queue.List(body.SessionID))
+}
+
+// nextQueueItem handles POST /queue/next (host only)
+// Stops the current stream and starts the next approved item
+func (s *Server) nextQueueItem(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SessionID string `json:"sessionId"`
+		DeviceID  string `json:"deviceId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+		http.Error(w, "Only the host can advance the queue", http.StatusForbidden)
+		return
+	}
+
+	item, err := s.advanceQueue(body.SessionID)
+	if err != nil {
+		http.Error(w, "Failed to start next item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"playing": item,
+		"queue":   s.queue.List(body.SessionID),
+	})
+}
+
+// advanceQueue stops whatever the session is streaming and starts the
+// next approved queue item, skipping items that fail to start. Returns a
+// nil item when the queue is exhausted, with the last failure if every
+// remaining item was broken.
+func (s *Server) advanceQueue(sessionID string) (*models.QueueItem, error) {
+	s.streamMgr.Stop(sessionID)
+
+	var lastErr error
+	for {
+		// Next also drops the item before it, including a broken one
+		item := s.queue.Next(sessionID)
+		if item == nil {
+			log.Printf("📭 [Queue] Queue finished for session %s", sessionID)
+			return nil, lastErr
+		}
+
+		log.Printf("⏭️ [Queue] Advancing session %s to %q", sessionID, item.Title)
+		playlistURL, err := s.streamMgr.Start(sessionID, item.FilePath)
+		if err != nil {
+			log.Printf("⚠️ [Queue] Skipping %q in session %s: %v", item.Title, sessionID, err)
+			lastErr = err
+			continue
+		}
+
+		log.Printf("⏭️ [Queue] Session %s now streaming %s", sessionID, playlistURL)
+		return item, nil
+	}
+}
+
+// advanceWhenFinished moves the session on to its next queue item once
+// the current stream has played to the end (see
+// StreamManager.SetOnFinished). It runs on its own goroutine, so a slow
+// probe of the next item holds nothing up.
+func (s *Server) advanceWhenFinished(sessionID string) {
+	if !s.queue.HasNext(sessionID) {
+		return
+	}
+	if _, err := s.advanceQueue(sessionID); err != nil {
+		log.Printf("⚠️ [Queue] Auto-advance failed for session %s: %v", sessionID, err)
+	}
+}
+
+// isQueueItemOwner returns true if deviceID proposed the given queue item.
+func (s *Server) isQueueItemOwner(sessionID, itemID, deviceID string) bool {
+	for _, item := range s.queue.List(sessionID) {
+		if item.ID == itemID {
+			return item.ProposedBy == deviceID
+		}
+	}
+	return false
+}
+
+// sendQueueSnapshot sends the current queue to a single newly joined client.
+func (s *Server) sendQueueSnapshot(client *websocket.Client) {
+	items := s.queue.List(client.Session)
+	if len(items) == 0 {
+		return
+	}
+	if err := client.WriteJSON(map[string]interface{}{
+		"type":  "queue-updated",
+		"items": items,
+	}); err != nil {
+		log.Printf("⚠️ [Queue] Failed to send snapshot to %s: %v", client.DeviceID, err)
+	}
+}
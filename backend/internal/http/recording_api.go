@@ -0,0 +1,210 @@
+package httpapi
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/streaming"
+)
+
+// recordSession handles POST /recordings/start and /recordings/stop
+// Body: {"sessionId","deviceId","call":true,"room":"..."}; only the host
+// may record. call also records the videoCall room (default: the session ID).
+func (s *Server) recordSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", 405)
+		return
+	}
+	var body struct {
+		SessionID string `json:"sessionId"`
+		DeviceID  string `json:"deviceId"`
+		Call      bool   `json:"call"`
+		Room      string `json:"room"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" {
+		http.Error(w, `{"error":"sessionId required"}`, http.StatusBadRequest)
+		return
+	}
+	if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+		http.Error(w, `{"error":"only the host can record the session"}`, http.StatusForbidden)
+		return
+	}
+
+	var err error
+	status := "recording"
+	if strings.HasSuffix(r.URL.Path, "/stop") {
+		err = s.streamMgr.StopRecording(body.SessionID)
+		status = "stopped"
+	} else {
+		room := ""
+		if body.Call {
+			room = body.Room
+			if room == "" {
+				room = body.SessionID
+			}
+		}
+		err = s.streamMgr.StartRecording(body.SessionID, body.DeviceID, room)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// listRecordings handles GET /recordings?sessionId=X
+// Returns the session's recordings (all sessions' without sessionId),
+// newest first, and whether it is being recorded now.
+func (s *Server) listRecordings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Use GET", 405)
+		return
+	}
+	sessionID := r.URL.Query().Get("sessionId")
+	recordings, err := service.ListRecordings(s.db, sessionID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recording":  sessionID != "" && s.streamMgr.IsRecording(sessionID),
+		"recordings": recordings,
+	})
+}
+
+// handleRecording serves one recording:
+//
+//	GET    /recordings/<id>/download         the file, or a zip of an HLS recording
+//	GET    /recordings/<id>/<file>           HLS playback (master.m3u8, segments...)
+//	DELETE /recordings/<id>?deviceId=X       by whoever made it or the session host
+func (s *Server) handleRecording(w http.ResponseWriter, r *http.Request) {
+	id, file, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/recordings/"), "/")
+	rec, err := service.GetRecording(s.db, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodDelete && file == "":
+		s.deleteRecording(w, r, rec)
+	case r.Method != http.MethodGet:
+		http.Error(w, "Use GET or DELETE", 405)
+	case file == "download":
+		s.downloadRecording(w, r, rec)
+	case file != "":
+		dir, err := s.streamMgr.RecordingDir(rec)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(file, ".m3u8") {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		} else if strings.HasSuffix(file, ".m4s") {
+			w.Header().Set("Content-Type", "video/iso.segment")
+		} else if strings.HasSuffix(file, ".ts") {
+			w.Header().Set("Content-Type", "video/MP2T")
+		}
+		http.StripPrefix("/recordings/"+id+"/", http.FileServer(http.Dir(dir))).ServeHTTP(w, r)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rec)
+	}
+}
+
+func (s *Server) deleteRecording(w http.ResponseWriter, r *http.Request, rec *models.Recording) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" || (deviceID != rec.CreatedBy && !service.IsHost(s.db, rec.SessionID, deviceID)) {
+		http.Error(w, `{"error":"only whoever recorded it or the host can delete a recording"}`, http.StatusForbidden)
+		return
+	}
+	if err := s.streamMgr.DeleteRecordingFiles(rec); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadGateway)
+		return
+	}
+	if err := service.DeleteRecording(s.db, rec.ID); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// downloadRecording sends a call track from the SFU as is, and an HLS
+// recording as a zip of its directory (segments are compressed already,
+// so they are stored).
+func (s *Server) downloadRecording(w http.ResponseWriter, r *http.Request, rec *models.Recording) {
+	name := strings.Map(func(c rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, c) {
+			return '_'
+		}
+		return c
+	}, rec.Title)
+
+	if rec.Kind != streaming.RecordingHLS {
+		body, size, err := s.streamMgr.OpenSFURecording(r.Context(), rec.Path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadGateway)
+			return
+		}
+		defer body.Close()
+		if size >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+		contentType := "video/webm"
+		if rec.Kind == streaming.RecordingOgg {
+			contentType = "audio/ogg"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+rec.Kind))
+		io.Copy(w, body)
+		return
+	}
+
+	dir, err := s.streamMgr.RecordingDir(rec)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+	zw := zip.NewWriter(w)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(rel), Method: zip.Store, Modified: fi.ModTime()})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, f)
+		return err
+	})
+	zw.Close()
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,9 +13,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/discovery"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/library"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/streaming"
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/websocket"
 )
@@ -22,8 +25,9 @@ import (
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, HEAD, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Checksum")
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Upload-Offset, Upload-Length, Upload-Expires, Tus-Max-Size")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -45,19 +49,52 @@ type Server struct {
 	sessionDiscovery *discovery.SessionDiscovery
 	port             int
 	streamMgr        *streaming.StreamManager
+	queue            *streaming.QueueManager
+	uploads          *streaming.UploadStore
+	bus              *events.Bus
+	hubs             *websocket.SessionManager
+	library          *library.Scanner // nil when the media library is disabled
+	sharing          *library.Sharing // shared folders, and other nodes'
 }
 
-func NewServer(db *sql.DB, deviceID string, sessionDiscovery *discovery.SessionDiscovery, port int, streamMgr *streaming.StreamManager) *Server {
+func NewServer(db *sql.DB, deviceID string, sessionDiscovery *discovery.SessionDiscovery, port int, streamMgr *streaming.StreamManager, queue *streaming.QueueManager, uploads *streaming.UploadStore, bus *events.Bus, hubs *websocket.SessionManager, library *library.Scanner, sharing *library.Sharing) *Server {
 	return &Server{
 		db:               db,
 		deviceID:         deviceID,
 		sessionDiscovery: sessionDiscovery,
 		port:             port,
 		streamMgr:        streamMgr,
+		queue:            queue,
+		uploads:          uploads,
+		bus:              bus,
+		hubs:             hubs,
+		library:          library,
+		sharing:          sharing,
 	}
 }
 
+// handleWSMessage handles the WebSocket messages the hub passes through
+// because they need session state (host checks, queue, streams).
+func (s *Server) handleWSMessage(client *websocket.Client, msg map[string]interface{}) bool {
+	msgType, _ := msg["type"].(string)
+
+	switch msgType {
+	case "lower-hand":
+		// Host clearing someone else's raised hand
+		target, _ := msg["targetDeviceId"].(string)
+		if service.IsHost(s.db, client.Session, client.DeviceID) {
+			s.hubs.GetHub(client.Session).LowerHand(target)
+		}
+		return true
+	}
+
+	return s.handlePollMessage(client, msg)
+}
+
 func (s *Server) Start() {
+	s.resumePolls()
+	s.streamMgr.SetOnFinished(s.advanceWhenFinished)
+
 	mux := http.NewServeMux()
 
 	// Unified Session Router
@@ -104,6 +141,77 @@ func (s *Server) Start() {
 		}
 	})
 
+	// Media Queue Router
+	mux.HandleFunc("/queue/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/queue/list":
+			if r.Method == http.MethodGet {
+				s.listQueue(w, r)
+			} else {
+				http.Error(w, "Use GET", 405)
+			}
+		case "/queue/propose":
+			if r.Method == http.MethodPost {
+				s.proposeQueueItem(w, r)
+			} else {
+				http.Error(w, "Use POST", 405)
+			}
+		case "/queue/approve":
+			if r.Method == http.MethodPost {
+				s.approveQueueItem(w, r)
+			} else {
+				http.Error(w, "Use POST", 405)
+			}
+		case "/queue/reorder":
+			if r.Method == http.MethodPost {
+				s.reorderQueue(w, r)
+			} else {
+				http.Error(w, "Use POST", 405)
+			}
+		case "/queue/remove":
+			if r.Method == http.MethodPost {
+				s.removeQueueItem(w, r)
+			} else {
+				http.Error(w, "Use POST", 405)
+			}
+		case "/queue/next":
+			if r.Method == http.MethodPost {
+				s.nextQueueItem(w, r)
+			} else {
+				http.Error(w, "Use POST", 405)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// Polls (created, voted and closed over the WebSocket)
+	mux.HandleFunc("/poll/list", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Use GET", 405)
+			return
+		}
+		s.listPolls(w, r)
+	})
+
+	// Server-Sent Events feed of session, member, device and stream changes
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Use GET", 405)
+			return
+		}
+		s.streamEvents(w, r)
+	})
+
+	// Recorded domain events (session, member, stream, device changes)
+	mux.HandleFunc("/audit", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Use GET", 405)
+			return
+		}
+		s.listAuditLog(w, r)
+	})
+
 	// Devices Router
 	mux.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -158,15 +266,25 @@ func (s *Server) Start() {
 	})
 
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		websocket.ServeWS(w, r, func(client *websocket.Client) {
-			if s.streamMgr.IsStreaming(client.Session) {
-				playlistURL := fmt.Sprintf("/stream/%s/index.m3u8", client.Session)
-				client.Conn.WriteJSON(map[string]interface{}{
+		s.hubs.ServeWS(w, r, func(client *websocket.Client) {
+			if s.streamMgr.IsPlayable(client.Session) {
+				started := map[string]interface{}{
 					"type":        "stream-started",
-					"playlistUrl": playlistURL,
-				})
+					"playlistUrl": streaming.PlaylistURL(client.Session),
+				}
+				if dashURL := s.streamMgr.DASHURL(client.Session); dashURL != "" {
+					started["dashUrl"] = dashURL
+				}
+				client.WriteJSON(started)
+				if tracks := s.streamMgr.GetTracks(client.Session); tracks != nil && (len(tracks.Audio) > 0 || len(tracks.Subtitles) > 0) {
+					client.WriteJSON(map[string]interface{}{
+						"type":   "stream-tracks",
+						"tracks": tracks,
+					})
+				}
 			}
-		})
+			s.sendQueueSnapshot(client)
+		}, s.handleWSMessage)
 	})
 
 	// ── Streaming Routes ────────────────────────────────────
@@ -178,14 +296,17 @@ func (s *Server) Start() {
 			return
 		}
 
+		// Same size limit as the tus uploads, plus room for the other fields
+		r.Body = http.MaxBytesReader(w, r.Body, s.uploads.Limits().MaxSize+1<<20)
 		reader, err := r.MultipartReader()
 		if err != nil {
 			http.Error(w, fmt.Sprintf(`{"error":"failed to read multipart request: %s"}`, err.Error()), http.StatusBadRequest)
 			return
 		}
 
-		var sessionID string
+		var sessionID, deviceID string
 		var savedPath string
+		var playlistURL string // set if streaming started while uploading
 
 		for {
 			part, err := reader.NextPart()
@@ -198,18 +319,27 @@ func (s *Server) Start() {
 			}
 
 			if part.FormName() == "sessionId" {
-				buf, _ := io.ReadAll(part)
+				buf, _ := io.ReadAll(io.LimitReader(part, 256))
 				sessionID = string(buf)
+			} else if part.FormName() == "deviceId" {
+				buf, _ := io.ReadAll(io.LimitReader(part, 256))
+				deviceID = string(buf)
 			} else if part.FormName() == "file" {
 				if sessionID == "" {
 					http.Error(w, `{"error":"sessionId must be sent before file field"}`, http.StatusBadRequest)
 					return
 				}
+				// Only the host streams, and checking also makes sure the
+				// session ID is a real one before it names a directory
+				if !service.IsHost(s.db, sessionID, deviceID) {
+					http.Error(w, `{"error":"only the host can stream a file"}`, http.StatusForbidden)
+					return
+				}
 				
 				// Save uploaded file to temp directory
-				uploadDir := filepath.Join(os.TempDir(), "0xnet-uploads", sessionID)
+				uploadDir := streaming.UploadDir(sessionID)
 				os.MkdirAll(uploadDir, 0755)
-				savedPath = filepath.Join(uploadDir, part.FileName())
+				savedPath = filepath.Join(uploadDir, streaming.SanitizeFileName(part.FileName()))
 
 				dst, err := os.Create(savedPath)
 				if err != nil {
@@ -217,13 +347,20 @@ func (s *Server) Start() {
 					return
 				}
 
-				written, err := io.Copy(dst, part)
+				written, followURL, err := s.copyUpload(sessionID, dst, part)
 				dst.Close()
+				playlistURL = followURL
 				if err != nil {
+					os.Remove(savedPath)
+					var tooLarge *http.MaxBytesError
+					if errors.As(err, &tooLarge) {
+						http.Error(w, fmt.Sprintf(`{"error":%q}`, streaming.ErrUploadTooLarge.Error()), http.StatusRequestEntityTooLarge)
+						return
+					}
 					http.Error(w, fmt.Sprintf(`{"error":"failed to write file: %s"}`, err.Error()), http.StatusInternalServerError)
 					return
 				}
-				log.Printf("📁 [Upload] Saved %s (%d MB) for session %s", part.FileName(), written/(1024*1024), sessionID)
+				log.Printf("📁 [Upload] Saved %s (%d MB) for session %s", filepath.Base(savedPath), written/(1024*1024), sessionID)
 			}
 		}
 
@@ -232,31 +369,28 @@ func (s *Server) Start() {
 			return
 		}
 
+		if playlistURL != "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"playlistUrl": playlistURL})
+			return
+		}
+
 		// Start ffmpeg on the saved file
-		playlistURL, err := s.streamMgr.Start(sessionID, savedPath)
+		playlistURL, err = s.streamMgr.Start(sessionID, savedPath)
 		if err != nil {
 			os.Remove(savedPath)
 			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 			return
 		}
 
-		// Wait for ffmpeg to produce the playlist before notifying guests
-		go func() {
-			if s.streamMgr.WaitForPlaylist(sessionID, 30*time.Second) {
-				log.Printf("📡 [Stream] Broadcasting stream-started for session %s", sessionID)
-				websocket.GlobalManager.GetHub(sessionID).Broadcast(map[string]string{
-					"type":        "stream-started",
-					"playlistUrl": playlistURL,
-				})
-			} else {
-				log.Printf("⚠️ [Stream] Playlist never appeared for session %s, not broadcasting", sessionID)
-			}
-		}()
-
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"playlistUrl": playlistURL})
 	})
 
+	// Resumable (tus) uploads for large files over flaky Wi-Fi
+	mux.HandleFunc("/stream/uploads", s.createUpload)
+	mux.HandleFunc("/stream/uploads/", s.handleUpload)
+
 	mux.HandleFunc("/stream/start", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Use POST", 405)
@@ -264,32 +398,43 @@ func (s *Server) Start() {
 		}
 		var body struct {
 			SessionID string `json:"sessionId"`
+			DeviceID  string `json:"deviceId"`
 			FilePath  string `json:"filePath"`
+			ItemID    string `json:"itemId"` // a media library item instead of a path
+			PeerID    string `json:"peerId"` // with itemId: the item is on that node
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" || (body.FilePath == "" && body.ItemID == "") {
+			http.Error(w, `{"error":"sessionId and filePath or itemId required"}`, http.StatusBadRequest)
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" || body.FilePath == "" {
-			http.Error(w, `{"error":"sessionId and filePath required"}`, http.StatusBadRequest)
+		if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+			http.Error(w, `{"error":"only the host can start a stream"}`, http.StatusForbidden)
 			return
 		}
+		if body.PeerID != "" && body.ItemID != "" {
+			s.startPeerStream(w, r, body.SessionID, body.PeerID, body.ItemID)
+			return
+		}
+		if body.ItemID != "" {
+			item, err := service.GetLibraryItem(s.db, body.ItemID)
+			if err != nil {
+				http.Error(w, `{"error":"library item not found"}`, http.StatusNotFound)
+				return
+			}
+			body.FilePath = item.Path
+		}
 
+		// Start only takes files in the media library (MEDIA_ROOTS) or an upload
 		playlistURL, err := s.streamMgr.Start(body.SessionID, body.FilePath)
+		if errors.Is(err, streaming.ErrOutsideMediaRoots) {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 			return
 		}
 
-		// Wait for ffmpeg to produce the playlist before notifying guests
-		go func() {
-			if s.streamMgr.WaitForPlaylist(body.SessionID, 30*time.Second) {
-				log.Printf("📡 [Stream] Broadcasting stream-started for session %s", body.SessionID)
-				websocket.GlobalManager.GetHub(body.SessionID).Broadcast(map[string]string{
-					"type":        "stream-started",
-					"playlistUrl": playlistURL,
-				})
-			} else {
-				log.Printf("⚠️ [Stream] Playlist never appeared for session %s, not broadcasting", body.SessionID)
-			}
-		}()
-
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"playlistUrl": playlistURL})
 	})
@@ -301,27 +446,67 @@ func (s *Server) Start() {
 		}
 		var body struct {
 			SessionID string `json:"sessionId"`
+			DeviceID  string `json:"deviceId"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" {
 			http.Error(w, `{"error":"sessionId required"}`, http.StatusBadRequest)
 			return
 		}
+		if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+			http.Error(w, `{"error":"only the host can stop the stream"}`, http.StatusForbidden)
+			return
+		}
 
+		// Peers are notified through the StreamStopped event
 		s.streamMgr.Stop(body.SessionID)
 
-		// Notify all peers that streaming stopped
-		websocket.GlobalManager.GetHub(body.SessionID).Broadcast(map[string]string{
-			"type": "stream-stopped",
-		})
-
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "stopped"})
 	})
 
-	// Serve HLS segments: /stream/<sessionID>/index.m3u8, /stream/<sessionID>/seg_000.ts, etc.
+	// Inspect a media file's codecs and tracks before streaming it
+	mux.HandleFunc("/stream/probe", s.probeMedia)
+
+	// Transcode progress and ffmpeg errors for a session's stream
+	mux.HandleFunc("/stream/status", s.streamStatus)
+
+	// Alternate audio / subtitle tracks, the host's pick, and sidecar subtitles
+	mux.HandleFunc("/stream/tracks", s.streamTracks)
+	mux.HandleFunc("/stream/subtitles", s.uploadSubtitle)
+
+	// Low-latency HLS from a camera or screen on the host
+	mux.HandleFunc("/stream/live", s.startLive)
+
+	// RTMP/SRT listener a host pushes to from OBS
+	mux.HandleFunc("/stream/ingest", s.streamIngest)
+
+	// A presenter in the videoCall SFU, restreamed as HLS
+	mux.HandleFunc("/stream/bridge", s.streamBridge)
+
+	// Host-controlled recording of streams (and optionally the call), and
+	// the recordings index
+	mux.HandleFunc("/recordings/start", s.recordSession)
+	mux.HandleFunc("/recordings/stop", s.recordSession)
+	mux.HandleFunc("/recordings", s.listRecordings)
+	mux.HandleFunc("/recordings/", s.handleRecording)
+
+	// Media library: search and browse the files in the media roots
+	mux.HandleFunc("/library", s.listLibrary)
+	mux.HandleFunc("/library/", s.handleLibraryItem)
+	mux.HandleFunc("/library/peers", s.listPeers)
+	mux.HandleFunc("/library/peers/", s.listPeers)
+
+	// Shared folders, for other nodes
+	mux.HandleFunc("/peer/library", s.handlePeerLibrary)
+	mux.HandleFunc("/peer/library/", s.handlePeerLibrary)
+
+	// Serve HLS output: /stream/<sessionID>/master.m3u8, /stream/<sessionID>/720p/index.m3u8,
+	// /stream/<sessionID>/720p/seg_000.ts (or .m4s), /stream/<sessionID>/manifest.mpd, etc.
 	mux.HandleFunc("/stream/", func(w http.ResponseWriter, r *http.Request) {
-		// Skip the start/stop routes that are handled above
-		if r.URL.Path == "/stream/start" || r.URL.Path == "/stream/stop" || r.URL.Path == "/stream/upload" {
+		// Skip the control routes that are handled above
+		switch r.URL.Path {
+		case "/stream/start", "/stream/stop", "/stream/upload", "/stream/probe", "/stream/status",
+			"/stream/tracks", "/stream/subtitles", "/stream/live", "/stream/ingest", "/stream/bridge":
 			return
 		}
 
@@ -344,11 +529,52 @@ func (s *Server) Start() {
 		if strings.HasSuffix(filename, ".m3u8") {
 			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
 			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		} else if strings.HasSuffix(filename, ".ts") {
-			w.Header().Set("Content-Type", "video/MP2T")
+			// The master lists the tracks this session's host picked
+			if filename == streaming.MasterPlaylistName {
+				if master, ok := s.streamMgr.MasterPlaylist(sessionID); ok {
+					w.Write(master)
+					return
+				}
+			}
+			// Low-latency playlists may be held until a segment or part exists
+			if !s.waitForLivePlaylist(w, r, sessionID) {
+				return
+			}
+		} else if filename == streaming.DASHManifestName {
+			// Rendered from the variant playlists, like the master
+			manifest, ok := s.streamMgr.DASHManifest(sessionID)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/dash+xml")
+			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+			w.Write(manifest)
+			return
+		} else if strings.HasSuffix(filename, ".ts") || strings.HasSuffix(filename, ".m4s") {
+			// Transcodes are segmented on demand; this may wait for ffmpeg or seek it here
+			if err := s.streamMgr.PrepareSegment(sessionID, filename); err != nil {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusServiceUnavailable)
+				return
+			}
+			if strings.HasSuffix(filename, ".m4s") {
+				w.Header().Set("Content-Type", "video/iso.segment")
+			} else {
+				w.Header().Set("Content-Type", "video/MP2T")
+			}
+			s.streamMgr.MarkPlaying(sessionID)
+		} else if strings.HasSuffix(filename, ".mp4") {
+			w.Header().Set("Content-Type", "video/mp4") // fMP4 init segment
+		} else if strings.HasSuffix(filename, ".vtt") {
+			w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
 		}
 
-		// Serve the file from the HLS output directory
+		// Serve the file from the HLS output directory, or uploaded
+		// subtitles from the session's own sidecar directory
+		if dir := s.streamMgr.SidecarDir(sessionID, filename); dir != "" {
+			outputDir = dir
+		}
 		prefix := fmt.Sprintf("/stream/%s/", sessionID)
 		http.StripPrefix(prefix, http.FileServer(http.Dir(outputDir))).ServeHTTP(w, r)
 	})
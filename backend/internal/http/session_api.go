@@ -25,7 +25,7 @@ func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := service.CreateSession(s.db, body.Name, s.deviceID)
+	session, err := service.CreateSession(s.db, s.bus, body.Name, s.deviceID)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -49,6 +49,7 @@ func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
 		localSessions[i].HostIP = s.getLocalIP()
 		localSessions[i].HostPort = s.port
 		localSessions[i].Members, _ = service.GetSessionMembers(s.db, localSessions[i].ID)
+		localSessions[i].PosterURL = s.streamMgr.PosterURL(localSessions[i].ID)
 	}
 
 	log.Printf("🔎 listSessions called (source=%s) | local=%d", r.URL.Query().Get("source"), len(localSessions))
@@ -112,7 +113,7 @@ func (s *Server) deleteSession(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Only allow deleting sessions hosted by this device
-	err := service.DeleteSession(s.db, body.SessionID, s.deviceID)
+	err := service.DeleteSession(s.db, s.bus, body.SessionID, s.deviceID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
@@ -0,0 +1,359 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/streaming"
+)
+
+// probeMedia handles GET /stream/probe?filePath=X or ?sessionId=X
+// Returns the codecs, tracks and duration ffprobe finds in a file in the
+// media roots, or in the file a session is currently streaming (which is
+// how an upload is probed).
+func (s *Server) probeMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Use GET", 405)
+		return
+	}
+
+	var info *streaming.MediaInfo
+	if sessionID := r.URL.Query().Get("sessionId"); sessionID != "" {
+		info = s.streamMgr.GetMediaInfo(sessionID)
+		if info == nil {
+			http.Error(w, `{"error":"no probed stream for this session"}`, http.StatusNotFound)
+			return
+		}
+	} else {
+		filePath := r.URL.Query().Get("filePath")
+		if filePath == "" {
+			http.Error(w, `{"error":"filePath or sessionId required"}`, http.StatusBadRequest)
+			return
+		}
+		filePath, err := s.streamMgr.ResolveMedia("", filePath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+			return
+		}
+		info, err = s.streamMgr.Probe(filePath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// streamStatus handles GET /stream/status?sessionId=X
+// Returns the transcode state, position, speed and recent ffmpeg errors.
+func (s *Server) streamStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Use GET", 405)
+		return
+	}
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, `{"error":"sessionId required"}`, http.StatusBadRequest)
+		return
+	}
+
+	status := s.streamMgr.GetStatus(sessionID)
+	if status == nil {
+		http.Error(w, `{"error":"no stream for this session"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// streamTracks handles /stream/tracks
+//
+//	GET  ?sessionId=X                                         → the stream's audio/subtitle tracks
+//	POST {sessionId, deviceId, audio?, subtitle?} (host only) → picks the tracks for everyone
+//
+// Omitted fields keep the current choice; "subtitle": "" turns subtitles off.
+func (s *Server) streamTracks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		sessionID := r.URL.Query().Get("sessionId")
+		if sessionID == "" {
+			http.Error(w, `{"error":"sessionId required"}`, http.StatusBadRequest)
+			return
+		}
+		tracks := s.streamMgr.GetTracks(sessionID)
+		if tracks == nil {
+			http.Error(w, `{"error":"no stream for this session"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tracks)
+
+	case http.MethodPost:
+		var body struct {
+			SessionID string  `json:"sessionId"`
+			DeviceID  string  `json:"deviceId"`
+			Audio     *string `json:"audio"`
+			Subtitle  *string `json:"subtitle"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" || body.DeviceID == "" {
+			http.Error(w, `{"error":"sessionId and deviceId required"}`, http.StatusBadRequest)
+			return
+		}
+		if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+			http.Error(w, `{"error":"only the host can pick tracks"}`, http.StatusForbidden)
+			return
+		}
+		tracks, err := s.streamMgr.SelectTracks(body.SessionID, body.Audio, body.Subtitle)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tracks)
+
+	default:
+		http.Error(w, "Use GET or POST", 405)
+	}
+}
+
+// uploadSubtitle handles POST /stream/subtitles (multipart: sessionId,
+// deviceId, language, label, file; host only). The .srt or .vtt file is converted to WebVTT and
+// added to the session's stream as an extra subtitle track.
+func (s *Server) uploadSubtitle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", 405)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, streaming.MaxSubtitleSize)
+	if err := r.ParseMultipartForm(streaming.MaxSubtitleSize); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"failed to read multipart request: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	sessionID := r.FormValue("sessionId")
+	file, header, err := r.FormFile("file")
+	if sessionID == "" || err != nil {
+		http.Error(w, `{"error":"sessionId and file required"}`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if !service.IsHost(s.db, sessionID, r.FormValue("deviceId")) {
+		http.Error(w, `{"error":"only the host can add subtitles"}`, http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"failed to read file: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	vtt, err := streaming.ToWebVTT(header.Filename, data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	tracks, err := s.streamMgr.AddSubtitle(sessionID, r.FormValue("language"), r.FormValue("label"), vtt)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tracks)
+}
+
+// startLive handles POST /stream/live {sessionId, deviceId, format, url}
+// (host only). Streams a camera, screen or microphone on the host as
+// low-latency HLS, e.g. {"format": "v4l2", "url": "/dev/video0"}.
+func (s *Server) startLive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", 405)
+		return
+	}
+	var body struct {
+		SessionID string `json:"sessionId"`
+		DeviceID  string `json:"deviceId"`
+		streaming.LiveSource
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" || body.Format == "" || body.URL == "" {
+		http.Error(w, `{"error":"sessionId, format and url required"}`, http.StatusBadRequest)
+		return
+	}
+	if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+		http.Error(w, `{"error":"only the host can stream a live source"}`, http.StatusForbidden)
+		return
+	}
+	// Only capture devices: other ffmpeg inputs can read files and URLs
+	if !streaming.IsCaptureFormat(body.Format) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "unsupported capture format "+body.Format), http.StatusBadRequest)
+		return
+	}
+
+	playlistURL, err := s.streamMgr.StartLive(body.SessionID, body.LiveSource)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"playlistUrl": playlistURL})
+}
+
+// waitForLivePlaylist honours LL-HLS blocking playlist reloads
+// (?_HLS_msn=M[&_HLS_part=P]) before a low-latency variant playlist is
+// served. Returns false after writing an error response.
+func (s *Server) waitForLivePlaylist(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	query := r.URL.Query()
+	if !query.Has("_HLS_msn") {
+		return true
+	}
+	msn, err := strconv.Atoi(query.Get("_HLS_msn"))
+	if err != nil || msn < 0 {
+		http.Error(w, `{"error":"invalid _HLS_msn"}`, http.StatusBadRequest)
+		return false
+	}
+	part := -1
+	if query.Has("_HLS_part") {
+		if part, err = strconv.Atoi(query.Get("_HLS_part")); err != nil || part < 0 {
+			http.Error(w, `{"error":"invalid _HLS_part"}`, http.StatusBadRequest)
+			return false
+		}
+	}
+
+	switch err := s.streamMgr.WaitForLivePlaylist(sessionID, msn, part); {
+	case errors.Is(err, streaming.ErrReloadTooFar):
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return false
+	case err != nil:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// streamIngest handles /stream/ingest (host only; the stream key is a secret)
+//
+//	POST {sessionId, deviceId, protocol: "rtmp"|"srt", transcode?} → opens a listener for OBS
+//	GET  ?sessionId=X&deviceId=Y                                  → the open ingest
+//
+// Viewers get stream-started once the publisher's first segment lands.
+func (s *Server) streamIngest(w http.ResponseWriter, r *http.Request) {
+	var sessionID, deviceID string
+	var ingest *streaming.Ingest
+	switch r.Method {
+	case http.MethodGet:
+		sessionID, deviceID = r.URL.Query().Get("sessionId"), r.URL.Query().Get("deviceId")
+		if sessionID == "" || deviceID == "" {
+			http.Error(w, `{"error":"sessionId and deviceId required"}`, http.StatusBadRequest)
+			return
+		}
+		if !service.IsHost(s.db, sessionID, deviceID) {
+			http.Error(w, `{"error":"only the host can see the stream key"}`, http.StatusForbidden)
+			return
+		}
+		if ingest = s.streamMgr.GetIngest(sessionID); ingest == nil {
+			http.Error(w, `{"error":"no ingest for this session"}`, http.StatusNotFound)
+			return
+		}
+
+	case http.MethodPost:
+		var body struct {
+			SessionID string `json:"sessionId"`
+			DeviceID  string `json:"deviceId"`
+			Protocol  string `json:"protocol"`
+			Transcode bool   `json:"transcode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" || body.DeviceID == "" {
+			http.Error(w, `{"error":"sessionId and deviceId required"}`, http.StatusBadRequest)
+			return
+		}
+		if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+			http.Error(w, `{"error":"only the host can start an ingest"}`, http.StatusForbidden)
+			return
+		}
+		if body.Protocol == "" {
+			body.Protocol = streaming.IngestRTMP
+		}
+		var err error
+		sessionID = body.SessionID
+		if ingest, err = s.streamMgr.StartIngest(sessionID, body.Protocol, body.Transcode); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Use GET or POST", 405)
+		return
+	}
+
+	host := s.getLocalIP()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		*streaming.Ingest
+		Server      string `json:"server,omitempty"`
+		URL         string `json:"url"`
+		PlaylistURL string `json:"playlistUrl"`
+	}{ingest, ingest.Server(host), ingest.URL(host), streaming.PlaylistURL(sessionID)})
+}
+
+// streamBridge handles /stream/bridge (needs SFU_URL)
+//
+//	GET  ?room=X                                          → who is publishing in an SFU room
+//	POST {sessionId, deviceId, room?, publisher} (host only) → streams that publisher as LL-HLS
+//
+// room defaults to the session ID.
+func (s *Server) streamBridge(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		room := r.URL.Query().Get("room")
+		if room == "" {
+			http.Error(w, `{"error":"room required"}`, http.StatusBadRequest)
+			return
+		}
+		publishers, err := s.streamMgr.SFUPublishers(room)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(publishers)
+
+	case http.MethodPost:
+		var body struct {
+			SessionID string `json:"sessionId"`
+			DeviceID  string `json:"deviceId"`
+			streaming.BridgeSource
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" || body.Publisher == "" {
+			http.Error(w, `{"error":"sessionId and publisher required"}`, http.StatusBadRequest)
+			return
+		}
+		if !service.IsHost(s.db, body.SessionID, body.DeviceID) {
+			http.Error(w, `{"error":"only the host can bridge a call"}`, http.StatusForbidden)
+			return
+		}
+		if body.Room == "" {
+			body.Room = body.SessionID
+		}
+		playlistURL, err := s.streamMgr.StartBridge(body.SessionID, body.BridgeSource)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"playlistUrl": playlistURL})
+
+	default:
+		http.Error(w, "Use GET or POST", 405)
+	}
+}
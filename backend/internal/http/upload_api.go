@@ -0,0 +1,295 @@
+package httpapi
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/streaming"
+)
+
+// Resumable uploads follow the tus 1.0 protocol (creation, termination,
+// checksum and expiration extensions), so stock tus clients work:
+//
+//	POST   /stream/uploads        Upload-Length + Upload-Metadata (sessionId, deviceId, filename) → 201 Location
+//	HEAD   /stream/uploads/<id>   → Upload-Offset, Upload-Length
+//	PATCH  /stream/uploads/<id>   Upload-Offset (+ Upload-Checksum) + chunk → 204, or 200 {playlistUrl} when complete
+//	DELETE /stream/uploads/<id>   → 204
+//
+// Every request on an upload carries the creator's deviceId in
+// Upload-Metadata too (tus clients can send extra headers with each
+// request); anyone else gets 403.
+const tusVersion = "1.0.0"
+
+// statusChecksumMismatch is tus' status for a chunk that failed verification.
+const statusChecksumMismatch = 460
+
+// createUpload handles POST /stream/uploads
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", 405)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Upload-Length header required"}`, http.StatusBadRequest)
+		return
+	}
+	meta := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	sessionID := meta["sessionId"]
+	if sessionID == "" {
+		http.Error(w, `{"error":"sessionId required in Upload-Metadata"}`, http.StatusBadRequest)
+		return
+	}
+	if !service.IsHost(s.db, sessionID, meta["deviceId"]) {
+		http.Error(w, `{"error":"only the host can upload media"}`, http.StatusForbidden)
+		return
+	}
+
+	upload, err := s.uploads.Create(sessionID, meta["deviceId"], meta["filename"], size)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, streaming.ErrUploadTooLarge) || errors.Is(err, streaming.ErrQuotaExceeded) {
+			status = http.StatusRequestEntityTooLarge
+		} else if size <= 0 {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), status)
+		return
+	}
+
+	w.Header().Set("Location", "/stream/uploads/"+upload.ID)
+	w.Header().Set("Upload-Offset", "0")
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(s.uploads.Limits().MaxSize, 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(upload)
+}
+
+// handleUpload handles HEAD, GET, PATCH and DELETE on /stream/uploads/<id>
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	id := strings.TrimPrefix(r.URL.Path, "/stream/uploads/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Knowing the ID isn't enough: it's in the JSON of the upload
+	deviceID := parseUploadMetadata(r.Header.Get("Upload-Metadata"))["deviceId"]
+	upload, err := s.uploads.Get(id, deviceID)
+	if errors.Is(err, streaming.ErrNotUploader) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"upload not found"}`, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		setUploadHeaders(w, upload)
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(upload)
+
+	case http.MethodPatch:
+		s.patchUpload(w, r, id)
+
+	case http.MethodDelete:
+		if err := s.uploads.Remove(id); err != nil {
+			http.Error(w, `{"error":"upload not found"}`, http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Use HEAD, GET, PATCH or DELETE", 405)
+	}
+}
+
+// patchUpload writes one chunk and, once the upload is complete, starts
+// streaming the file.
+func (s *Server) patchUpload(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, `{"error":"Content-Type must be application/offset+octet-stream"}`, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error":"Upload-Offset header required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var sum hash.Hash
+	var expected []byte
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		sum, expected, err = parseUploadChecksum(header)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	upload, finalPath, err := s.uploads.WriteChunk(id, offset, r.Body, sum, expected)
+	if upload != nil {
+		setUploadHeaders(w, upload)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, streaming.ErrUploadNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, streaming.ErrOffsetMismatch):
+			status = http.StatusConflict
+		case errors.Is(err, streaming.ErrUploadBusy):
+			status = http.StatusLocked
+		case errors.Is(err, streaming.ErrChecksumMismatch):
+			status = statusChecksumMismatch
+		case errors.Is(err, streaming.ErrUploadTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), status)
+		return
+	}
+
+	if finalPath == "" {
+		// Start streaming early if the container allows reading it while
+		// it grows; viewers learn about it through stream-started
+		if growing := s.uploads.Follow(id); growing != nil {
+			if _, err := s.streamMgr.StartFollowing(upload.SessionID, growing); err != nil {
+				log.Printf("⚠️ [Upload] Failed to start streaming %s early: %v", upload.FileName, err)
+			} else {
+				s.uploads.MarkFollowing(id)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Already streaming while it uploaded; otherwise (not followable, or
+	// following failed) start from the finished file
+	if upload.Following {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"playlistUrl": streaming.PlaylistURL(upload.SessionID)})
+		return
+	}
+
+	// Upload complete: hand the file to ffmpeg
+	playlistURL, err := s.streamMgr.Start(upload.SessionID, finalPath)
+	if err != nil {
+		os.Remove(finalPath)
+		log.Printf("⚠️ [Upload] Failed to start stream for %s: %v", upload.FileName, err)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"playlistUrl": playlistURL})
+}
+
+func setUploadHeaders(w http.ResponseWriter, upload *streaming.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// parseUploadMetadata decodes tus metadata: comma-separated "key base64value" pairs.
+func parseUploadMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		meta[key] = string(value)
+	}
+	return meta
+}
+
+// parseUploadChecksum parses "Upload-Checksum: <algorithm> <base64 digest>".
+func parseUploadChecksum(header string) (hash.Hash, []byte, error) {
+	algorithm, encoded, _ := strings.Cut(strings.TrimSpace(header), " ")
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Upload-Checksum digest")
+	}
+
+	switch strings.ToLower(algorithm) {
+	case "sha256":
+		return sha256.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "md5":
+		return md5.New(), expected, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %q (use sha256, sha1 or md5)", algorithm)
+	}
+}
+
+// copyUpload writes a single-request (multipart) upload to dst. Once
+// enough has arrived and the container can be read while it grows, the
+// stream starts following the file; the returned playlist URL is empty if
+// that didn't happen and the caller should start the stream itself.
+func (s *Server) copyUpload(sessionID string, dst *os.File, src io.Reader) (int64, string, error) {
+	growing := streaming.NewGrowingFile(dst.Name())
+	var written int64
+	var playlistURL string
+	tried := false
+
+	buf := make([]byte, 1<<20)
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				growing.Abort(streaming.ErrUploadAborted)
+				return written, playlistURL, err
+			}
+			written += int64(n)
+			growing.Advance(written)
+
+			if !tried && written >= streaming.FollowUploadThreshold {
+				tried = true
+				if streaming.CanFollowUpload(dst.Name()) {
+					url, err := s.streamMgr.StartFollowing(sessionID, growing)
+					if err != nil {
+						log.Printf("⚠️ [Upload] Failed to start streaming early: %v", err)
+					}
+					playlistURL = url
+				}
+			}
+		}
+		if readErr == io.EOF {
+			growing.Complete()
+			return written, playlistURL, nil
+		}
+		if readErr != nil {
+			growing.Abort(streaming.ErrUploadAborted)
+			return written, playlistURL, readErr
+		}
+	}
+}
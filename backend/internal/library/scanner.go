@@ -0,0 +1,296 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/service"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/streaming"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultThumbnailDir holds one poster frame per library item.
+	DefaultThumbnailDir = "./data/library"
+	// DefaultScanInterval is how often the roots are checked for changes.
+	DefaultScanInterval = time.Minute
+
+	thumbnailWidth = 320
+	// posterTimeout bounds rendering one thumbnail; it only decodes
+	// keyframes, so a slow one is a broken file.
+	posterTimeout = 30 * time.Second
+)
+
+// mediaExtensions are the files the scanner probes; everything else in
+// the roots (artwork, .nfo, subtitles) is ignored.
+var mediaExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mkv": true, ".webm": true, ".mov": true, ".avi": true,
+	".wmv": true, ".flv": true, ".ts": true, ".m2ts": true, ".mpg": true, ".mpeg": true,
+	".mp3": true, ".m4a": true, ".aac": true, ".flac": true, ".ogg": true, ".opus": true, ".wav": true,
+}
+
+// Scanner keeps the library_items table in step with the media roots.
+// There's no file system notification API in the standard library, so it
+// watches by polling: every interval it walks the roots and compares
+// sizes and modification times with the index, which is cheap since only
+// new or changed files are probed.
+type Scanner struct {
+	db       *sql.DB
+	bus      *events.Bus
+	roots    *streaming.MediaRoots
+	probe    func(path string) (*streaming.MediaInfo, error)
+	thumbDir string
+	interval time.Duration
+	rescan   chan struct{}
+
+	mu     sync.Mutex
+	failed map[string]time.Time // files ffprobe rejected, by path, with their mtime then
+}
+
+// NewScanner creates a scanner for the roots that reads files with probe
+// (usually StreamManager.Probe). Thumbnails are written to thumbDir.
+func NewScanner(db *sql.DB, bus *events.Bus, roots *streaming.MediaRoots, probe func(path string) (*streaming.MediaInfo, error), thumbDir string, interval time.Duration) (*Scanner, error) {
+	if err := os.MkdirAll(thumbDir, 0755); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = DefaultScanInterval
+	}
+	return &Scanner{
+		db:       db,
+		bus:      bus,
+		roots:    roots,
+		probe:    probe,
+		thumbDir: thumbDir,
+		interval: interval,
+		rescan:   make(chan struct{}, 1),
+		failed:   make(map[string]time.Time),
+	}, nil
+}
+
+// Run scans the roots now and then whenever they may have changed, until
+// ctx is cancelled.
+func (s *Scanner) Run(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			s.scan(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.rescan:
+			}
+		}
+	}()
+}
+
+// Rescan asks for a scan without waiting for the next tick. Requests
+// made while one is pending are merged.
+func (s *Scanner) Rescan() {
+	select {
+	case s.rescan <- struct{}{}:
+	default:
+	}
+}
+
+// Thumbnail returns the path of an item's thumbnail, or "" if it has none.
+func (s *Scanner) Thumbnail(item *models.LibraryItem) string {
+	if !item.HasThumbnail {
+		return ""
+	}
+	return filepath.Join(s.thumbDir, item.ID+".jpg")
+}
+
+// Roots returns the folders the library is built from.
+func (s *Scanner) Roots() []string {
+	return s.roots.Dirs()
+}
+
+// scan brings the index up to date with one walk over the roots.
+func (s *Scanner) scan(ctx context.Context) {
+	known, err := service.LibraryItemsByPath(s.db)
+	if err != nil {
+		log.Printf("⚠️ [Library] Failed to read the index: %v", err)
+		return
+	}
+
+	var changes events.LibraryUpdated
+	seen := make(map[string]bool)
+	var unavailable []string
+	for _, root := range s.roots.Dirs() {
+		if _, err := os.Stat(root); err != nil {
+			// An unplugged drive keeps its items until it comes back
+			log.Printf("⚠️ [Library] Media root unavailable: %v", err)
+			unavailable = append(unavailable, root)
+			continue
+		}
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				return nil // unreadable folder: skip it, keep walking
+			}
+			if strings.HasPrefix(d.Name(), ".") && path != root {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !mediaExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			seen[path] = true
+
+			fi, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			item := known[path]
+			if item != nil && item.Size == fi.Size() && item.ModTime.Unix() == fi.ModTime().Unix() {
+				return nil
+			}
+			if s.probeFailed(path, fi.ModTime()) {
+				return nil
+			}
+			if s.index(ctx, root, path, fi, item) {
+				if item == nil {
+					changes.Added++
+				} else {
+					changes.Updated++
+				}
+			}
+			return nil
+		})
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	for path, item := range known {
+		if seen[path] || underAny(unavailable, path) {
+			continue
+		}
+		if err := service.DeleteLibraryItem(s.db, item.ID); err != nil {
+			log.Printf("⚠️ [Library] Failed to remove %s: %v", item.FileName, err)
+			continue
+		}
+		os.Remove(filepath.Join(s.thumbDir, item.ID+".jpg"))
+		changes.Removed++
+	}
+
+	if changes.Added+changes.Updated+changes.Removed > 0 {
+		log.Printf("📚 [Library] %d added, %d updated, %d removed", changes.Added, changes.Updated, changes.Removed)
+		s.bus.Publish("", changes)
+	}
+}
+
+// index probes a new or changed file and saves it, keeping the ID of the
+// item already at that path. It reports whether the file was indexed.
+func (s *Scanner) index(ctx context.Context, root, path string, fi fs.FileInfo, prev *models.LibraryItem) bool {
+	media, err := s.probe(path)
+	if err != nil {
+		log.Printf("⚠️ [Library] Skipping %s: %v", filepath.Base(path), err)
+		s.mu.Lock()
+		s.failed[path] = fi.ModTime()
+		s.mu.Unlock()
+		return false
+	}
+
+	rel, _ := filepath.Rel(root, path)
+	folder := filepath.ToSlash(filepath.Dir(rel))
+	if folder == "." {
+		folder = ""
+	}
+	item := &models.LibraryItem{
+		ID:          uuid.New().String(),
+		Root:        root,
+		Folder:      folder,
+		FileName:    filepath.Base(path),
+		Title:       strings.TrimSpace(media.Title),
+		Path:        path,
+		Size:        fi.Size(),
+		ModTime:     fi.ModTime(),
+		Duration:    media.Duration,
+		Container:   media.FormatName,
+		AudioTracks: len(media.Audio),
+		Subtitles:   len(media.Subtitles),
+		IndexedAt:   time.Now(),
+	}
+	if prev != nil {
+		item.ID = prev.ID
+	}
+	if item.Title == "" {
+		item.Title = titleFromFileName(item.FileName)
+	}
+	if v := media.PrimaryVideo(); v != nil {
+		item.VideoCodec, item.Width, item.Height = v.Codec, v.Width, v.Height
+	}
+	if a := media.PrimaryAudio(); a != nil {
+		item.AudioCodec = a.Codec
+	}
+
+	if item.VideoCodec != "" {
+		pctx, cancel := context.WithTimeout(ctx, posterTimeout)
+		err := streaming.RenderPoster(pctx, path, filepath.Join(s.thumbDir, item.ID+".jpg"), media, thumbnailWidth)
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ [Library] No thumbnail for %s: %v", item.FileName, err)
+		}
+		item.HasThumbnail = err == nil
+	}
+	if !item.HasThumbnail {
+		os.Remove(filepath.Join(s.thumbDir, item.ID+".jpg"))
+	}
+
+	if err := service.SaveLibraryItem(s.db, item); err != nil {
+		log.Printf("⚠️ [Library] Failed to index %s: %v", item.FileName, err)
+		return false
+	}
+	return true
+}
+
+// probeFailed reports whether ffprobe already rejected the file as it is
+// now; a changed file gets another try.
+func (s *Scanner) probeFailed(path string, modTime time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failedAt, ok := s.failed[path]
+	if ok && !failedAt.Equal(modTime) {
+		delete(s.failed, path)
+		return false
+	}
+	return ok
+}
+
+// titleFromFileName turns "The.Big.Movie_2019.mkv" into "The Big Movie 2019".
+func titleFromFileName(name string) string {
+	title := strings.TrimSuffix(name, filepath.Ext(name))
+	title = strings.Join(strings.Fields(strings.NewReplacer(".", " ", "_", " ").Replace(title)), " ")
+	if title == "" {
+		return name
+	}
+	return title
+}
+
+// underAny reports whether path is inside one of dirs.
+func underAny(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
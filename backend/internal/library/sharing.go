@@ -0,0 +1,292 @@
+package library
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/discovery"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/streaming"
+)
+
+const (
+	// DeviceHeader carries the device ID of the node making a peer
+	// library request.
+	DeviceHeader = "X-0Xnet-Device"
+
+	// grantIdleTimeout expires a file grant nobody has read with for this
+	// long. Reads keep it alive, so long movies watched with pauses work.
+	grantIdleTimeout = time.Hour
+	peerTimeout      = 10 * time.Second
+)
+
+var (
+	ErrUnknownPeer    = errors.New("not a known 0Xnet node")
+	ErrPeerNotAllowed = errors.New("this node doesn't share its library with yours")
+	ErrNotShared      = errors.New("file is not in a shared folder")
+)
+
+// Peer is another node on the LAN whose shared library can be browsed.
+type Peer struct {
+	ID      string `json:"peerId"` // the hashed device ID /devices lists
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+// PeerListing is a page of another node's shared library.
+type PeerListing struct {
+	Items []models.LibraryItem `json:"items"`
+	Total int                  `json:"total"`
+}
+
+// grant lets one node read one shared file.
+type grant struct {
+	itemID   string
+	deviceID string
+	lastUsed time.Time
+}
+
+// Sharing publishes selected library folders to the other nodes on the
+// LAN, and fetches what they publish. A host streams a peer's file by
+// asking its owner for a grant: a token URL the host's ffmpeg reads the
+// file from with range requests. The owner only answers nodes discovery
+// knows, from the address it knows them at, optionally narrowed to an
+// allow-list of addresses.
+type Sharing struct {
+	db        *sql.DB
+	discovery *discovery.SessionDiscovery
+	deviceID  string
+	folders   []string     // shared, canonical
+	allowed   []*net.IPNet // nil: any discovered node
+	client    *http.Client
+
+	mu     sync.Mutex
+	grants map[string]*grant // by token
+}
+
+// NewSharing shares folders (separated like PATH entries, each inside
+// a media root) with the nodes in allowed (IPs or CIDRs, comma-separated;
+// "" allows every discovered node).
+func NewSharing(db *sql.DB, sd *discovery.SessionDiscovery, deviceID string, roots *streaming.MediaRoots, folders, allowed string) (*Sharing, error) {
+	s := &Sharing{
+		db:        db,
+		discovery: sd,
+		deviceID:  deviceID,
+		client:    &http.Client{Timeout: peerTimeout},
+		grants:    make(map[string]*grant),
+	}
+	for _, dir := range filepath.SplitList(folders) {
+		if dir = strings.TrimSpace(dir); dir == "" {
+			continue
+		}
+		canonical, err := roots.ResolveDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("shared folder %s: %w", dir, err)
+		}
+		s.folders = append(s.folders, canonical)
+	}
+	for _, entry := range strings.Split(allowed, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer address %q", entry)
+		}
+		s.allowed = append(s.allowed, ipNet)
+	}
+	return s, nil
+}
+
+// Folders returns the shared folders.
+func (s *Sharing) Folders() []string {
+	return append([]string{}, s.folders...)
+}
+
+// ── Owner side ───────────────────────────────────────────────────────────────
+
+// Authorize checks that a request comes from a node this one may share
+// with, and returns that node's device ID.
+func (s *Sharing) Authorize(r *http.Request) (string, error) {
+	deviceID := r.Header.Get(DeviceHeader)
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || deviceID == "" {
+		return "", ErrUnknownPeer
+	}
+	ip := net.ParseIP(host)
+
+	// Discovery found the node at an address; the request must come from it
+	known := false
+	for _, d := range s.discovery.GetDiscoveredDevices() {
+		if d.DeviceID == deviceID {
+			addr := net.ParseIP(d.Address)
+			known = addr != nil && ip != nil && addr.Equal(ip)
+			break
+		}
+	}
+	if !known {
+		return "", ErrUnknownPeer
+	}
+	if s.allowed != nil {
+		for _, n := range s.allowed {
+			if n.Contains(ip) {
+				return deviceID, nil
+			}
+		}
+		return "", ErrPeerNotAllowed
+	}
+	return deviceID, nil
+}
+
+// IsShared reports whether an item is inside a shared folder.
+func (s *Sharing) IsShared(item *models.LibraryItem) bool {
+	return underAny(s.folders, item.Path)
+}
+
+// Grant lets a node read a shared file and returns the token to read it
+// with.
+func (s *Sharing) Grant(item *models.LibraryItem, deviceID string) (string, error) {
+	if !s.IsShared(item) {
+		return "", ErrNotShared
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, g := range s.grants {
+		if time.Since(g.lastUsed) > grantIdleTimeout {
+			delete(s.grants, t)
+		}
+	}
+	s.grants[token] = &grant{itemID: item.ID, deviceID: deviceID, lastUsed: time.Now()}
+	return token, nil
+}
+
+// Redeem reports whether token grants reading an item, and keeps the
+// grant alive.
+func (s *Sharing) Redeem(itemID, token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.grants[token]
+	if g == nil || g.itemID != itemID {
+		return false
+	}
+	if time.Since(g.lastUsed) > grantIdleTimeout {
+		delete(s.grants, token)
+		return false
+	}
+	g.lastUsed = time.Now()
+	return true
+}
+
+// ── Host side ────────────────────────────────────────────────────────────────
+
+// Peers returns the nodes discovery knows.
+func (s *Sharing) Peers() []Peer {
+	peers := []Peer{}
+	for _, d := range s.discovery.GetDiscoveredDevices() {
+		peers = append(peers, Peer{ID: peerID(d.DeviceID), Address: d.Address, Port: d.Port})
+	}
+	return peers
+}
+
+// Search lists a page of a peer's shared library; query takes q, limit
+// and offset like GET /library. Thumbnail URLs point at the peer.
+func (s *Sharing) Search(ctx context.Context, peer string, query url.Values) (*PeerListing, error) {
+	base, err := s.peerBase(peer)
+	if err != nil {
+		return nil, err
+	}
+	var listing PeerListing
+	if err := s.call(ctx, http.MethodGet, base+"/peer/library?"+query.Encode(), &listing); err != nil {
+		return nil, err
+	}
+	for i := range listing.Items {
+		if listing.Items[i].ThumbnailURL != "" {
+			listing.Items[i].ThumbnailURL = base + listing.Items[i].ThumbnailURL
+		}
+	}
+	return &listing, nil
+}
+
+// Open asks a peer for a grant on one of its files and returns the URL
+// to read it from, and the item.
+func (s *Sharing) Open(ctx context.Context, peer, itemID string) (string, *models.LibraryItem, error) {
+	base, err := s.peerBase(peer)
+	if err != nil {
+		return "", nil, err
+	}
+	var granted struct {
+		URL  string             `json:"url"`
+		Item models.LibraryItem `json:"item"`
+	}
+	if err := s.call(ctx, http.MethodPost, base+"/peer/library/"+url.PathEscape(itemID)+"/grant", &granted); err != nil {
+		return "", nil, err
+	}
+	return base + granted.URL, &granted.Item, nil
+}
+
+// peerBase returns the base URL of a discovered peer.
+func (s *Sharing) peerBase(peer string) (string, error) {
+	for _, d := range s.discovery.GetDiscoveredDevices() {
+		if peerID(d.DeviceID) == peer {
+			return "http://" + net.JoinHostPort(d.Address, fmt.Sprint(d.Port)), nil
+		}
+	}
+	return "", fmt.Errorf("peer %s not found on the network", peer)
+}
+
+// call makes a peer library request and decodes the JSON answer; the
+// peer's {"error"} becomes the error.
+func (s *Sharing) call(ctx context.Context, method, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(DeviceHeader, s.deviceID)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("peer unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+			return fmt.Errorf("peer: %s", body.Error)
+		}
+		return fmt.Errorf("peer answered %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// peerID hashes a device ID the way /devices does.
+func peerID(deviceID string) string {
+	sum := sha256.Sum256([]byte(deviceID))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is one recorded domain event
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
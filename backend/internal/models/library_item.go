@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// LibraryItem is a media file found in one of the node's media roots
+type LibraryItem struct {
+	ID           string    `json:"id"`
+	Root         string    `json:"root"`   // media root the file is in
+	Folder       string    `json:"folder"` // relative to Root, "/"-separated; "" at the top
+	FileName     string    `json:"fileName"`
+	Title        string    `json:"title"` // container title tag, else from the file name
+	Path         string    `json:"-"`
+	Size         int64     `json:"size"` // bytes
+	ModTime      time.Time `json:"modTime"`
+	Duration     float64   `json:"duration"` // seconds, 0 if unknown
+	Container    string    `json:"container"`
+	VideoCodec   string    `json:"videoCodec,omitempty"`
+	AudioCodec   string    `json:"audioCodec,omitempty"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	AudioTracks  int       `json:"audioTracks"`
+	Subtitles    int       `json:"subtitles"`
+	HasThumbnail bool      `json:"-"`
+	ThumbnailURL string    `json:"thumbnailUrl,omitempty"`
+	IndexedAt    time.Time `json:"indexedAt"`
+}
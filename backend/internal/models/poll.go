@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Poll is a question put to the members of a session
+type Poll struct {
+	ID            string       `json:"id"`
+	SessionID     string       `json:"sessionId"`
+	Question      string       `json:"question"`
+	MultiChoice   bool         `json:"multiChoice"`
+	Anonymous     bool         `json:"anonymous"`
+	EnqueueWinner bool         `json:"enqueueWinner"` // winning option's media is queued on close
+	CreatedBy     string       `json:"createdBy"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	ClosesAt      *time.Time   `json:"closesAt,omitempty"`
+	Closed        bool         `json:"closed"`
+	Options       []PollOption `json:"options"`
+	TotalVotes    int          `json:"totalVotes"` // number of devices that voted
+}
+
+// PollOption is one answer of a poll along with its live tally
+type PollOption struct {
+	ID       string   `json:"id"`
+	PollID   string   `json:"pollId"`
+	Label    string   `json:"label"`
+	FilePath string   `json:"filePath,omitempty"`
+	Votes    int      `json:"votes"`
+	Voters   []string `json:"voters,omitempty"` // omitted for anonymous polls
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// QueueItem represents a media file waiting in a session's playback queue
+type QueueItem struct {
+	ID         string    `json:"id"`
+	SessionID  string    `json:"sessionId"`
+	Title      string    `json:"title"`
+	FilePath   string    `json:"filePath"`
+	ProposedBy string    `json:"proposedBy"`
+	Status     string    `json:"status"` // PROPOSED, APPROVED, PLAYING
+	AddedAt    time.Time `json:"addedAt"`
+}
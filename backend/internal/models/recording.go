@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Recording is something a session host recorded: a stream's HLS output,
+// or one participant's track from the call
+type Recording struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"sessionId"`
+	Kind        string    `json:"kind"` // hls, webm, ogg
+	Title       string    `json:"title"`
+	Participant string    `json:"participant,omitempty"` // SFU peer, for call tracks
+	Path        string    `json:"-"`                     // directory for hls, file name on the SFU otherwise
+	Size        int64     `json:"size"`                  // bytes
+	Duration    float64   `json:"duration"`              // seconds
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	PlaylistURL string    `json:"playlistUrl,omitempty"` // hls only
+	DownloadURL string    `json:"downloadUrl"`
+}
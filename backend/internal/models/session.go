@@ -10,4 +10,5 @@ type Session struct {
 	HostIP    string          `json:"hostIp,omitempty"`
 	HostPort  int             `json:"hostPort,omitempty"`
 	Members   []SessionMember `json:"members,omitempty"`
+	PosterURL string          `json:"posterUrl,omitempty"` // frame of what's playing, relative to the host
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// StreamStatus is the live state of a session's ffmpeg job, built from
+// ffmpeg's -progress output and its error log
+type StreamStatus struct {
+	SessionID string    `json:"sessionId"`
+	State     string    `json:"state"`              // queued, starting, ready, playing, finished, failed, stopped
+	OutTime   float64   `json:"outTime"`            // seconds of media written so far
+	Duration  float64   `json:"duration,omitempty"` // seconds, from the probe; 0 if unknown
+	Progress  float64   `json:"progress,omitempty"` // 0..1 when the duration is known
+	Speed     float64   `json:"speed"`              // multiple of real time, e.g. 4.2
+	FPS       float64   `json:"fps"`
+	Errors    []string  `json:"errors,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Place in the transcode queue while queued (1 is next)
+	QueuePosition int `json:"queuePosition,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// MediaTrack is an alternate audio or subtitle rendition of a stream
+type MediaTrack struct {
+	ID       string `json:"id"`                 // playlist name, e.g. "audio_1", "sub_0"
+	Language string `json:"language,omitempty"` // BCP 47 tag, e.g. "en"
+	Name     string `json:"name"`               // label shown in the player
+	Channels int    `json:"channels,omitempty"` // audio only
+	Default  bool   `json:"default"`            // flagged default in the source file
+	Forced   bool   `json:"forced,omitempty"`   // subtitles for foreign-language parts only
+	Sidecar  bool   `json:"sidecar,omitempty"`  // subtitle uploaded separately from the video
+}
+
+// StreamTracks lists a stream's alternate audio and subtitle tracks and the
+// ones the host picked for everyone
+type StreamTracks struct {
+	SessionID        string       `json:"sessionId"`
+	Audio            []MediaTrack `json:"audio"`                      // empty when the input has a single audio track
+	Subtitles        []MediaTrack `json:"subtitles"`                  // WebVTT
+	SelectedAudio    string       `json:"selectedAudio,omitempty"`    // track ID
+	SelectedSubtitle string       `json:"selectedSubtitle,omitempty"` // track ID; "" means subtitles off
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+)
+
+// auditLogMaxRows bounds the audit table; older rows are pruned as new
+// events arrive.
+const auditLogMaxRows = 5000
+
+// StartAuditLog subscribes to the bus and records every event except
+// stream progress ticks in the audit_log table until ctx is cancelled.
+func StartAuditLog(ctx context.Context, db *sql.DB, bus *events.Bus) {
+	inserted := 0
+	bus.Listen(ctx, func(ev events.Event) {
+		// Progress ticks are transient and would flood the table
+		if ev.Type == events.TypeStreamProgress {
+			return
+		}
+		if err := RecordAuditEvent(db, ev); err != nil {
+			log.Printf("⚠️ [Audit] Failed to record %s: %v", ev.Type, err)
+			return
+		}
+
+		// Prune every so often rather than on each insert
+		inserted++
+		if inserted%100 == 0 {
+			db.Exec("DELETE FROM audit_log WHERE id <= (SELECT MAX(id) - ? FROM audit_log)", auditLogMaxRows)
+		}
+	})
+}
+
+// RecordAuditEvent stores a single event in the audit log
+func RecordAuditEvent(db *sql.DB, ev events.Event) error {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(
+		"INSERT INTO audit_log (type, session_id, data, created_at) VALUES (?, ?, ?, ?)",
+		string(ev.Type), ev.SessionID, string(data), ev.Time,
+	)
+	return err
+}
+
+// ListAuditLog returns the most recent audit entries, newest first.
+// An empty sessionID returns entries for all sessions.
+func ListAuditLog(db *sql.DB, sessionID string, limit int) ([]models.AuditEntry, error) {
+	query := "SELECT id, type, session_id, data, created_at FROM audit_log"
+	args := []interface{}{}
+	if sessionID != "" {
+		query += " WHERE session_id = ?"
+		args = append(args, sessionID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var data string
+		if err := rows.Scan(&e.ID, &e.Type, &e.SessionID, &data, &e.CreatedAt); err != nil {
+			continue
+		}
+		e.Data = json.RawMessage(data)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -2,14 +2,19 @@ package service
 
 import (
 	"database/sql"
+	"log"
 	"time"
 
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
 	"github.com/google/uuid"
 )
 
+// hostLeaveGracePeriod is how long guests keep the session after the host leaves
+const hostLeaveGracePeriod = 10 * time.Second
+
 // JoinSession adds a device as a member of a session (idempotent — won't duplicate)
-func JoinSession(db *sql.DB, sessionID, deviceID, deviceName string) (*models.SessionMember, error) {
+func JoinSession(db *sql.DB, bus *events.Bus, sessionID, deviceID, deviceName string) (*models.SessionMember, error) {
 	// Check if already a member
 	var existingID string
 	err := db.QueryRow(
@@ -45,13 +50,15 @@ func JoinSession(db *sql.DB, sessionID, deviceID, deviceName string) (*models.Se
 		return nil, err
 	}
 
+	bus.Publish(sessionID, events.MemberJoined{Member: *member})
 	return member, nil
 }
 
 // LeaveSession removes a device from a session.
 // If the leaving device is the host, the entire session and all its members are deleted.
+// Guests are told via HostLeft and get hostLeaveGracePeriod before SessionEnded follows.
 // Returns sessionDeleted=true if the session was removed because the host left.
-func LeaveSession(db *sql.DB, sessionID, deviceID string) (sessionDeleted bool, err error) {
+func LeaveSession(db *sql.DB, bus *events.Bus, sessionID, deviceID string) (sessionDeleted bool, err error) {
 	// Check if the leaving device is the host of this session
 	var hostID string
 	err = db.QueryRow("SELECT host_id FROM sessions WHERE id = ?", sessionID).Scan(&hostID)
@@ -60,12 +67,28 @@ func LeaveSession(db *sql.DB, sessionID, deviceID string) (sessionDeleted bool,
 	}
 
 	if deviceID == hostID {
+		// Notify all guests that the host is leaving before tearing down
+		log.Printf("🔔 Host %s leaving session %s — notifying guests", deviceID, sessionID)
+		bus.Publish(sessionID, events.HostLeft{
+			DeviceID:  deviceID,
+			Countdown: int(hostLeaveGracePeriod / time.Second),
+		})
+
 		// Host is leaving — delete the entire session and all members
 		_ = DeleteSessionMembers(db, sessionID)
+		_ = DeleteSessionPolls(db, sessionID)
 		_, err = db.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
 		if err != nil {
 			return false, err
 		}
+		bus.Publish(sessionID, events.MemberLeft{DeviceID: deviceID})
+		bus.Publish(sessionID, events.SessionDeleted{})
+
+		// Give guests time to see the message before the final event
+		time.AfterFunc(hostLeaveGracePeriod, func() {
+			log.Printf("🧹 Cleaning up session %s after host departure", sessionID)
+			bus.Publish(sessionID, events.SessionEnded{})
+		})
 		return true, nil
 	}
 
@@ -82,6 +105,8 @@ func LeaveSession(db *sql.DB, sessionID, deviceID string) (sessionDeleted bool,
 	if rows == 0 {
 		return false, sql.ErrNoRows
 	}
+
+	bus.Publish(sessionID, events.MemberLeft{DeviceID: deviceID})
 	return false, nil
 }
 
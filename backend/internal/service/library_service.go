@@ -0,0 +1,187 @@
+package service
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+)
+
+const libraryColumns = "id, path, root, folder, file_name, title, size, mod_time, duration, container, " +
+	"video_codec, audio_codec, width, height, audio_tracks, subtitles, thumbnail, indexed_at"
+
+// LibraryQuery selects library items. Words in Query must all appear in
+// the title or file name; Root and Folder narrow it to one folder (not
+// its subfolders) of one root. With Under set, only files somewhere
+// inside those folders match.
+type LibraryQuery struct {
+	Query  string
+	Root   string
+	Folder *string // nil: any folder
+	Under  []string
+	Limit  int
+	Offset int
+}
+
+// SaveLibraryItem adds a file to the library, or updates the item
+// already indexed at its path
+func SaveLibraryItem(db *sql.DB, item *models.LibraryItem) error {
+	_, err := db.Exec(
+		"INSERT INTO library_items ("+libraryColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "+
+			"ON CONFLICT(path) DO UPDATE SET root = excluded.root, folder = excluded.folder, file_name = excluded.file_name, "+
+			"title = excluded.title, size = excluded.size, mod_time = excluded.mod_time, duration = excluded.duration, "+
+			"container = excluded.container, video_codec = excluded.video_codec, audio_codec = excluded.audio_codec, "+
+			"width = excluded.width, height = excluded.height, audio_tracks = excluded.audio_tracks, "+
+			"subtitles = excluded.subtitles, thumbnail = excluded.thumbnail, indexed_at = excluded.indexed_at",
+		item.ID, item.Path, item.Root, item.Folder, item.FileName, item.Title, item.Size, item.ModTime, item.Duration,
+		item.Container, item.VideoCodec, item.AudioCodec, item.Width, item.Height, item.AudioTracks, item.Subtitles,
+		item.HasThumbnail, item.IndexedAt,
+	)
+	if err == nil {
+		setLibraryURLs(item)
+	}
+	return err
+}
+
+// GetLibraryItem fetches one library item
+func GetLibraryItem(db *sql.DB, id string) (*models.LibraryItem, error) {
+	return scanLibraryItem(db.QueryRow("SELECT "+libraryColumns+" FROM library_items WHERE id = ?", id))
+}
+
+// SearchLibrary returns a page of matching items sorted by title, and
+// how many match in total
+func SearchLibrary(db *sql.DB, q LibraryQuery) ([]models.LibraryItem, int, error) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	for _, word := range strings.Fields(q.Query) {
+		like := "%" + escapeLike(word) + "%"
+		where = append(where, `(title LIKE ? ESCAPE '\' OR file_name LIKE ? ESCAPE '\')`)
+		args = append(args, like, like)
+	}
+	if q.Root != "" {
+		where = append(where, "root = ?")
+		args = append(args, q.Root)
+	}
+	if q.Folder != nil {
+		where = append(where, "folder = ?")
+		args = append(args, *q.Folder)
+	}
+	if q.Under != nil {
+		under := []string{"0 = 1"}
+		for _, dir := range q.Under {
+			under = append(under, `path LIKE ? ESCAPE '\'`)
+			args = append(args, escapeLike(strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))+"%")
+		}
+		where = append(where, "("+strings.Join(under, " OR ")+")")
+	}
+	cond := " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM library_items"+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query("SELECT "+libraryColumns+" FROM library_items"+cond+
+		" ORDER BY title COLLATE NOCASE, path LIMIT ? OFFSET ?", append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []models.LibraryItem{}
+	for rows.Next() {
+		item, err := scanLibraryItem(rows)
+		if err != nil {
+			continue
+		}
+		items = append(items, *item)
+	}
+	return items, total, nil
+}
+
+// LibrarySubfolders returns the names of the folders directly inside a
+// folder of a root that hold indexed files somewhere below them
+func LibrarySubfolders(db *sql.DB, root, folder string) ([]string, error) {
+	prefix := ""
+	if folder != "" {
+		prefix = folder + "/"
+	}
+	rows, err := db.Query(`SELECT DISTINCT folder FROM library_items WHERE root = ? AND folder LIKE ? ESCAPE '\'`,
+		root, escapeLike(prefix)+"_%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[string]bool{}
+	subfolders := []string{}
+	for rows.Next() {
+		var f string
+		if rows.Scan(&f) != nil {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(f, prefix), "/")
+		if !seen[name] {
+			seen[name] = true
+			subfolders = append(subfolders, name)
+		}
+	}
+	sort.Slice(subfolders, func(i, j int) bool {
+		return strings.ToLower(subfolders[i]) < strings.ToLower(subfolders[j])
+	})
+	return subfolders, nil
+}
+
+// LibraryItemsByPath returns every indexed item keyed by its path, for
+// the scanner to compare against the disk
+func LibraryItemsByPath(db *sql.DB) (map[string]*models.LibraryItem, error) {
+	rows, err := db.Query("SELECT " + libraryColumns + " FROM library_items")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[string]*models.LibraryItem)
+	for rows.Next() {
+		item, err := scanLibraryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items[item.Path] = item
+	}
+	return items, rows.Err()
+}
+
+// DeleteLibraryItem removes an item from the library; its thumbnail is
+// the caller's to remove
+func DeleteLibraryItem(db *sql.DB, id string) error {
+	_, err := db.Exec("DELETE FROM library_items WHERE id = ?", id)
+	return err
+}
+
+func scanLibraryItem(row interface{ Scan(...any) error }) (*models.LibraryItem, error) {
+	var item models.LibraryItem
+	err := row.Scan(&item.ID, &item.Path, &item.Root, &item.Folder, &item.FileName, &item.Title, &item.Size,
+		&item.ModTime, &item.Duration, &item.Container, &item.VideoCodec, &item.AudioCodec, &item.Width,
+		&item.Height, &item.AudioTracks, &item.Subtitles, &item.HasThumbnail, &item.IndexedAt)
+	if err != nil {
+		return nil, err
+	}
+	setLibraryURLs(&item)
+	return &item, nil
+}
+
+// setLibraryURLs fills in where clients fetch an item's thumbnail
+func setLibraryURLs(item *models.LibraryItem) {
+	item.ThumbnailURL = ""
+	if item.HasThumbnail {
+		item.ThumbnailURL = "/library/" + item.ID + "/thumbnail.jpg"
+	}
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
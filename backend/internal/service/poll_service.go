@@ -0,0 +1,303 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPollClosed    = errors.New("poll is closed")
+	ErrInvalidOption = errors.New("option does not belong to this poll")
+	ErrTooManyVotes  = errors.New("poll allows a single choice only")
+)
+
+// CreatePoll stores a new poll and its options. IDs, timestamps and option
+// positions are assigned here; the caller fills in the question and options.
+func CreatePoll(db *sql.DB, bus *events.Bus, poll *models.Poll) (*models.Poll, error) {
+	if len(poll.Options) < 2 {
+		return nil, errors.New("a poll needs at least two options")
+	}
+
+	poll.ID = uuid.New().String()
+	poll.CreatedAt = time.Now()
+	poll.Closed = false
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var closesAt interface{}
+	if poll.ClosesAt != nil {
+		closesAt = *poll.ClosesAt
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO polls (id, session_id, question, multi_choice, anonymous, enqueue_winner, created_by, created_at, closes_at, closed) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0)",
+		poll.ID, poll.SessionID, poll.Question, poll.MultiChoice, poll.Anonymous, poll.EnqueueWinner, poll.CreatedBy, poll.CreatedAt, closesAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range poll.Options {
+		opt := &poll.Options[i]
+		opt.ID = uuid.New().String()
+		opt.PollID = poll.ID
+		opt.Votes = 0
+		opt.Voters = nil
+
+		_, err = tx.Exec(
+			"INSERT INTO poll_options (id, poll_id, position, label, file_path) VALUES (?, ?, ?, ?, ?)",
+			opt.ID, opt.PollID, i, opt.Label, opt.FilePath,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	bus.Publish(poll.SessionID, events.PollUpdated{Poll: *poll})
+	return poll, nil
+}
+
+// CastVote records a device's choice, replacing any earlier vote it cast
+// on the same poll. Single-choice polls accept exactly one option.
+func CastVote(db *sql.DB, bus *events.Bus, pollID, deviceID string, optionIDs []string) error {
+	poll, err := GetPoll(db, pollID)
+	if err != nil {
+		return err
+	}
+	if poll.Closed {
+		return ErrPollClosed
+	}
+	if !poll.MultiChoice && len(optionIDs) > 1 {
+		return ErrTooManyVotes
+	}
+
+	valid := make(map[string]bool, len(poll.Options))
+	for _, opt := range poll.Options {
+		valid[opt.ID] = true
+	}
+	for _, id := range optionIDs {
+		if !valid[id] {
+			return ErrInvalidOption
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM poll_votes WHERE poll_id = ? AND device_id = ?", pollID, deviceID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, id := range optionIDs {
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO poll_votes (poll_id, option_id, device_id, voted_at) VALUES (?, ?, ?, ?)",
+			pollID, id, deviceID, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if updated, err := GetPoll(db, pollID); err == nil {
+		bus.Publish(updated.SessionID, events.PollUpdated{Poll: *updated})
+	}
+	return nil
+}
+
+// ClosePoll marks a poll as closed and returns its final tally.
+func ClosePoll(db *sql.DB, bus *events.Bus, pollID string) (*models.Poll, error) {
+	result, err := db.Exec("UPDATE polls SET closed = 1 WHERE id = ? AND closed = 0", pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		// Either unknown or already closed — let GetPoll tell them apart
+		poll, err := GetPoll(db, pollID)
+		if err != nil {
+			return nil, err
+		}
+		if poll.Closed {
+			return nil, ErrPollClosed
+		}
+	}
+
+	poll, err := GetPoll(db, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	bus.Publish(poll.SessionID, events.PollClosed{Poll: *poll, Winner: PollWinner(poll)})
+	return poll, nil
+}
+
+// OpenTimedPolls returns the close times of the polls that close on a
+// timer and haven't been closed yet, by poll ID
+func OpenTimedPolls(db *sql.DB) (map[string]time.Time, error) {
+	rows, err := db.Query("SELECT id, closes_at FROM polls WHERE closed = 0 AND closes_at IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	polls := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var closesAt time.Time
+		if rows.Scan(&id, &closesAt) == nil {
+			polls[id] = closesAt
+		}
+	}
+	return polls, rows.Err()
+}
+
+// GetPoll fetches a poll with its options and live tallies. Polls whose
+// close time has passed are reported as closed even before ClosePoll runs.
+func GetPoll(db *sql.DB, pollID string) (*models.Poll, error) {
+	var p models.Poll
+	var closesAt sql.NullTime
+	err := db.QueryRow(
+		"SELECT id, session_id, question, multi_choice, anonymous, enqueue_winner, created_by, created_at, closes_at, closed FROM polls WHERE id = ?",
+		pollID,
+	).Scan(&p.ID, &p.SessionID, &p.Question, &p.MultiChoice, &p.Anonymous, &p.EnqueueWinner, &p.CreatedBy, &p.CreatedAt, &closesAt, &p.Closed)
+	if err != nil {
+		return nil, err
+	}
+
+	if closesAt.Valid {
+		p.ClosesAt = &closesAt.Time
+		if time.Now().After(closesAt.Time) {
+			p.Closed = true
+		}
+	}
+
+	if err := loadPollOptions(db, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPolls returns all polls of a session, newest first
+func ListPolls(db *sql.DB, sessionID string) ([]models.Poll, error) {
+	rows, err := db.Query("SELECT id FROM polls WHERE session_id = ? ORDER BY created_at DESC", sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	polls := make([]models.Poll, 0, len(ids))
+	for _, id := range ids {
+		poll, err := GetPoll(db, id)
+		if err != nil {
+			continue
+		}
+		polls = append(polls, *poll)
+	}
+	return polls, nil
+}
+
+// PollWinner returns the option with the most votes, breaking ties by
+// option order. Returns nil if nobody voted.
+func PollWinner(poll *models.Poll) *models.PollOption {
+	var winner *models.PollOption
+	for i := range poll.Options {
+		opt := &poll.Options[i]
+		if opt.Votes > 0 && (winner == nil || opt.Votes > winner.Votes) {
+			winner = opt
+		}
+	}
+	return winner
+}
+
+// DeleteSessionPolls removes all polls, options and votes of a session
+func DeleteSessionPolls(db *sql.DB, sessionID string) error {
+	_, err := db.Exec("DELETE FROM poll_votes WHERE poll_id IN (SELECT id FROM polls WHERE session_id = ?)", sessionID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM poll_options WHERE poll_id IN (SELECT id FROM polls WHERE session_id = ?)", sessionID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM polls WHERE session_id = ?", sessionID)
+	return err
+}
+
+// loadPollOptions fills in the options of a poll with their vote counts,
+// and the voter IDs unless the poll is anonymous.
+func loadPollOptions(db *sql.DB, p *models.Poll) error {
+	rows, err := db.Query(
+		"SELECT id, poll_id, label, file_path FROM poll_options WHERE poll_id = ? ORDER BY position",
+		p.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	p.Options = []models.PollOption{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var opt models.PollOption
+		if err := rows.Scan(&opt.ID, &opt.PollID, &opt.Label, &opt.FilePath); err != nil {
+			continue
+		}
+		index[opt.ID] = len(p.Options)
+		p.Options = append(p.Options, opt)
+	}
+	rows.Close()
+
+	votes, err := db.Query("SELECT option_id, device_id FROM poll_votes WHERE poll_id = ? ORDER BY voted_at", p.ID)
+	if err != nil {
+		return err
+	}
+	defer votes.Close()
+
+	voters := make(map[string]bool)
+	for votes.Next() {
+		var optionID, deviceID string
+		if err := votes.Scan(&optionID, &deviceID); err != nil {
+			continue
+		}
+		i, ok := index[optionID]
+		if !ok {
+			continue
+		}
+		p.Options[i].Votes++
+		if !p.Anonymous {
+			p.Options[i].Voters = append(p.Options[i].Voters, deviceID)
+		}
+		voters[deviceID] = true
+	}
+	p.TotalVotes = len(voters)
+	return nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"database/sql"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+)
+
+const recordingColumns = "id, session_id, kind, title, participant, path, size, duration, created_by, created_at"
+
+// SaveRecording adds a recording to the index and announces it
+func SaveRecording(db *sql.DB, bus *events.Bus, rec *models.Recording) error {
+	_, err := db.Exec(
+		"INSERT INTO recordings ("+recordingColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		rec.ID, rec.SessionID, rec.Kind, rec.Title, rec.Participant, rec.Path, rec.Size, rec.Duration, rec.CreatedBy, rec.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	setRecordingURLs(rec)
+	bus.Publish(rec.SessionID, events.RecordingSaved{Recording: *rec})
+	return nil
+}
+
+// GetRecording fetches one recording from the index
+func GetRecording(db *sql.DB, id string) (*models.Recording, error) {
+	rec, err := scanRecording(db.QueryRow("SELECT "+recordingColumns+" FROM recordings WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// ListRecordings returns recordings, newest first. An empty sessionID
+// returns the recordings of all sessions.
+func ListRecordings(db *sql.DB, sessionID string) ([]models.Recording, error) {
+	query := "SELECT " + recordingColumns + " FROM recordings"
+	args := []interface{}{}
+	if sessionID != "" {
+		query += " WHERE session_id = ?"
+		args = append(args, sessionID)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordings := []models.Recording{}
+	for rows.Next() {
+		rec, err := scanRecording(rows)
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, *rec)
+	}
+	return recordings, nil
+}
+
+// DeleteRecording removes a recording from the index; its files are the
+// caller's to remove
+func DeleteRecording(db *sql.DB, id string) error {
+	_, err := db.Exec("DELETE FROM recordings WHERE id = ?", id)
+	return err
+}
+
+func scanRecording(row interface{ Scan(...any) error }) (*models.Recording, error) {
+	var rec models.Recording
+	err := row.Scan(&rec.ID, &rec.SessionID, &rec.Kind, &rec.Title, &rec.Participant, &rec.Path,
+		&rec.Size, &rec.Duration, &rec.CreatedBy, &rec.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	setRecordingURLs(&rec)
+	return &rec, nil
+}
+
+// setRecordingURLs fills in where clients play and download a recording
+func setRecordingURLs(rec *models.Recording) {
+	rec.DownloadURL = "/recordings/" + rec.ID + "/download"
+	if rec.Kind == "hls" {
+		rec.PlaylistURL = "/recordings/" + rec.ID + "/master.m3u8"
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
 	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
 	"github.com/google/uuid"
 )
@@ -29,6 +30,7 @@ func CleanupStaleSessions(db *sql.DB, currentDeviceID string) {
 
 	for _, id := range staleIDs {
 		_ = DeleteSessionMembers(db, id)
+		_ = DeleteSessionPolls(db, id)
 		db.Exec("DELETE FROM sessions WHERE id = ?", id)
 	}
 
@@ -37,7 +39,7 @@ func CleanupStaleSessions(db *sql.DB, currentDeviceID string) {
 	}
 }
 
-func CreateSession(db *sql.DB, name, hostID string) (*models.Session, error) {
+func CreateSession(db *sql.DB, bus *events.Bus, name, hostID string) (*models.Session, error) {
 	session := &models.Session{
 		ID:        uuid.New().String(),
 		Name:      name,
@@ -53,8 +55,10 @@ func CreateSession(db *sql.DB, name, hostID string) (*models.Session, error) {
 		return nil, err
 	}
 
+	bus.Publish(session.ID, events.SessionCreated{Session: *session})
+
 	// Auto-add the host as the first member of the session
-	_, _ = JoinSession(db, session.ID, hostID, "Host")
+	_, _ = JoinSession(db, bus, session.ID, hostID, "Host")
 
 	return session, nil
 }
@@ -75,7 +79,7 @@ func ListSessions(db *sql.DB, hostID string) ([]models.Session, error) {
 	return sessions, nil
 }
 
-func DeleteSession(db *sql.DB, sessionID, hostID string) error {
+func DeleteSession(db *sql.DB, bus *events.Bus, sessionID, hostID string) error {
 	// Verify the session belongs to this host before deleting
 	var existingHostID string
 	err := db.QueryRow("SELECT host_id FROM sessions WHERE id = ?", sessionID).Scan(&existingHostID)
@@ -89,9 +93,15 @@ func DeleteSession(db *sql.DB, sessionID, hostID string) error {
 
 	// Cascade: delete all members of this session first
 	_ = DeleteSessionMembers(db, sessionID)
+	_ = DeleteSessionPolls(db, sessionID)
 
 	_, err = db.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
-	return err
+	if err != nil {
+		return err
+	}
+
+	bus.Publish(sessionID, events.SessionDeleted{})
+	return nil
 }
 
 // IsHost returns true if the given deviceID is the host of the session.
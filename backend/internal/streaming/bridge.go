@@ -0,0 +1,326 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// bridgeSDPName is the session description ffmpeg reads the SFU's RTP
+	// with, next to the stream's playlists.
+	bridgeSDPName = "bridge.sdp"
+	// bridgeCheckInterval is how often a bridged stream asks the SFU
+	// whether its publisher is still there.
+	bridgeCheckInterval = 2 * time.Second
+)
+
+// sfuClient talks to the videoCall SFU.
+var sfuClient = &http.Client{Timeout: 5 * time.Second}
+
+// sfuAPI is a videoCall SFU's HTTP API. Its bridge and recording endpoints
+// hand media to whoever asks, so the SFU only serves them to requests
+// carrying the token it shares with this node (SFU_TOKEN).
+type sfuAPI struct {
+	url   string
+	token string
+}
+
+// request builds a request to the SFU, authenticated with the token.
+func (api sfuAPI) request(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, api.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if api.token != "" {
+		req.Header.Set("Authorization", "Bearer "+api.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do sends a request built without a context; see request.
+func (api sfuAPI) do(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := api.request(context.Background(), method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	return sfuClient.Do(req)
+}
+
+// BridgeSource is a publisher in a videoCall SFU room.
+type BridgeSource struct {
+	Room      string `json:"room"`
+	Publisher string `json:"publisher"`
+}
+
+// SFUPublisher is a peer sending media in an SFU room, as the SFU lists it.
+type SFUPublisher struct {
+	ID     string     `json:"id"`
+	Tracks []sfuTrack `json:"tracks"`
+}
+
+// sfuTrack is a track the SFU forwards: the RTP payload format ffmpeg
+// needs in its SDP.
+type sfuTrack struct {
+	Kind        string `json:"kind"`
+	MimeType    string `json:"mimeType"`
+	ClockRate   uint32 `json:"clockRate"`
+	Channels    uint16 `json:"channels,omitempty"`
+	PayloadType uint8  `json:"payloadType"`
+	Fmtp        string `json:"fmtp,omitempty"`
+}
+
+// sfuBridge is a running bridge in the SFU.
+type sfuBridge struct {
+	ID     string     `json:"id"`
+	Tracks []sfuTrack `json:"tracks"`
+
+	api sfuAPI
+}
+
+// SetSFU points bridges at a videoCall SFU, e.g. "http://localhost:8081",
+// and sets the token it was started with (its SFU_TOKEN).
+func (sm *StreamManager) SetSFU(sfuURL, token string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.sfuAPI = sfuAPI{url: strings.TrimRight(sfuURL, "/"), token: token}
+}
+
+func (sm *StreamManager) sfu() (sfuAPI, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if sm.sfuAPI.url == "" {
+		return sfuAPI{}, fmt.Errorf("no SFU configured (SFU_URL)")
+	}
+	return sm.sfuAPI, nil
+}
+
+// SFUPublishers lists who is sending media in an SFU room, for the host to
+// pick a presenter from.
+func (sm *StreamManager) SFUPublishers(room string) ([]SFUPublisher, error) {
+	api, err := sm.sfu()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := api.do(http.MethodGet, "/publishers?room="+url.QueryEscape(room), nil)
+	if err != nil {
+		return nil, fmt.Errorf("SFU unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		return nil, fmt.Errorf("SFU refused: %s", strings.TrimSpace(msg.String()))
+	}
+	var publishers []SFUPublisher
+	if err := json.NewDecoder(resp.Body).Decode(&publishers); err != nil {
+		return nil, fmt.Errorf("bad SFU response: %w", err)
+	}
+	return publishers, nil
+}
+
+// StartBridge streams an SFU publisher as Low-Latency HLS, so one presenter
+// on WebRTC reaches viewers who aren't in the call. The SFU copies the
+// publisher's RTP to two local UDP ports, where ffmpeg picks it up through
+// an SDP file and transcodes it (WebRTC sends VP8/Opus, or H.264 with
+// irregular keyframes). The stream finishes when the publisher leaves.
+func (sm *StreamManager) StartBridge(sessionID string, src BridgeSource) (string, error) {
+	if src.Room == "" || src.Publisher == "" {
+		return "", fmt.Errorf("bridge needs a room and a publisher")
+	}
+	api, err := sm.sfu()
+	if err != nil {
+		return "", err
+	}
+	if sm.IsStreaming(sessionID) {
+		return "", fmt.Errorf("session is already streaming; stop it first")
+	}
+
+	videoPort, err := freeRTPPort(0)
+	if err != nil {
+		return "", fmt.Errorf("no port for the bridge: %w", err)
+	}
+	audioPort, err := freeRTPPort(videoPort)
+	if err != nil {
+		return "", fmt.Errorf("no port for the bridge: %w", err)
+	}
+	bridge, err := openSFUBridge(api, src, videoPort, audioPort)
+	if err != nil {
+		return "", err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if existing, exists := sm.streams[sessionID]; exists {
+		if isLive(existing.status.State) {
+			go bridge.close()
+			return "", fmt.Errorf("session is already streaming; stop it first")
+		}
+		sm.release(sessionID, existing)
+	}
+
+	outputDir := filepath.Join(hlsRoot, sessionID)
+	sdpPath := filepath.Join(outputDir, bridgeSDPName)
+	if err := os.MkdirAll(outputDir, 0755); err == nil {
+		err = os.WriteFile(sdpPath, bridge.sdp(videoPort, audioPort), 0644)
+	}
+	if err != nil {
+		go bridge.close()
+		return "", fmt.Errorf("failed to write SDP: %w", err)
+	}
+
+	plan := transcodePlan{
+		VideoMap:     "0:v:0?",
+		AudioMap:     "0:a:0?",
+		Input:        sdpPath,
+		InputOptions: []string{"-protocol_whitelist", "file,udp,rtp"},
+		LowLatency:   true,
+	}
+	info, err := sm.startLowLatency(sessionID, plan)
+	if err != nil {
+		go bridge.close()
+		return "", err
+	}
+	info.bridge = bridge
+	go sm.watchBridge(sessionID, info, bridge)
+
+	log.Printf("🌉 [Stream] Bridging SFU publisher %s (room %s) to session %s (LL-HLS)", src.Publisher, src.Room, sessionID)
+	return PlaylistURL(sessionID), nil
+}
+
+// openSFUBridge asks the SFU to send a publisher's RTP to our ports.
+func openSFUBridge(api sfuAPI, src BridgeSource, videoPort, audioPort int) (*sfuBridge, error) {
+	body, _ := json.Marshal(map[string]any{
+		"room":      src.Room,
+		"publisher": src.Publisher,
+		"videoPort": videoPort,
+		"audioPort": audioPort,
+	})
+	resp, err := api.do(http.MethodPost, "/bridge", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("SFU unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		return nil, fmt.Errorf("SFU refused the bridge: %s", strings.TrimSpace(msg.String()))
+	}
+	bridge := &sfuBridge{api: api}
+	if err := json.NewDecoder(resp.Body).Decode(bridge); err != nil {
+		return nil, fmt.Errorf("bad SFU response: %w", err)
+	}
+	return bridge, nil
+}
+
+// sdp describes the bridged RTP streams for ffmpeg's SDP demuxer.
+func (b *sfuBridge) sdp(videoPort, audioPort int) []byte {
+	var s strings.Builder
+	s.WriteString("v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=0Xnet bridge\r\nc=IN IP4 127.0.0.1\r\nt=0 0\r\n")
+	for _, t := range b.Tracks {
+		port := audioPort
+		if t.Kind == "video" {
+			port = videoPort
+		}
+		_, encoding, _ := strings.Cut(t.MimeType, "/") // "video/VP8" → "VP8"
+		fmt.Fprintf(&s, "m=%s %d RTP/AVP %d\r\n", t.Kind, port, t.PayloadType)
+		fmt.Fprintf(&s, "a=rtpmap:%d %s/%d", t.PayloadType, encoding, t.ClockRate)
+		if t.Channels > 0 {
+			fmt.Fprintf(&s, "/%d", t.Channels)
+		}
+		s.WriteString("\r\n")
+		if t.Fmtp != "" {
+			fmt.Fprintf(&s, "a=fmtp:%d %s\r\n", t.PayloadType, t.Fmtp)
+		}
+	}
+	return []byte(s.String())
+}
+
+// alive reports whether the SFU still runs the bridge; false once the
+// publisher has left. Network errors count as alive.
+func (b *sfuBridge) alive() bool {
+	resp, err := b.api.do(http.MethodGet, "/bridge/"+b.ID, nil)
+	if err != nil {
+		return true
+	}
+	resp.Body.Close()
+	return resp.StatusCode != http.StatusNotFound
+}
+
+// close tells the SFU to stop forwarding.
+func (b *sfuBridge) close() {
+	if resp, err := b.api.do(http.MethodDelete, "/bridge/"+b.ID, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// watchBridge ends a bridged stream once its publisher leaves the call.
+// RTP just stops arriving then, which ffmpeg would wait on forever; an
+// interrupt makes it finish the playlists instead.
+func (sm *StreamManager) watchBridge(sessionID string, info *streamInfo, bridge *sfuBridge) {
+	ticker := time.NewTicker(bridgeCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sm.mu.RLock()
+		current := sm.streams[sessionID] == info && isLive(info.status.State)
+		sm.mu.RUnlock()
+		if !current {
+			return
+		}
+		if bridge.alive() {
+			continue
+		}
+
+		sm.mu.Lock()
+		if sm.streams[sessionID] == info && isLive(info.status.State) {
+			log.Printf("🌉 [Stream] Bridged publisher left, finishing session %s", sessionID)
+			info.interrupted = true
+			info.run.Interrupt()
+		}
+		sm.mu.Unlock()
+		return
+	}
+}
+
+// freeRTPPort finds an even UDP port, other than not, whose successor
+// (ffmpeg's RTCP port) is free too.
+func freeRTPPort(not int) (int, error) {
+	for range 20 {
+		conn, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		port := conn.LocalAddr().(*net.UDPAddr).Port &^ 1
+		conn.Close()
+		if port == not {
+			continue
+		}
+		free := true
+		for _, p := range []int{port, port + 1} {
+			c, err := net.ListenPacket("udp", fmt.Sprintf(":%d", p))
+			if err != nil {
+				free = false
+				break
+			}
+			c.Close()
+		}
+		if free {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free UDP port pair")
+}
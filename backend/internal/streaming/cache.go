@@ -0,0 +1,357 @@
+package streaming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheFormatVersion is part of every cache key; bump it when the HLS
+	// output layout or encoder settings change so stale entries are ignored.
+	cacheFormatVersion = "hls-ts-v3"
+	// cacheMetaName is the metadata file inside each cache entry.
+	cacheMetaName = "cache.json"
+	// hashMemoLimit bounds the remembered hashes of files that aren't
+	// cached (yet); those of cache entries are always kept.
+	hashMemoLimit = 1024
+)
+
+// DefaultCacheDir is where finished transcodes are kept between streams.
+var DefaultCacheDir = filepath.Join(os.TempDir(), "0xnet-cache")
+
+// TranscodeCache keeps finished HLS output keyed by input content and
+// encoding profile, so streaming the same movie again is instant. It is
+// bounded by total size; the least recently used entries are evicted
+// first, and entries being served are never evicted.
+//
+// The content is a SHA-256 of the whole file. Reading a multi-GB movie
+// takes a while, so hashes are remembered per path, size and modification
+// time (including across restarts, for the inputs of cache entries), and
+// Lookup never waits for one.
+type TranscodeCache struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	entries  map[string]*cacheEntry   // key → entry
+	hashes   map[string]string        // path|size|mtime → content hash
+	hashing  map[string]chan struct{} // path|size|mtime → closed once hashed
+}
+
+type cacheEntry struct {
+	Key      string    `json:"key"`
+	Source   string    `json:"source"` // original file name, for humans
+	Input    string    `json:"input"`  // path|size|mtime of the input, if still known
+	Hash     string    `json:"hash"`   // its content hash
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed"`
+	refs     int       // streams currently serving this entry
+}
+
+// NewTranscodeCache opens (or creates) a cache directory and loads the
+// entries a previous run left behind.
+func NewTranscodeCache(dir string, maxBytes int64) (*TranscodeCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+
+	c := &TranscodeCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*cacheEntry),
+		hashes:   make(map[string]string),
+		hashing:  make(map[string]chan struct{}),
+	}
+
+	dirs, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		path := filepath.Join(dir, d.Name())
+		data, err := os.ReadFile(filepath.Join(path, cacheMetaName))
+		var entry cacheEntry
+		if err != nil || json.Unmarshal(data, &entry) != nil || entry.Key != d.Name() || entry.Hash == "" {
+			// Half-written, foreign or from before full-content keys
+			os.RemoveAll(path)
+			continue
+		}
+		c.entries[entry.Key] = &entry
+		if entry.Input != "" {
+			c.hashes[entry.Input] = entry.Hash
+		}
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	log.Printf("🗄️ [Cache] %d cached transcodes (%d MB) in %s", len(c.entries), c.totalSize()/(1024*1024), dir)
+	return c, nil
+}
+
+// Key returns the cache key for an input file encoded with a profile,
+// hashing the file unless its hash is remembered.
+func (c *TranscodeCache) Key(filePath, profile string) (string, error) {
+	hash, err := c.contentHash(filePath)
+	if err != nil {
+		return "", err
+	}
+	return cacheKey(profile, hash), nil
+}
+
+// Lookup returns the cache key for an input file encoded with a profile if
+// its hash is already known, without reading the file. Otherwise it
+// returns "" and hashes the file in the background, so Key is quick once
+// the stream is done.
+func (c *TranscodeCache) Lookup(filePath, profile string) string {
+	memo, err := hashMemo(filePath)
+	if err != nil {
+		return ""
+	}
+	c.mu.Lock()
+	hash, ok := c.hashes[memo]
+	c.mu.Unlock()
+	if !ok {
+		go func() {
+			if _, err := c.contentHash(filePath); err != nil {
+				log.Printf("⚠️ [Cache] Failed to hash %s: %v", filepath.Base(filePath), err)
+			}
+		}()
+		return ""
+	}
+	return cacheKey(profile, hash)
+}
+
+func cacheKey(profile, hash string) string {
+	sum := sha256.Sum256([]byte(cacheFormatVersion + "|" + profile + "|" + hash))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Acquire returns the directory of a cached transcode and pins it until
+// Release is called.
+func (c *TranscodeCache) Acquire(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry.refs++
+	entry.LastUsed = time.Now()
+	c.writeMeta(entry)
+	return filepath.Join(c.dir, key), true
+}
+
+// Release unpins an entry obtained from Acquire or Put.
+func (c *TranscodeCache) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok && entry.refs > 0 {
+		entry.refs--
+	}
+	c.evict()
+}
+
+// Put moves a finished output directory into the cache and returns its new
+// location, pinned like Acquire. key must come from Key or Lookup for
+// filePath, the input. If the key is already cached (another session
+// transcoded the same file meanwhile) or the output is too big for the
+// cache, an error is returned and srcDir is left alone.
+func (c *TranscodeCache) Put(key, srcDir, filePath string) (string, error) {
+	size, err := dirSize(srcDir)
+	if err != nil {
+		return "", err
+	}
+	if size > c.maxBytes {
+		return "", fmt.Errorf("output (%d MB) is larger than the cache", size/(1024*1024))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; exists {
+		return "", fmt.Errorf("already cached")
+	}
+
+	dst := filepath.Join(c.dir, key)
+	if err := os.Rename(srcDir, dst); err != nil {
+		return "", fmt.Errorf("failed to move output into cache: %w", err)
+	}
+
+	now := time.Now()
+	entry := &cacheEntry{
+		Key:      key,
+		Source:   filepath.Base(filePath),
+		Size:     size,
+		Created:  now,
+		LastUsed: now,
+		refs:     1,
+	}
+	// Remember which input this was, so a restart can still look it up
+	if memo, err := hashMemo(filePath); err == nil && c.hashes[memo] != "" {
+		entry.Input, entry.Hash = memo, c.hashes[memo]
+	}
+	c.entries[key] = entry
+	c.writeMeta(entry)
+	c.evict()
+
+	log.Printf("🗄️ [Cache] Stored %s (%d MB)", entry.Source, size/(1024*1024))
+	return dst, nil
+}
+
+// evict removes least recently used, unpinned entries until the cache fits
+// its size budget. The caller must hold c.mu.
+func (c *TranscodeCache) evict() {
+	total := c.totalSize()
+	if total <= c.maxBytes {
+		return
+	}
+
+	lru := make([]*cacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		lru = append(lru, e)
+	}
+	sort.Slice(lru, func(i, j int) bool { return lru[i].LastUsed.Before(lru[j].LastUsed) })
+
+	for _, e := range lru {
+		if total <= c.maxBytes {
+			break
+		}
+		if e.refs > 0 {
+			continue
+		}
+		os.RemoveAll(filepath.Join(c.dir, e.Key))
+		delete(c.entries, e.Key)
+		delete(c.hashes, e.Input)
+		total -= e.Size
+		log.Printf("🗄️ [Cache] Evicted %s (%d MB)", e.Source, e.Size/(1024*1024))
+	}
+}
+
+func (c *TranscodeCache) totalSize() int64 {
+	var total int64
+	for _, e := range c.entries {
+		total += e.Size
+	}
+	return total
+}
+
+func (c *TranscodeCache) writeMeta(entry *cacheEntry) {
+	data, _ := json.Marshal(entry)
+	os.WriteFile(filepath.Join(c.dir, entry.Key, cacheMetaName), data, 0644)
+}
+
+// contentHash returns the SHA-256 of a file's content, remembered per
+// path, size and modification time. Concurrent calls for the same file
+// share one read.
+func (c *TranscodeCache) contentHash(filePath string) (string, error) {
+	memo, err := hashMemo(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	for {
+		if hash, ok := c.hashes[memo]; ok {
+			c.mu.Unlock()
+			return hash, nil
+		}
+		busy, ok := c.hashing[memo]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		<-busy
+		c.mu.Lock()
+	}
+	done := make(chan struct{})
+	c.hashing[memo] = done
+	c.mu.Unlock()
+
+	hash, err := hashFile(filePath)
+
+	c.mu.Lock()
+	delete(c.hashing, memo)
+	if err == nil {
+		c.rememberHash(memo, hash)
+	}
+	close(done)
+	c.mu.Unlock()
+	return hash, err
+}
+
+// rememberHash records a file's hash, first forgetting those of files that
+// aren't cached if there are too many. The caller must hold c.mu.
+func (c *TranscodeCache) rememberHash(memo, hash string) {
+	if len(c.hashes) >= hashMemoLimit+len(c.entries) {
+		kept := make(map[string]string, len(c.entries)+1)
+		for _, e := range c.entries {
+			if e.Input != "" {
+				kept[e.Input] = e.Hash
+			}
+		}
+		c.hashes = kept
+	}
+	c.hashes[memo] = hash
+}
+
+// hashMemo identifies a version of a file by path, size and modification time.
+func hashMemo(filePath string) (string, error) {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s|%d|%d", filePath, fi.Size(), fi.ModTime().UnixNano()), nil
+}
+
+func hashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheProfile describes the encoding settings that shape the output, so
+// a different ladder or format never serves another one's cached files.
+func cacheProfile(renditions []Rendition, format OutputFormat) string {
+	names := make([]string, len(renditions))
+	for i, r := range renditions {
+		names[i] = r.Name
+	}
+	return strings.Join(names, ",") + "|" + format.profile()
+}
+
+// dirSize returns the total size of the files under a directory.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,74 @@
+package streaming
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheKeysTheWholeContent(t *testing.T) {
+	cache, err := NewTranscodeCache(t.TempDir(), 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size, same start, middle and end; one byte apart in between
+	media := t.TempDir()
+	content := make([]byte, 8<<20)
+	a := filepath.Join(media, "a.mkv")
+	b := filepath.Join(media, "b.mkv")
+	os.WriteFile(a, content, 0644)
+	content[1<<20+1] = 1
+	os.WriteFile(b, content, 0644)
+
+	keyA, errA := cache.Key(a, "source")
+	keyB, errB := cache.Key(b, "source")
+	if errA != nil || errB != nil {
+		t.Fatal(errA, errB)
+	}
+	if keyA == keyB {
+		t.Error("files that differ in one byte got the same key")
+	}
+	if key, _ := cache.Key(a, "720p"); key == keyA {
+		t.Error("another profile got the same key")
+	}
+}
+
+func TestCacheLookupSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewTranscodeCache(dir, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(t.TempDir(), "movie.mkv")
+	os.WriteFile(input, []byte("a movie"), 0644)
+
+	if key := cache.Lookup(input, "source"); key != "" {
+		t.Errorf("Lookup of a file never hashed = %q, want it to hash in the background", key)
+	}
+	key, err := cache.Key(input, "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cache.Lookup(input, "source"); got != key {
+		t.Errorf("Lookup once hashed = %q, want %q", got, key)
+	}
+
+	output := t.TempDir()
+	os.WriteFile(filepath.Join(output, MasterPlaylistName), []byte("#EXTM3U\n"), 0644)
+	if _, err := cache.Put(key, output, input); err != nil {
+		t.Fatal(err)
+	}
+	cache.Release(key)
+
+	reopened, err := NewTranscodeCache(dir, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Lookup(input, "source"); got != key {
+		t.Errorf("Lookup after a restart = %q, want %q", got, key)
+	}
+	if _, ok := reopened.Acquire(key); !ok {
+		t.Error("the entry is gone after a restart")
+	}
+}
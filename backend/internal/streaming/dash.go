@@ -0,0 +1,260 @@
+package streaming
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dashTimescale is the SegmentTimeline unit: milliseconds, as precise as
+// the EXTINF durations it is built from.
+const dashTimescale = 1000
+
+// segmentNumber extracts the number from a segment file name.
+var segmentNumber = regexp.MustCompile(`seg_(\d+)\.`)
+
+// mediaPlaylist is what the DASH manifest needs from a variant playlist.
+type mediaPlaylist struct {
+	Init      string    // fMP4 init segment (EXT-X-MAP)
+	First     int       // number of the first segment
+	Durations []float64 // seconds, one per segment
+	URIs      []string  // one per segment
+	Ended     bool      // #EXT-X-ENDLIST: the variant is complete
+}
+
+// readMediaPlaylist parses a playlist ffmpeg (or writeVODPlaylists)
+// wrote.
+func readMediaPlaylist(path string) (*mediaPlaylist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &mediaPlaylist{}
+	var duration float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			if _, uri, ok := strings.Cut(line, `URI="`); ok {
+				p.Init, _, _ = strings.Cut(uri, `"`)
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			duration, _ = strconv.ParseFloat(value, 64)
+		case line == "#EXT-X-ENDLIST":
+			p.Ended = true
+		case line != "" && !strings.HasPrefix(line, "#"):
+			if len(p.Durations) == 0 {
+				if m := segmentNumber.FindStringSubmatch(line); m != nil {
+					p.First, _ = strconv.Atoi(m[1])
+				}
+			}
+			p.Durations = append(p.Durations, duration)
+			p.URIs = append(p.URIs, line)
+		}
+	}
+	return p, scanner.Err()
+}
+
+// renderDASHManifest builds an MPEG-DASH manifest over the fMP4 segments
+// the HLS playlists list, so both kinds of players share one set of
+// files. Every variant playlist becomes a Representation with a
+// SegmentTimeline taken from its EXTINF durations; audio tracks and
+// subtitles become adaptation sets of their own, the host's picks marked
+// with the "main" role. While any playlist is still growing the manifest
+// is dynamic, anchored at startedAt, and players reload it.
+func renderDASHManifest(l *mediaLayout, playlists map[string]*mediaPlaylist, selectedAudio, selectedSubtitle string, startedAt time.Time) []byte {
+	live, total := false, 0.0
+	for _, p := range playlists {
+		live = live || !p.Ended
+		var sum float64
+		for _, d := range p.Durations {
+			sum += d
+		}
+		total = math.Max(total, sum)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" minBufferTime="PT4S"`)
+	if live {
+		fmt.Fprintf(&b, ` type="dynamic" availabilityStartTime="%s" publishTime="%s" minimumUpdatePeriod="PT%dS" suggestedPresentationDelay="PT%dS"`,
+			startedAt.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), segmentDuration, 3*segmentDuration)
+	} else {
+		fmt.Fprintf(&b, ` type="static" mediaPresentationDuration="PT%.3fS"`, total)
+	}
+	b.WriteString(">\n  <Period id=\"0\" start=\"PT0S\">\n")
+
+	set := 0
+	var video []variant
+	for _, v := range l.Variants {
+		if !v.AudioOnly && playlists[v.Name] != nil {
+			video = append(video, v)
+		}
+	}
+	if len(video) > 0 {
+		fmt.Fprintf(&b, "    <AdaptationSet id=\"%d\" contentType=\"video\" mimeType=\"video/mp4\" segmentAlignment=\"true\" startWithSAP=\"1\">\n", set)
+		for _, v := range video {
+			codecs := v.Codecs
+			if len(l.Audio) > 0 {
+				codecs, _, _ = strings.Cut(codecs, ",") // the audio is in its own sets
+			}
+			fmt.Fprintf(&b, "      <Representation id=\"%s\" bandwidth=\"%d\"", xmlAttr(v.Name), v.Bandwidth)
+			if v.Width > 0 && v.OutHeight > 0 {
+				fmt.Fprintf(&b, " width=\"%d\" height=\"%d\"", v.Width, v.OutHeight)
+			}
+			if codecs != "" {
+				fmt.Fprintf(&b, " codecs=\"%s\"", codecs)
+			}
+			b.WriteString(">\n")
+			writeSegmentTemplate(&b, v.Name, playlists[v.Name], l.Format)
+			b.WriteString("      </Representation>\n")
+		}
+		b.WriteString("    </AdaptationSet>\n")
+		set++
+	}
+
+	// An audio-only rung without an audio group (no probe) carries the audio
+	for _, v := range l.Variants {
+		if !v.AudioOnly || len(l.Audio) > 0 || playlists[v.Name] == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "    <AdaptationSet id=\"%d\" contentType=\"audio\" mimeType=\"audio/mp4\" segmentAlignment=\"true\" startWithSAP=\"1\">\n", set)
+		fmt.Fprintf(&b, "      <Representation id=\"%s\" bandwidth=\"%d\" codecs=\"%s\">\n", xmlAttr(v.Name), v.Bandwidth, v.Codecs)
+		writeSegmentTemplate(&b, v.Name, playlists[v.Name], l.Format)
+		b.WriteString("      </Representation>\n    </AdaptationSet>\n")
+		set++
+	}
+
+	for _, a := range l.Audio {
+		p := playlists[a.ID]
+		if p == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "    <AdaptationSet id=\"%d\" contentType=\"audio\" mimeType=\"audio/mp4\"", set)
+		if a.Language != "" {
+			fmt.Fprintf(&b, " lang=\"%s\"", xmlAttr(a.Language))
+		}
+		b.WriteString(" segmentAlignment=\"true\" startWithSAP=\"1\">\n")
+		fmt.Fprintf(&b, "      <Label>%s</Label>\n", xmlAttr(a.Name))
+		fmt.Fprintf(&b, "      <Role schemeIdUri=\"urn:mpeg:dash:role:2011\" value=\"%s\"/>\n", roleOf(a.ID == selectedAudio, "alternate"))
+		fmt.Fprintf(&b, "      <Representation id=\"%s\" bandwidth=\"%d\" codecs=\"mp4a.40.2\">\n", xmlAttr(a.ID), l.Variants[0].AudioBitrate*1000)
+		if a.Channels > 0 {
+			fmt.Fprintf(&b, "        <AudioChannelConfiguration schemeIdUri=\"urn:mpeg:dash:23003:3:audio_channel_configuration:2011\" value=\"%d\"/>\n", a.Channels)
+		}
+		writeSegmentTemplate(&b, a.ID, p, l.Format)
+		b.WriteString("      </Representation>\n    </AdaptationSet>\n")
+		set++
+	}
+
+	for _, s := range l.Subtitles {
+		fmt.Fprintf(&b, "    <AdaptationSet id=\"%d\" contentType=\"text\" mimeType=\"text/vtt\"", set)
+		if s.Language != "" {
+			fmt.Fprintf(&b, " lang=\"%s\"", xmlAttr(s.Language))
+		}
+		b.WriteString(">\n")
+		fmt.Fprintf(&b, "      <Label>%s</Label>\n", xmlAttr(s.Name))
+		role := "subtitle"
+		if s.Forced {
+			role = "forced-subtitle"
+		}
+		fmt.Fprintf(&b, "      <Role schemeIdUri=\"urn:mpeg:dash:role:2011\" value=\"%s\"/>\n", role)
+		if s.ID == selectedSubtitle {
+			b.WriteString("      <Role schemeIdUri=\"urn:mpeg:dash:role:2011\" value=\"main\"/>\n")
+		}
+		fmt.Fprintf(&b, "      <Representation id=\"%s\" bandwidth=\"256\">\n        <BaseURL>%s/%s.vtt</BaseURL>\n      </Representation>\n", xmlAttr(s.ID), subtitleDir, xmlAttr(s.ID))
+		b.WriteString("    </AdaptationSet>\n")
+		set++
+	}
+
+	b.WriteString("  </Period>\n</MPD>\n")
+	return []byte(b.String())
+}
+
+// writeSegmentTemplate addresses a variant's segments by number, with a
+// timeline of their actual durations (copied video is cut at the
+// source's keyframes, not every 2s). Runs of equal durations collapse
+// into one S element.
+func writeSegmentTemplate(b *strings.Builder, name string, p *mediaPlaylist, format OutputFormat) {
+	fmt.Fprintf(b, "        <SegmentTemplate timescale=\"%d\" initialization=\"%s/%s\" media=\"%s/seg_$Number%%03d$%s\" startNumber=\"%d\">\n",
+		dashTimescale, xmlAttr(name), xmlAttr(p.Init), xmlAttr(name), format.segmentExt(), p.First)
+	b.WriteString("          <SegmentTimeline>\n")
+
+	for i := 0; i < len(p.Durations); {
+		d := int64(math.Round(p.Durations[i] * dashTimescale))
+		repeat := 0
+		for i+repeat+1 < len(p.Durations) && int64(math.Round(p.Durations[i+repeat+1]*dashTimescale)) == d {
+			repeat++
+		}
+		if i == 0 {
+			// Playlists list every segment from the start of the input
+			fmt.Fprintf(b, "            <S t=\"0\" d=\"%d\"", d)
+		} else {
+			fmt.Fprintf(b, "            <S d=\"%d\"", d)
+		}
+		if repeat > 0 {
+			fmt.Fprintf(b, " r=\"%d\"", repeat)
+		}
+		b.WriteString("/>\n")
+		i += repeat + 1
+	}
+	b.WriteString("          </SegmentTimeline>\n        </SegmentTemplate>\n")
+}
+
+// roleOf returns the DASH role of a track the host may have picked.
+func roleOf(selected bool, otherwise string) string {
+	if selected {
+		return "main"
+	}
+	return otherwise
+}
+
+// xmlAttr escapes text for an XML attribute or element.
+func xmlAttr(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// DASHManifest renders manifest.mpd for a session, with the tracks its
+// host picked as the main ones. Returns false if nothing is streaming or
+// the stream isn't packaged for DASH.
+func (sm *StreamManager) DASHManifest(sessionID string) ([]byte, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	info, exists := sm.streams[sessionID]
+	if !exists || info.layout == nil || !info.layout.Format.DASH {
+		return nil, false
+	}
+
+	playlists := make(map[string]*mediaPlaylist)
+	for _, name := range info.layout.outputs() {
+		p, err := readMediaPlaylist(filepath.Join(info.outputDir, name, "index.m3u8"))
+		if err == nil && len(p.Durations) > 0 {
+			playlists[name] = p
+		}
+	}
+	return renderDASHManifest(info.layout, playlists, info.selectedAudio, info.selectedSubtitle, info.startedAt), true
+}
+
+// DASHURL returns the relative URL of a session's DASH manifest, or "" if
+// the stream isn't packaged for DASH.
+func (sm *StreamManager) DASHURL(sessionID string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	info, exists := sm.streams[sessionID]
+	if !exists || info.layout == nil || !info.layout.Format.DASH {
+		return ""
+	}
+	return fmt.Sprintf("/stream/%s/%s", sessionID, DASHManifestName)
+}
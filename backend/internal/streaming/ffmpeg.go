@@ -6,6 +6,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 )
 
 // findFFmpeg locates the ffmpeg binary on the system.
@@ -49,52 +51,277 @@ func findFFmpeg() (string, error) {
 	return "", fmt.Errorf("ffmpeg not found in PATH — install it: https://ffmpeg.org/download.html")
 }
 
+// transcodePlan records, per stream, which input streams go into the HLS
+// output and whether each can be copied as-is or must be re-encoded.
+type transcodePlan struct {
+	VideoMap  string // ffmpeg -map specifier; "" for audio-only inputs
+	AudioMap  string // "" when the input has no audio
+	CopyVideo bool
+	CopyAudio bool
+	// Input overrides the -i argument: "pipe:0" when ffmpeg follows an
+	// upload that is still being written, or a capture device
+	Input string
+	// InputFormat is the -f before -i for capture devices ("v4l2", ...)
+	InputFormat string
+	// InputOptions go before -i too, e.g. to make ffmpeg listen for an
+	// ingest (see ingest.go)
+	InputOptions []string
+	// LowLatency makes the run write LL-HLS parts (see llhls.go)
+	LowLatency bool
+	// EventPlaylist marks playlists #EXT-X-PLAYLIST-TYPE:EVENT while the
+	// input is still growing; ffmpeg adds #EXT-X-ENDLIST when done
+	EventPlaylist bool
+	// Segments, when set, limits the run to one on-demand segment job
+	// (see segmenter.go)
+	Segments *segmentRange
+	// Threads caps encoder and filter threads; 0 is ffmpeg's default
+	Threads int
+}
+
+// browserSafeH264Profiles are the H.264 profiles every HLS client decodes.
+// High 10 / 4:2:2 / 4:4:4 are H.264 too, but browsers refuse them.
+var browserSafeH264Profiles = map[string]bool{
+	"":                     true, // unknown — trust the codec
+	"Baseline":             true,
+	"Constrained Baseline": true,
+	"Main":                 true,
+	"High":                 true,
+}
+
+// planTranscode decides copy vs transcode for each stream from the probe
+// result. Without probe info (ffprobe missing or failed) it falls back to
+// guessing from the file extension. separateAudio matches buildTracks.
+func planTranscode(inputPath string, info *MediaInfo, separateAudio bool) transcodePlan {
+	if info == nil {
+		ext := strings.ToLower(filepath.Ext(inputPath))
+		copyAll := ext == ".mp4" || ext == ".mov" || ext == ".m4v"
+		return transcodePlan{
+			VideoMap:  "0:v:0?",
+			AudioMap:  "0:a:0?",
+			CopyVideo: copyAll,
+			CopyAudio: copyAll,
+		}
+	}
+
+	plan := transcodePlan{}
+	if v := info.PrimaryVideo(); v != nil {
+		plan.VideoMap = fmt.Sprintf("0:%d", v.Index)
+		plan.CopyVideo = v.Codec == "h264" &&
+			(v.PixFmt == "" || v.PixFmt == "yuv420p" || v.PixFmt == "yuvj420p") &&
+			browserSafeH264Profiles[v.Profile]
+	}
+	if a := info.PrimaryAudio(); a != nil {
+		plan.AudioMap = fmt.Sprintf("0:%d", a.Index)
+		plan.CopyAudio = a.Codec == "aac" || a.Codec == "mp3"
+		if len(info.Audio) > 1 || separateAudio {
+			// Tracks of an audio group must share a codec: only AAC is copied
+			plan.CopyAudio = a.Codec == "aac"
+		}
+	}
+	return plan
+}
+
 // buildFFmpegArgs creates the argument list for the ffmpeg HLS command.
-// It uses "-c copy" for fast remuxing when possible (MP4/MOV with H.264),
-// and transcodes for other formats (MKV, AVI, etc.).
-func buildFFmpegArgs(inputPath, outputDir string) []string {
-	ext := filepath.Ext(inputPath)
-	playlistPath := filepath.Join(outputDir, "index.m3u8")
-	segmentPattern := filepath.Join(outputDir, "seg_%03d.ts")
+// All variants of the ladder come out of one ffmpeg run: the decoded video
+// is split and scaled once per rung, and each variant gets its own
+// <name>/index.m3u8 and segments. Streams the plan marks as
+// browser-compatible are copied into the source rung ("-c copy" speed,
+// original quality); everything else is transcoded to H.264/AAC. When the
+// layout has an audio group, every audio track becomes its own playlist
+// and the video variants carry no audio.
+func buildFFmpegArgs(inputPath, outputDir string, plan transcodePlan, layout *mediaLayout) []string {
+	ladder := layout.Variants
+	if plan.Input != "" {
+		inputPath = plan.Input
+	}
 
 	// Base args: fast input analysis, then overwrite + input
 	args := []string{
 		"-y",
 		"-fflags", "+genpts+discardcorrupt", // don't stall on bad timestamps
-		"-analyzeduration", "2000000",        // cap input analysis to 2 seconds (µs)
-		"-probesize", "5000000",              // cap probe to 5 MB (enough for headers)
-		"-i", inputPath,
+		"-analyzeduration", "2000000", // cap input analysis to 2 seconds (µs)
+		"-probesize", "5000000", // cap probe to 5 MB (enough for headers)
+	}
+	if plan.Threads > 0 {
+		args = append(args, "-filter_complex_threads", strconv.Itoa(plan.Threads))
+	}
+	var seek float64
+	if r := plan.Segments; r != nil {
+		args = append(args, r.inputArgs()...)
+		seek = r.start()
+	}
+	args = append(args, plan.InputOptions...)
+	if plan.InputFormat != "" {
+		args = append(args, "-f", plan.InputFormat)
+	}
+	args = append(args, "-i", inputPath)
+	if plan.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(plan.Threads)) // per encoder
 	}
 
-	// For MP4/MOV with likely H.264+AAC we can do a fast copy.
-	// For everything else, transcode to H.264+AAC.
-	switch ext {
-	case ".mp4", ".mov", ".m4v":
-		args = append(args,
-			"-c", "copy", // remux — instant, original quality
-		)
-	default:
-		// MKV, AVI, WebM, FLV, etc. → transcode
+	if len(ladder) == 1 && len(layout.Audio) == 0 {
+		// Single variant: plain stream mapping, no filter graph, which also
+		// works with the optional "0:v:0?" maps used when probing failed
+		v := ladder[0]
+		if !v.AudioOnly {
+			args = append(args, "-map", plan.VideoMap)
+			if v.CopyVideo {
+				args = append(args, "-c:v", "copy") // remux — instant, original quality
+			} else {
+				args = append(args, "-pix_fmt", "yuv420p") // 10-bit / 4:4:4 sources won't play in browsers
+				args = append(args, videoEncodeArgs("v", v.VideoBitrate, seek)...)
+				if plan.LowLatency {
+					args = append(args, "-tune:v", "zerolatency") // no lookahead or B-frames delaying parts
+				}
+			}
+		}
+		if plan.AudioMap != "" {
+			args = append(args, "-map", plan.AudioMap)
+			args = append(args, audioEncodeArgs("a", plan.CopyAudio, v.AudioBitrate)...)
+		}
+		if plan.LowLatency {
+			return append(args, llOutputArgs(outputDir, v.Name)...)
+		}
+		if plan.Segments != nil {
+			return append(args, plan.Segments.outputArgs(outputDir, v.Name, layout.Format)...)
+		}
+		return append(args, hlsOutputArgs(outputDir, v.Name, plan.EventPlaylist, layout.Format)...)
+	}
+
+	// Filter graph feeding every re-encoded rung from one decode
+	var scaled []string
+	for _, v := range ladder {
+		if !v.AudioOnly && !v.CopyVideo {
+			scaled = append(scaled, v.Name)
+		}
+	}
+	if len(scaled) > 0 {
+		var graph strings.Builder
+		fmt.Fprintf(&graph, "[%s]split=%d", plan.VideoMap, len(scaled))
+		for i := range scaled {
+			fmt.Fprintf(&graph, "[s%d]", i)
+		}
+		i := 0
+		for _, v := range ladder {
+			if v.AudioOnly || v.CopyVideo {
+				continue
+			}
+			if v.Height > 0 {
+				fmt.Fprintf(&graph, ";[s%d]scale=-2:%d,format=yuv420p[%s]", i, v.Height, v.Name)
+			} else {
+				fmt.Fprintf(&graph, ";[s%d]format=yuv420p[%s]", i, v.Name)
+			}
+			i++
+		}
+		args = append(args, "-filter_complex", graph.String())
+	}
+
+	// Map and encode each variant; var_stream_map groups the output
+	// streams (counted per type) back into variants
+	var streamMap []string
+	videoIdx, audioIdx := 0, 0
+	for _, v := range ladder {
+		if v.AudioOnly && len(layout.Audio) > 0 {
+			continue // served by the audio group's default track
+		}
+		var group []string
+		if !v.AudioOnly {
+			spec := fmt.Sprintf("v:%d", videoIdx)
+			if v.CopyVideo {
+				args = append(args, "-map", plan.VideoMap, "-c:"+spec, "copy")
+			} else {
+				args = append(args, "-map", "["+v.Name+"]")
+				args = append(args, videoEncodeArgs(spec, v.VideoBitrate, seek)...)
+			}
+			group = append(group, spec)
+			videoIdx++
+		}
+		if len(layout.Audio) > 0 {
+			group = append(group, "agroup:"+audioGroupID)
+		} else if plan.AudioMap != "" {
+			spec := fmt.Sprintf("a:%d", audioIdx)
+			args = append(args, "-map", plan.AudioMap)
+			args = append(args, audioEncodeArgs(spec, plan.CopyAudio, v.AudioBitrate)...)
+			group = append(group, spec)
+			audioIdx++
+		}
+		group = append(group, "name:"+v.Name)
+		streamMap = append(streamMap, strings.Join(group, ","))
+	}
+	for _, a := range layout.Audio {
+		spec := fmt.Sprintf("a:%d", audioIdx)
+		args = append(args, "-map", fmt.Sprintf("0:%d", a.Stream))
+		args = append(args, audioEncodeArgs(spec, a.Copy, ladder[0].AudioBitrate)...)
+		streamMap = append(streamMap, fmt.Sprintf("%s,agroup:%s,name:%s", spec, audioGroupID, a.ID))
+		audioIdx++
+	}
+	args = append(args, "-var_stream_map", strings.Join(streamMap, " "))
+
+	if plan.Segments != nil {
+		return append(args, plan.Segments.outputArgs(outputDir, "%v", layout.Format)...)
+	}
+	return append(args, hlsOutputArgs(outputDir, "%v", plan.EventPlaylist, layout.Format)...)
+}
+
+// videoEncodeArgs returns libx264 settings for one output video stream.
+// A bitrate of 0 means quality-targeted (crf) encoding for the source rung;
+// ladder rungs get a capped bitrate so BANDWIDTH in the master holds.
+// seek is where an on-demand job starts (0 otherwise): its timestamps are
+// the input's, so keyframes stay on the same 2s grid as the playlist.
+func videoEncodeArgs(spec string, kbps int, seek float64) []string {
+	// Keyframe every 2s on every rung so players can switch at any segment
+	keyframes := "expr:gte(t,n_forced*2)"
+	if seek > 0 {
+		keyframes = fmt.Sprintf("expr:gte(t,%g+n_forced*2)", seek)
+	}
+	args := []string{
+		"-c:" + spec, "libx264",
+		"-preset:" + spec, "ultrafast",
+		"-profile:" + spec, "main",
+		"-force_key_frames:" + spec, keyframes,
+	}
+	if kbps > 0 {
 		args = append(args,
-			"-c:v", "libx264",
-			"-preset", "ultrafast",
-			"-crf", "23",
-			"-g", "48", // Force keyframes every 48 frames (approx 2s at 24fps)
-			"-c:a", "aac",
-			"-b:a", "128k",
+			"-b:"+spec, fmt.Sprintf("%dk", kbps),
+			"-maxrate:"+spec, fmt.Sprintf("%dk", kbps*107/100),
+			"-bufsize:"+spec, fmt.Sprintf("%dk", kbps*2),
 		)
+	} else {
+		args = append(args, "-crf:"+spec, "23")
+	}
+	return args
+}
+
+// audioEncodeArgs copies browser-safe audio or encodes stereo AAC.
+func audioEncodeArgs(spec string, copyAudio bool, kbps int) []string {
+	if copyAudio {
+		return []string{"-c:" + spec, "copy"}
+	}
+	return []string{
+		"-c:" + spec, "aac",
+		"-b:" + spec, fmt.Sprintf("%dk", kbps),
+		"-ac:" + spec, "2", // downmix 5.1/7.1 for browsers
 	}
+}
+
+// hlsOutputArgs writes <outputDir>/<name>/index.m3u8 and its segments
+// (MPEG-TS, or fMP4 after an init segment); name is "%v" when ffmpeg
+// expands it per variant.
+func hlsOutputArgs(outputDir, name string, event bool, format OutputFormat) []string {
+	var args []string
+	if event {
+		args = append(args, "-hls_playlist_type", "event")
+	}
+	args = append(args, format.segmentArgs(name)...)
 
 	// HLS output settings — tuned for fastest time-to-first-frame
-	args = append(args,
+	return append(args,
 		"-f", "hls",
-		"-hls_time", "2",                              // 2-second segments
-		"-hls_init_time", "0",                         // emit first segment ASAP (don't wait for full hls_time)
-		"-hls_list_size", "0",                         // keep all segments in the playlist
-		"-hls_segment_filename", segmentPattern,
-		"-hls_flags", "independent_segments+temp_file", // temp_file: prevent HLS.js reading half-written .ts
-		playlistPath,
+		"-hls_time", "2", // 2-second segments
+		"-hls_init_time", "0", // emit first segment ASAP (don't wait for full hls_time)
+		"-hls_list_size", "0", // keep all segments in the playlist
+		"-hls_segment_filename", filepath.Join(outputDir, name, format.segmentPattern()),
+		"-hls_flags", "independent_segments+temp_file", // temp_file: prevent HLS.js reading half-written segments
+		filepath.Join(outputDir, name, "index.m3u8"),
 	)
-
-	return args
 }
@@ -0,0 +1,101 @@
+package streaming
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Segment containers for the HLS output.
+const (
+	SegmentsTS   = "ts"   // MPEG-TS, what every HLS client plays
+	SegmentsFMP4 = "fmp4" // fragmented MP4 (CMAF): less overhead, shared with DASH
+)
+
+// DASHManifestName is the MPEG-DASH manifest served next to the master
+// playlist when DASH is enabled.
+const DASHManifestName = "manifest.mpd"
+
+// OutputFormat selects how streams are packaged.
+type OutputFormat struct {
+	Segments string `json:"segments"`       // SegmentsTS or SegmentsFMP4; "" means TS
+	DASH     bool   `json:"dash,omitempty"` // also serve manifest.mpd over the same segments
+}
+
+// DefaultOutputFormat is plain MPEG-TS HLS.
+var DefaultOutputFormat = OutputFormat{Segments: SegmentsTS}
+
+// ParseOutputFormat parses HLS_SEGMENT_FORMAT ("ts", "fmp4" or "cmaf")
+// and whether a DASH manifest is wanted. DASH players need fMP4, so DASH
+// without an explicit segment format picks it.
+func ParseOutputFormat(segments string, dash bool) (OutputFormat, error) {
+	f := OutputFormat{DASH: dash}
+	switch strings.ToLower(strings.TrimSpace(segments)) {
+	case "":
+		f.Segments = SegmentsTS
+		if dash {
+			f.Segments = SegmentsFMP4
+		}
+	case "ts", "mpegts":
+		f.Segments = SegmentsTS
+	case "fmp4", "cmaf", "mp4":
+		f.Segments = SegmentsFMP4
+	default:
+		return f, fmt.Errorf("unsupported segment format %q", segments)
+	}
+	if f.DASH && f.Segments != SegmentsFMP4 {
+		return f, fmt.Errorf("DASH needs fmp4 segments")
+	}
+	return f, nil
+}
+
+// fmp4 reports whether segments are fragmented MP4.
+func (f OutputFormat) fmp4() bool {
+	return f.Segments == SegmentsFMP4
+}
+
+// segmentExt is the extension of media segments: .ts, or .m4s for fMP4.
+func (f OutputFormat) segmentExt() string {
+	if f.fmp4() {
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+// segmentPattern is ffmpeg's segment file name pattern.
+func (f OutputFormat) segmentPattern() string {
+	return "seg_%03d" + f.segmentExt()
+}
+
+// segmentFile is the file name of segment i.
+func (f OutputFormat) segmentFile(i int) string {
+	return fmt.Sprintf("seg_%03d%s", i, f.segmentExt())
+}
+
+// profile distinguishes cache entries of different formats. DASH changes
+// the layout too (audio is never muxed into the video variants).
+func (f OutputFormat) profile() string {
+	p := SegmentsTS
+	if f.fmp4() {
+		p = SegmentsFMP4
+	}
+	if f.DASH {
+		p += "+dash"
+	}
+	return p
+}
+
+// initSegmentName is the fMP4 init segment of a variant, next to its
+// playlist. ffmpeg can only tell the variants' init segments apart by
+// name, so the name includes the variant's.
+func initSegmentName(name string) string {
+	return "init_" + name + ".mp4"
+}
+
+// segmentArgs are the ffmpeg options that pick the segment container;
+// name is "%v" when ffmpeg expands it per variant.
+func (f OutputFormat) segmentArgs(name string) []string {
+	if !f.fmp4() {
+		return nil
+	}
+	return []string{"-hls_segment_type", "fmp4", "-hls_fmp4_init_filename", initSegmentName(name)}
+}
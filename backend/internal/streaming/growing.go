@@ -0,0 +1,176 @@
+package streaming
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// FollowUploadThreshold is how much of an upload must be on disk before
+// ffmpeg starts reading it: enough for the container headers and the
+// first few segments.
+const FollowUploadThreshold = 8 << 20
+
+// ErrUploadAborted is what a follower reads when the upload it follows is
+// cancelled or expires.
+var ErrUploadAborted = errors.New("upload aborted before completion")
+
+// GrowingFile is a file an upload is still writing. The uploader reports
+// how many bytes are committed (verified and on disk); followers read up
+// to that point and block for more until the upload completes or aborts.
+type GrowingFile struct {
+	path string
+
+	mu        sync.Mutex
+	committed int64
+	done      bool
+	err       error
+	changed   chan struct{} // closed and replaced on every update
+}
+
+// NewGrowingFile tracks an upload being written to path.
+func NewGrowingFile(path string) *GrowingFile {
+	return &GrowingFile{path: path, changed: make(chan struct{})}
+}
+
+// Path returns the file being written.
+func (g *GrowingFile) Path() string {
+	return g.path
+}
+
+// Advance marks the first n bytes of the file as safe to read.
+func (g *GrowingFile) Advance(n int64) {
+	g.update(func() {
+		if n > g.committed {
+			g.committed = n
+		}
+	})
+}
+
+// Complete marks the upload as finished; followers get EOF at the end.
+func (g *GrowingFile) Complete() {
+	g.update(func() { g.done = true })
+}
+
+// Abort fails the upload; followers get err instead of more data.
+func (g *GrowingFile) Abort(err error) {
+	g.update(func() {
+		if !g.done {
+			g.done = true
+			g.err = err
+		}
+	})
+}
+
+func (g *GrowingFile) update(fn func()) {
+	g.mu.Lock()
+	fn()
+	close(g.changed)
+	g.changed = make(chan struct{})
+	g.mu.Unlock()
+}
+
+// Follow opens a reader that returns the file's bytes as they are
+// committed, blocking at the current end until more arrive.
+func (g *GrowingFile) Follow() (io.ReadCloser, error) {
+	f, err := os.Open(g.path)
+	if err != nil {
+		return nil, err
+	}
+	return &growingReader{g: g, f: f}, nil
+}
+
+type growingReader struct {
+	g   *GrowingFile
+	f   *os.File
+	pos int64
+}
+
+func (r *growingReader) Read(p []byte) (int, error) {
+	for {
+		r.g.mu.Lock()
+		committed, done, failed, changed := r.g.committed, r.g.done, r.g.err, r.g.changed
+		r.g.mu.Unlock()
+
+		if failed != nil {
+			return 0, failed
+		}
+		if avail := committed - r.pos; avail > 0 {
+			if int64(len(p)) > avail {
+				p = p[:avail]
+			}
+			n, err := r.f.ReadAt(p, r.pos)
+			r.pos += int64(n)
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+			return n, err
+		}
+		if done {
+			return 0, io.EOF
+		}
+		<-changed
+	}
+}
+
+func (r *growingReader) Close() error {
+	return r.f.Close()
+}
+
+// CanFollowUpload reports whether ffmpeg can read the file front to back
+// while it is still being uploaded: Matroska/WebM and MPEG-TS always, MP4
+// and MOV only when the index (moov) comes before the media data, as in
+// "fast start" files. Everything else must wait for the whole file.
+func CanFollowUpload(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, 376)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+
+	switch {
+	case n >= 4 && binary.BigEndian.Uint32(head) == 0x1A45DFA3: // EBML: mkv / webm
+		return true
+	case n >= 189 && head[0] == 0x47 && head[188] == 0x47: // MPEG-TS sync bytes
+		return true
+	case n >= 8 && string(head[4:8]) == "ftyp":
+		return moovBeforeMdat(f)
+	}
+	return false
+}
+
+// moovBeforeMdat walks the top-level MP4 boxes looking for which of moov
+// and mdat comes first.
+func moovBeforeMdat(f *os.File) bool {
+	var offset int64
+	header := make([]byte, 16)
+	for i := 0; i < 32; i++ {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return false
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		switch string(header[4:8]) {
+		case "moov":
+			return true
+		case "mdat":
+			return false
+		}
+		if size == 1 { // 64-bit size follows the type
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return false
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 {
+			return false // 0 means "to end of file", anything else is corrupt
+		}
+		offset += size
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+)
+
+// Protocols a host can push a live stream with.
+const (
+	IngestRTMP = "rtmp"
+	IngestSRT  = "srt"
+)
+
+// ingestConnectTimeout is how long an ingest listener waits for the
+// publisher (OBS) to connect before the stream fails.
+const ingestConnectTimeout = 30 * time.Minute
+
+// ingestApp is the RTMP application publishers connect to.
+const ingestApp = "live"
+
+// Ingest is where a host pushes a live stream for a session. In OBS: Server
+// rtmp://<host>:<Port>/live and the stream key, or for SRT the whole URL.
+type Ingest struct {
+	Protocol  string `json:"protocol"`
+	Port      int    `json:"port"`
+	StreamKey string `json:"streamKey"`
+	Transcode bool   `json:"transcode"` // re-encode instead of remuxing the pushed H.264
+
+	// rejected is set when a publisher used the wrong stream key; the
+	// listener is re-armed when ffmpeg exits. Guarded by sm.mu.
+	rejected bool
+}
+
+// Server is the RTMP server URL to configure in the publisher, without the
+// key; "" for SRT, where the key is part of URL.
+func (in *Ingest) Server(host string) string {
+	if in.Protocol != IngestRTMP {
+		return ""
+	}
+	return fmt.Sprintf("rtmp://%s:%d/%s", host, in.Port, ingestApp)
+}
+
+// URL is the full URL to push to. The SRT stream key is the passphrase
+// that encrypts the stream, so SRT enforces it itself.
+func (in *Ingest) URL(host string) string {
+	if in.Protocol == IngestSRT {
+		return fmt.Sprintf("srt://%s:%d?passphrase=%s&pbkeylen=16", host, in.Port, in.StreamKey)
+	}
+	return fmt.Sprintf("rtmp://%s:%d/%s/%s", host, in.Port, ingestApp, in.StreamKey)
+}
+
+// listenArgs make ffmpeg wait for the publisher on all interfaces.
+func (in *Ingest) listenArgs() (options []string, input string) {
+	if in.Protocol == IngestSRT {
+		return nil, fmt.Sprintf("srt://0.0.0.0:%d?mode=listener&passphrase=%s&pbkeylen=16&listen_timeout=%d",
+			in.Port, in.StreamKey, ingestConnectTimeout.Microseconds())
+	}
+	options = []string{"-listen", "1", "-timeout", strconv.Itoa(int(ingestConnectTimeout.Seconds()))}
+	return options, fmt.Sprintf("rtmp://0.0.0.0:%d/%s/%s", in.Port, ingestApp, in.StreamKey)
+}
+
+// freeIngestPort asks the OS for an unused port for the listener. ffmpeg
+// binds it a moment later; another program grabbing it in between makes
+// the stream fail, and the host starts another ingest.
+func freeIngestPort(protocol string) (int, error) {
+	if protocol == IngestSRT {
+		conn, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// plan reads whatever the publisher sends: OBS pushes H.264/AAC, so
+// the video is remuxed unless transcode is set. Audio is always encoded,
+// since publishers may send anything (Opus over SRT, 48kHz surround...).
+func (in *Ingest) plan() transcodePlan {
+	options, input := in.listenArgs()
+	return transcodePlan{
+		VideoMap:      "0:v:0?",
+		AudioMap:      "0:a:0?",
+		CopyVideo:     !in.Transcode,
+		Input:         input,
+		InputOptions:  options,
+		EventPlaylist: true,
+	}
+}
+
+// StartIngest opens a live ingest for a session: ffmpeg listens for a
+// publisher (OBS, a phone app, another ffmpeg) on a fresh port, and turns
+// what it pushes into HLS for the session. The stream is announced when
+// the first segment lands, which may be long after this returns.
+func (sm *StreamManager) StartIngest(sessionID, protocol string, transcode bool) (*Ingest, error) {
+	if protocol != IngestRTMP && protocol != IngestSRT {
+		return nil, fmt.Errorf("unsupported ingest protocol %q", protocol)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if existing, exists := sm.streams[sessionID]; exists {
+		if isLive(existing.status.State) {
+			if existing.ingest != nil {
+				ingest := *existing.ingest
+				return &ingest, nil
+			}
+			return nil, fmt.Errorf("session is already streaming; stop it first")
+		}
+		sm.release(sessionID, existing)
+	}
+
+	port, err := freeIngestPort(protocol)
+	if err != nil {
+		return nil, fmt.Errorf("no port for the ingest listener: %w", err)
+	}
+	ingest := &Ingest{
+		Protocol:  protocol,
+		Port:      port,
+		StreamKey: strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Transcode: transcode,
+	}
+
+	outputDir := filepath.Join(hlsRoot, sessionID)
+	plan := ingest.plan()
+	layout := &mediaLayout{
+		Variants: buildLadder(sm.renditions, plan, nil)[:1],
+		// Without a probe the audio can't go into its own group, which DASH needs
+		Format: OutputFormat{Segments: sm.format.Segments},
+	}
+	variants := layout.outputs()
+	if err := os.MkdirAll(filepath.Join(outputDir, variants[0]), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output dir: %w", err)
+	}
+	if err := writeMasterPlaylist(outputDir, layout); err != nil {
+		os.RemoveAll(outputDir)
+		return nil, fmt.Errorf("failed to write master playlist: %w", err)
+	}
+
+	info := &streamInfo{
+		outputDir: outputDir,
+		layout:    layout,
+		variants:  variants,
+		startedAt: time.Now(),
+		ingest:    ingest,
+		status: models.StreamStatus{
+			SessionID: sessionID,
+			State:     StreamStateStarting,
+			UpdatedAt: time.Now(),
+		},
+	}
+	if err := sm.startTranscode(sessionID, info, plan, nil); err != nil {
+		os.RemoveAll(outputDir)
+		return nil, err
+	}
+	sm.streams[sessionID] = info
+	started := *ingest
+
+	log.Printf("📥 [Stream] %s ingest for session %s listening on port %d", strings.ToUpper(protocol), sessionID, port)
+	go sm.announce(sessionID, info, ingestConnectTimeout)
+	return &started, nil
+}
+
+// checkPublisher watches ffmpeg's log for an RTMP publisher using the
+// wrong stream key (ffmpeg's listener only logs it) and drops it.
+func (sm *StreamManager) checkPublisher(info *streamInfo, line string) {
+	if !strings.Contains(line, "Unexpected stream") {
+		return
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if info.ingest.rejected || info.status.State != StreamStateStarting {
+		return
+	}
+	log.Printf("🚫 [Stream] Rejecting RTMP publisher with the wrong stream key for session %s", info.status.SessionID)
+	info.ingest.rejected = true
+	info.run.Stop()
+}
+
+// rearmIngest restarts the listener after a publisher was rejected, so a
+// stranger on the LAN can't end the ingest by guessing wrong. Returns
+// false if the exit should be handled normally.
+func (sm *StreamManager) rearmIngest(sessionID string, info *streamInfo, plan transcodePlan) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.streams[sessionID] != info || !info.ingest.rejected || info.status.State != StreamStateStarting {
+		return false
+	}
+	info.ingest.rejected = false
+	if err := sm.startTranscode(sessionID, info, plan, nil); err != nil {
+		log.Printf("⚠️ [Stream] Failed to re-arm ingest for session %s: %v", sessionID, err)
+		return false
+	}
+	return true
+}
+
+// GetIngest returns a session's live ingest, or nil if it isn't one.
+func (sm *StreamManager) GetIngest(sessionID string) *Ingest {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if info, exists := sm.streams[sessionID]; exists && info.ingest != nil {
+		ingest := *info.ingest
+		return &ingest
+	}
+	return nil
+}
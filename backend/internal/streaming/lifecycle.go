@@ -0,0 +1,375 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+)
+
+// Stream states reported in StreamStatus. A stream moves
+//
+//	(queued →) starting → ready → playing → finished
+//
+// driven by ffmpeg and viewers, can fail from any live state, and ends in
+// stopped when the host stops it or the garbage collector reclaims it.
+const (
+	StreamStateQueued   = "queued"   // waiting for a transcode slot (see scheduler.go)
+	StreamStateStarting = "starting" // ffmpeg launched, playlists not written yet
+	StreamStateReady    = "ready"    // playlists on disk, stream announced
+	StreamStatePlaying  = "playing"  // a viewer has fetched a segment
+	StreamStateFinished = "finished" // ffmpeg reached the end; VOD kept for replay
+	StreamStateFailed   = "failed"   // ffmpeg exited with an error
+	StreamStateStopped  = "stopped"  // stopped or garbage-collected; terminal
+)
+
+// streamTransitions lists the states each state may move to. ffmpeg can
+// finish a short file before the playlist watcher notices, hence
+// starting → finished.
+var streamTransitions = map[string][]string{
+	StreamStateQueued:   {StreamStateStarting, StreamStateFailed, StreamStateStopped},
+	StreamStateStarting: {StreamStateReady, StreamStateFinished, StreamStateFailed, StreamStateStopped},
+	StreamStateReady:    {StreamStatePlaying, StreamStateFinished, StreamStateFailed, StreamStateStopped},
+	StreamStatePlaying:  {StreamStateFinished, StreamStateFailed, StreamStateStopped},
+	StreamStateFinished: {StreamStateStopped},
+	StreamStateFailed:   {StreamStateStopped},
+}
+
+// transition moves a stream to a new state if the state machine allows it.
+// The caller must hold sm.mu.
+func (sm *StreamManager) transition(info *streamInfo, to string) bool {
+	from := info.status.State
+	for _, allowed := range streamTransitions[from] {
+		if allowed == to {
+			info.status.State = to
+			info.status.UpdatedAt = time.Now()
+			if to == StreamStateFinished || to == StreamStateFailed {
+				info.endedAt = time.Now()
+			}
+			if !isLive(to) {
+				sm.jobs.release(info.job) // the next queued stream can start
+			}
+			log.Printf("🔁 [Stream] Session %s: %s → %s", info.status.SessionID, from, to)
+			return true
+		}
+	}
+	return false
+}
+
+// isLive reports whether ffmpeg is still producing output for the
+// stream, or will once it has a slot.
+func isLive(state string) bool {
+	return state == StreamStateQueued || state == StreamStateStarting || state == StreamStateReady || state == StreamStatePlaying
+}
+
+// isPlayable reports whether the stream's playlists can be served.
+func isPlayable(state string) bool {
+	return state == StreamStateReady || state == StreamStatePlaying || state == StreamStateFinished
+}
+
+// MarkPlaying records that a viewer started fetching segments.
+func (sm *StreamManager) MarkPlaying(sessionID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	info, ok := sm.streams[sessionID]
+	if !ok {
+		return
+	}
+	if info.playingAt.IsZero() {
+		info.playingAt = time.Now()
+	}
+	if info.status.State == StreamStateReady {
+		sm.transition(info, StreamStatePlaying)
+	}
+}
+
+// SetOnFinished sets what is called, on its own goroutine, when a
+// session's stream has played to its natural end: ffmpeg finished (or the
+// stream came from the cache) and the media's duration has passed since
+// viewers started playing it (a live input has by the time it ends). A
+// stream nobody played, or that is stopped or replaced first, never is.
+func (sm *StreamManager) SetOnFinished(fn func(sessionID string)) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.onFinished = fn
+}
+
+// watchPlayback waits until a finished stream has been played through and
+// reports it to onFinished.
+func (sm *StreamManager) watchPlayback(sessionID string, info *streamInfo) {
+	ticker := time.NewTicker(sm.playbackPoll)
+	defer ticker.Stop()
+	for {
+		sm.mu.RLock()
+		current := sm.streams[sessionID] == info && info.status.State == StreamStateFinished
+		playingAt, length := info.playingAt, info.status.Duration
+		if length <= 0 {
+			length = info.status.OutTime // unprobed, or a live input
+		}
+		onFinished := sm.onFinished
+		sm.mu.RUnlock()
+
+		if !current {
+			return
+		}
+		// Nobody watching yet means nobody has reached the end either
+		ended := !playingAt.IsZero() && time.Since(playingAt).Seconds() >= length
+		if ended {
+			if onFinished != nil {
+				log.Printf("🏁 [Stream] Session %s played to the end", sessionID)
+				onFinished(sessionID)
+			}
+			return
+		}
+		<-ticker.C
+	}
+}
+
+// IsPlayable returns true if the session has a stream viewers can watch,
+// including a finished VOD kept for replay.
+func (sm *StreamManager) IsPlayable(sessionID string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	info, ok := sm.streams[sessionID]
+	return ok && isPlayable(info.status.State)
+}
+
+// release moves a stream to stopped, removes it from the map and deletes
+// its output (or unpins it, if cached), sidecars and upload. The caller must hold sm.mu.
+func (sm *StreamManager) release(sessionID string, info *streamInfo) {
+	if isLive(info.status.State) && info.run != nil {
+		log.Printf("🛑 [Stream] Stopping ffmpeg for session %s", sessionID)
+		info.run.Stop()
+	}
+	info.killSideJobs()
+	if info.ll != nil {
+		info.ll.finish() // stop polling before the directory goes
+	}
+	if info.bridge != nil {
+		go info.bridge.close()
+	}
+	sm.transition(info, StreamStateStopped)
+	sm.preserveLocked(sessionID, info)
+	sm.discardOutput(info)
+	os.RemoveAll(sidecarDir(sessionID))
+	removeUpload(info.filePath)
+	delete(sm.streams, sessionID)
+	log.Printf("🧹 [Stream] Cleaned up session %s", sessionID)
+}
+
+// discardOutput deletes a released stream's output, or unpins it if
+// cached. While a recording copy of it runs, that is left to the copy (see
+// copyDone); our own directory is moved aside meanwhile so the session can
+// stream again. The caller must hold sm.mu.
+func (sm *StreamManager) discardOutput(info *streamInfo) {
+	dir, key, cached := info.outputDir, info.cacheKey, info.cached
+	discard := func() {
+		if cached {
+			sm.cache.Release(key)
+		} else {
+			os.RemoveAll(dir)
+		}
+	}
+	if info.copies == 0 {
+		discard()
+		return
+	}
+	if !cached {
+		aside := fmt.Sprintf("%s.%s", dir, uuid.New().String()[:8])
+		if err := os.Rename(dir, aside); err != nil {
+			log.Printf("⚠️ [Stream] Failed to set aside output being recorded: %v", err)
+			discard()
+			return
+		}
+		now := time.Now() // fresh to the GC until the copy is done
+		os.Chtimes(aside, now, now)
+		dir = aside
+	}
+	info.discard = discard
+}
+
+// killSideJobs stops subtitle extraction and preview generation; a no-op
+// for runs that are already done.
+func (info *streamInfo) killSideJobs() {
+	for _, run := range []TranscodeRun{info.subsRun, info.previewRun} {
+		if run != nil {
+			run.Stop()
+		}
+	}
+}
+
+// waitSideJobs blocks until subtitle extraction and preview generation
+// have put their files in place.
+func (info *streamInfo) waitSideJobs() {
+	for _, done := range []<-chan struct{}{info.subsDone, info.previewsDone} {
+		if done != nil {
+			<-done
+		}
+	}
+}
+
+// ensureEndList appends #EXT-X-ENDLIST to a finished variant playlist if
+// ffmpeg didn't, so players treat the retained output as complete VOD.
+func ensureEndList(playlistPath string) error {
+	data, err := os.ReadFile(playlistPath)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(data), "#EXT-X-ENDLIST") {
+		return nil
+	}
+	f, err := os.OpenFile(playlistPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		f.WriteString("\n")
+	}
+	_, err = f.WriteString("#EXT-X-ENDLIST\n")
+	return err
+}
+
+// hlsRoot, uploadRoot and sidecarRoot hold per-session HLS output, browser
+// uploads and uploaded subtitle tracks.
+var (
+	hlsRoot     = filepath.Join(os.TempDir(), "0xnet-hls")
+	uploadRoot  = filepath.Join(os.TempDir(), "0xnet-uploads")
+	sidecarRoot = filepath.Join(os.TempDir(), "0xnet-sidecars")
+)
+
+// UploadDir returns the directory browser uploads for a session are saved in.
+func UploadDir(sessionID string) string {
+	return filepath.Join(uploadRoot, sessionID)
+}
+
+// sidecarDir returns the directory a session's sidecar subtitles are saved
+// in. It is kept apart from the output directory, which may be a cache
+// entry other sessions are served from.
+func sidecarDir(sessionID string) string {
+	return filepath.Join(sidecarRoot, sessionID)
+}
+
+// removeUpload deletes an input file if it was a browser upload (files
+// picked from disk are never touched), plus the directories above it that
+// are left empty.
+func removeUpload(filePath string) {
+	rel, err := filepath.Rel(uploadRoot, filePath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return
+	}
+	if err := os.Remove(filePath); err == nil {
+		log.Printf("🧹 [Stream] Removed upload %s", filepath.Base(filePath))
+	}
+	for dir := filepath.Dir(filePath); dir != uploadRoot && strings.HasPrefix(dir, uploadRoot); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // not empty
+		}
+	}
+}
+
+// GCPolicy controls how long stream output and uploads are kept.
+type GCPolicy struct {
+	FinishedRetention time.Duration // finished VODs stay replayable this long
+	FailedRetention   time.Duration // failed output stays for /stream/status inspection
+	OrphanAge         time.Duration // untracked dirs (crashed runs, abandoned uploads)
+	Interval          time.Duration // how often the collector runs
+}
+
+// DefaultGCPolicy keeps a finished movie around long enough to rewatch
+// during the same evening.
+var DefaultGCPolicy = GCPolicy{
+	FinishedRetention: 2 * time.Hour,
+	FailedRetention:   10 * time.Minute,
+	OrphanAge:         time.Hour,
+	Interval:          time.Minute,
+}
+
+// StartGC runs the garbage collector in the background until ctx is
+// cancelled.
+func (sm *StreamManager) StartGC(ctx context.Context, policy GCPolicy) {
+	go func() {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sm.collectGarbage(policy)
+			}
+		}
+	}()
+}
+
+// collectGarbage releases finished and failed streams past their retention
+// and deletes output/upload/sidecar directories no stream owns anymore.
+func (sm *StreamManager) collectGarbage(policy GCPolicy) {
+	var released []string
+
+	sm.mu.Lock()
+	for sid, info := range sm.streams {
+		retention := policy.FinishedRetention
+		switch info.status.State {
+		case StreamStateFinished:
+		case StreamStateFailed:
+			retention = policy.FailedRetention
+		default:
+			continue
+		}
+		if time.Since(info.endedAt) > retention {
+			sm.release(sid, info)
+			released = append(released, sid)
+		}
+	}
+	owned := make(map[string]bool, len(sm.streams))
+	for sid := range sm.streams {
+		owned[sid] = true
+	}
+	sm.mu.Unlock()
+
+	for _, sid := range released {
+		sm.bus.Publish(sid, events.StreamStopped{})
+	}
+
+	for _, root := range []string{hlsRoot, uploadRoot, sidecarRoot} {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			path := filepath.Join(root, e.Name())
+			if owned[e.Name()] || time.Since(lastModified(path)) < policy.OrphanAge {
+				continue
+			}
+			os.RemoveAll(path)
+			log.Printf("🧹 [Stream] Removed orphaned %s", path)
+		}
+	}
+}
+
+// lastModified returns the newest modification time anywhere under a
+// path, so a directory with a file still being written counts as fresh
+// however deep the file is (uploads live at <session>/<upload>/<file>,
+// and appending to a file doesn't touch its directories).
+func lastModified(path string) time.Time {
+	var newest time.Time
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest
+}
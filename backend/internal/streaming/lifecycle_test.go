@@ -0,0 +1,70 @@
+package streaming
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// age sets the modification time of paths to d ago.
+func age(t *testing.T, d time.Duration, paths ...string) {
+	t.Helper()
+	old := time.Now().Add(-d)
+	for _, p := range paths {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGCKeepsUploadsInProgress(t *testing.T) {
+	sm, _ := newTestManager(t, &fakeTranscoder{})
+	root := uploadRoot
+	uploadRoot = t.TempDir()
+	t.Cleanup(func() { uploadRoot = root })
+
+	// An upload still being appended to: writes touch the file only,
+	// not the session or upload directories above it
+	session := UploadDir("s1")
+	upload := filepath.Join(session, "upload-1")
+	file := filepath.Join(upload, "movie.mkv")
+	if err := os.MkdirAll(upload, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("part"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy := DefaultGCPolicy
+	age(t, 2*policy.OrphanAge, upload, session)
+
+	sm.collectGarbage(policy)
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("the GC deleted an upload in progress: %v", err)
+	}
+
+	// Once nothing under it has changed for OrphanAge, it's abandoned
+	age(t, 2*policy.OrphanAge, file, upload, session)
+	sm.collectGarbage(policy)
+	if _, err := os.Stat(session); !os.IsNotExist(err) {
+		t.Errorf("the GC kept an abandoned upload: %v", err)
+	}
+}
+
+func TestGCRemovesOrphanedOutput(t *testing.T) {
+	sm, _ := newTestManager(t, &fakeTranscoder{})
+
+	orphan := filepath.Join(hlsRoot, "gone", "720p")
+	if err := os.MkdirAll(orphan, 0755); err != nil {
+		t.Fatal(err)
+	}
+	segment := filepath.Join(orphan, "segment_000.ts")
+	os.WriteFile(segment, []byte("segment"), 0644)
+	policy := DefaultGCPolicy
+	age(t, 2*policy.OrphanAge, segment, orphan, filepath.Dir(orphan))
+
+	sm.collectGarbage(policy)
+	if _, err := os.Stat(filepath.Dir(orphan)); !os.IsNotExist(err) {
+		t.Errorf("the GC kept orphaned output: %v", err)
+	}
+}
@@ -0,0 +1,434 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+)
+
+const (
+	// llPartDuration is the length of an LL-HLS partial segment; four of
+	// them make a 2s segment.
+	llPartDuration    = 0.5
+	llPartsPerSegment = segmentDuration * 2
+	// llPartHoldBack is how far behind the newest part players start: the
+	// minimum the spec allows (two parts), about a second behind live.
+	llPartHoldBack = 2 * llPartDuration
+	// llPartsKept is how many complete segments keep their parts listed;
+	// the spec asks for at least the last three target durations.
+	llPartsKept = 3
+	// llPollInterval is how often ffmpeg's parts playlist is checked.
+	llPollInterval = 20 * time.Millisecond
+	// llBlockTimeout bounds blocking playlist reloads and part requests.
+	llBlockTimeout = 3 * segmentDuration * time.Second
+	// llPartsPlaylist is ffmpeg's own playlist, listing every part as a
+	// segment; clients get index.m3u8.
+	llPartsPlaylist = "parts.m3u8"
+)
+
+// ErrReloadTooFar rejects blocking reloads for segments that won't exist
+// for a while.
+var ErrReloadTooFar = errors.New("_HLS_msn is more than one segment past the live edge")
+
+// llFileName matches LL-HLS part and segment requests.
+var llFileName = regexp.MustCompile(`^(part|seg)_(\d+)\.m4s$`)
+
+// LiveSource is a capture device ffmpeg reads: -f Format -i URL.
+type LiveSource struct {
+	Format string `json:"format"` // e.g. "v4l2", "x11grab", "avfoundation"
+	URL    string `json:"url"`    // e.g. "/dev/video0", ":0.0", "1:0"
+}
+
+// captureFormats are the ffmpeg input devices clients may start a live
+// stream from: cameras, screens and microphones on the host.
+var captureFormats = map[string]bool{
+	"v4l2":         true, // Linux cameras
+	"x11grab":      true, // Linux screen
+	"alsa":         true,
+	"pulse":        true,
+	"avfoundation": true, // macOS cameras and screens
+	"dshow":        true, // Windows cameras
+	"gdigrab":      true, // Windows screen
+}
+
+// IsCaptureFormat reports whether format is a capture device StartLive
+// accepts from clients.
+func IsCaptureFormat(format string) bool {
+	return captureFormats[format]
+}
+
+// llPackager turns ffmpeg's output into Low-Latency HLS. ffmpeg cuts the
+// stream into 0.5s fMP4 fragments regardless of keyframes (each one a
+// "segment" in its own parts.m3u8); the packager advertises them as
+// partial segments, concatenates every four (starting at a forced
+// keyframe) into a full 2s segment for players without LL support, and
+// writes index.m3u8 with EXT-X-PART and EXT-X-PRELOAD-HINT. Every update
+// wakes blocked playlist and part requests.
+type llPackager struct {
+	dir  string // variant directory
+	init string // fMP4 init segment
+
+	mu       sync.Mutex
+	parts    []float64 // part i is part_<i>.m4s, this long
+	segments int       // complete segments written as seg_<n>.m4s
+	ended    bool
+	changed  chan struct{} // closed and replaced on every update
+
+	lastMod  time.Time
+	lastSize int64
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func newLLPackager(dir, init string) *llPackager {
+	return &llPackager{
+		dir:     dir,
+		init:    init,
+		changed: make(chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// llPartFile is the file name of part i.
+func llPartFile(i int) string {
+	return fmt.Sprintf("part_%05d.m4s", i)
+}
+
+// llOutputArgs make ffmpeg write 0.5s fMP4 parts; split_by_time cuts
+// them between keyframes.
+func llOutputArgs(outputDir, name string) []string {
+	return []string{
+		"-f", "hls",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", initSegmentName(name),
+		"-hls_time", strconv.FormatFloat(llPartDuration, 'f', -1, 64),
+		"-hls_list_size", "0",
+		"-hls_segment_filename", filepath.Join(outputDir, name, "part_%05d.m4s"),
+		"-hls_flags", "split_by_time+temp_file",
+		filepath.Join(outputDir, name, llPartsPlaylist),
+	}
+}
+
+// run follows ffmpeg's parts playlist until finish is called.
+func (p *llPackager) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(llPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			p.update(true)
+			return
+		case <-ticker.C:
+			p.update(false)
+		}
+	}
+}
+
+// finish picks up the last parts once ffmpeg has exited and ends the
+// playlist. Safe to call more than once.
+func (p *llPackager) finish() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.stopped
+}
+
+// update reads ffmpeg's parts playlist if it changed, writes the segments
+// that are complete and a fresh index.m3u8.
+func (p *llPackager) update(final bool) {
+	path := filepath.Join(p.dir, llPartsPlaylist)
+	fi, err := os.Stat(path)
+	if err != nil {
+		if final {
+			p.end()
+		}
+		return
+	}
+	if !final && fi.ModTime().Equal(p.lastMod) && fi.Size() == p.lastSize {
+		return
+	}
+	p.lastMod, p.lastSize = fi.ModTime(), fi.Size()
+	raw, err := readMediaPlaylist(path)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(raw.Durations) > len(p.parts) {
+		p.parts = append(p.parts, raw.Durations[len(p.parts):]...)
+	}
+	p.ended = final || raw.Ended
+	for (p.segments+1)*llPartsPerSegment <= len(p.parts) || (p.ended && p.segments*llPartsPerSegment < len(p.parts)) {
+		if err := p.writeSegment(p.segments); err != nil {
+			log.Printf("⚠️ [Stream] Failed to write LL-HLS segment %d: %v", p.segments, err)
+			break
+		}
+		p.segments++
+	}
+	if len(p.parts) > 0 {
+		if err := writeFileAtomic(filepath.Join(p.dir, "index.m3u8"), p.render()); err != nil && !final {
+			log.Printf("⚠️ [Stream] Failed to write LL-HLS playlist: %v", err)
+		}
+	}
+	p.notify()
+}
+
+// end marks the playlist ended without new parts (ffmpeg never wrote
+// any, or the output is gone).
+func (p *llPackager) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ended = true
+	p.notify()
+}
+
+// notify wakes everyone waiting for an update. The caller must hold p.mu.
+func (p *llPackager) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// writeSegment concatenates the parts of segment n; fMP4 fragments
+// appended to each other are a valid segment. The caller must hold p.mu.
+func (p *llPackager) writeSegment(n int) error {
+	path := filepath.Join(p.dir, OutputFormat{Segments: SegmentsFMP4}.segmentFile(n))
+	out, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	end := min((n+1)*llPartsPerSegment, len(p.parts))
+	for i := n * llPartsPerSegment; i < end; i++ {
+		in, err := os.Open(filepath.Join(p.dir, llPartFile(i)))
+		if err == nil {
+			_, err = io.Copy(out, in)
+			in.Close()
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(path + ".tmp")
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// render builds the LL-HLS media playlist. The caller must hold p.mu.
+func (p *llPackager) render() []byte {
+	segmentLength := func(n int) float64 {
+		var sum float64
+		for _, d := range p.parts[n*llPartsPerSegment : min((n+1)*llPartsPerSegment, len(p.parts))] {
+			sum += d
+		}
+		return sum
+	}
+	target := segmentDuration
+	for n := 0; n < p.segments; n++ {
+		target = max(target, int(math.Round(segmentLength(n))))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:9\n#EXT-X-TARGETDURATION:%d\n", target)
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", llPartHoldBack)
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", llPartDuration)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-MAP:URI=\"%s\"\n", p.init)
+
+	writeParts := func(first, end int) {
+		for i := first; i < end; i++ {
+			fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"%s\"", p.parts[i], llPartFile(i))
+			if i%llPartsPerSegment == 0 {
+				b.WriteString(",INDEPENDENT=YES") // starts at a forced keyframe
+			}
+			b.WriteString("\n")
+		}
+	}
+	format := OutputFormat{Segments: SegmentsFMP4}
+	for n := 0; n < p.segments; n++ {
+		if n >= p.segments-llPartsKept {
+			writeParts(n*llPartsPerSegment, min((n+1)*llPartsPerSegment, len(p.parts)))
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", segmentLength(n), format.segmentFile(n))
+	}
+	if p.ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+		return []byte(b.String())
+	}
+	writeParts(p.segments*llPartsPerSegment, len(p.parts))
+	fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%s\"\n", llPartFile(len(p.parts)))
+	return []byte(b.String())
+}
+
+// wait blocks until ready (called with p.mu held) is true, the playlist
+// has ended or llBlockTimeout passes. Returns ready's last answer.
+func (p *llPackager) wait(ready func() bool) bool {
+	timeout := time.NewTimer(llBlockTimeout)
+	defer timeout.Stop()
+	for {
+		p.mu.Lock()
+		ok, ended, changed := ready(), p.ended, p.changed
+		p.mu.Unlock()
+		if ok || ended {
+			return ok
+		}
+		select {
+		case <-changed:
+		case <-timeout.C:
+			return false
+		}
+	}
+}
+
+// waitForFile holds a request for a part or segment that is about to be
+// written, such as the one in EXT-X-PRELOAD-HINT. Requests for anything
+// further ahead aren't held and end as 404s.
+func (p *llPackager) waitForFile(name string) error {
+	m := llFileName.FindStringSubmatch(name)
+	if m == nil {
+		return nil
+	}
+	n, _ := strconv.Atoi(m[2])
+
+	p.mu.Lock()
+	var available, soon bool
+	if m[1] == "part" {
+		available, soon = n < len(p.parts), n < len(p.parts)+llPartsPerSegment
+	} else {
+		available, soon = n < p.segments, n <= p.segments
+	}
+	p.mu.Unlock()
+	if available || !soon {
+		return nil
+	}
+
+	ready := func() bool { return n < len(p.parts) }
+	if m[1] == "seg" {
+		ready = func() bool { return n < p.segments }
+	}
+	if !p.wait(ready) && !p.isEnded() {
+		return fmt.Errorf("%s not ready after %s", name, llBlockTimeout)
+	}
+	return nil
+}
+
+func (p *llPackager) isEnded() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ended
+}
+
+// StartLive streams a capture device as Low-Latency HLS. Live input isn't
+// probed (ffprobe would hold the device), so it is always encoded to a
+// single H.264/AAC variant with a keyframe at every segment start, which
+// is what lets the packager cut parts and segments blind.
+func (sm *StreamManager) StartLive(sessionID string, src LiveSource) (string, error) {
+	if src.Format == "" || src.URL == "" {
+		return "", fmt.Errorf("live source needs a format and a URL")
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if existing, exists := sm.streams[sessionID]; exists {
+		if isLive(existing.status.State) {
+			return PlaylistURL(sessionID), nil
+		}
+		sm.release(sessionID, existing)
+	}
+
+	plan := transcodePlan{
+		VideoMap:    "0:v:0?",
+		AudioMap:    "0:a:0?",
+		Input:       src.URL,
+		InputFormat: src.Format,
+		LowLatency:  true,
+	}
+	if _, err := sm.startLowLatency(sessionID, plan); err != nil {
+		return "", err
+	}
+	log.Printf("🔴 [Stream] Live %s %s started for session %s (LL-HLS)", src.Format, src.URL, sessionID)
+	return PlaylistURL(sessionID), nil
+}
+
+// startLowLatency runs plan, a live input, as a single-variant LL-HLS
+// stream and registers it. The caller must hold sm.mu and have released
+// the session's previous stream.
+func (sm *StreamManager) startLowLatency(sessionID string, plan transcodePlan) (*streamInfo, error) {
+	outputDir := filepath.Join(hlsRoot, sessionID)
+	layout := &mediaLayout{
+		Variants: buildLadder(sm.renditions, plan, nil)[:1],
+		Format:   OutputFormat{Segments: SegmentsFMP4},
+	}
+	variants := layout.outputs()
+	if err := os.MkdirAll(filepath.Join(outputDir, variants[0]), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output dir: %w", err)
+	}
+	if err := writeMasterPlaylist(outputDir, layout); err != nil {
+		os.RemoveAll(outputDir)
+		return nil, fmt.Errorf("failed to write master playlist: %w", err)
+	}
+
+	info := &streamInfo{
+		outputDir: outputDir,
+		layout:    layout,
+		variants:  variants,
+		startedAt: time.Now(),
+		ll:        newLLPackager(filepath.Join(outputDir, variants[0]), initSegmentName(variants[0])),
+		status: models.StreamStatus{
+			SessionID: sessionID,
+			State:     StreamStateStarting,
+			UpdatedAt: time.Now(),
+		},
+	}
+	if err := sm.startTranscode(sessionID, info, plan, nil); err != nil {
+		os.RemoveAll(outputDir)
+		return nil, err
+	}
+	go info.ll.run()
+	sm.streams[sessionID] = info
+
+	go sm.announce(sessionID, info, playlistReadyTimeout)
+	return info, nil
+}
+
+// WaitForLivePlaylist implements LL-HLS blocking playlist reload: it holds
+// a request for a low-latency playlist until it contains segment msn, or
+// part part of it when part >= 0. Other streams return right away.
+func (sm *StreamManager) WaitForLivePlaylist(sessionID string, msn, part int) error {
+	sm.mu.RLock()
+	info, exists := sm.streams[sessionID]
+	sm.mu.RUnlock()
+	if !exists || info.ll == nil {
+		return nil
+	}
+	p := info.ll
+
+	p.mu.Lock()
+	tooFar := msn > p.segments+1 // p.segments is the one in progress
+	p.mu.Unlock()
+	if tooFar {
+		return ErrReloadTooFar
+	}
+
+	ready := func() bool { return p.segments > msn }
+	if part >= 0 {
+		ready = func() bool { return len(p.parts) > msn*llPartsPerSegment+part }
+	}
+	if !p.wait(ready) && !p.isEnded() {
+		return fmt.Errorf("playlist didn't reach segment %d within %s", msn, llBlockTimeout)
+	}
+	return nil
+}
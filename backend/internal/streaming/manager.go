@@ -1,98 +1,677 @@
 package streaming
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
 )
 
+// playlistReadyTimeout is how long Start waits for ffmpeg's first playlist
+// before giving up on announcing the stream.
+const playlistReadyTimeout = 30 * time.Second
+
 // StreamManager manages active ffmpeg HLS streams per session.
 type StreamManager struct {
-	mu      sync.RWMutex
-	streams map[string]*streamInfo // sessionID → info
+	mu         sync.RWMutex
+	streams    map[string]*streamInfo // sessionID → info
+	bus        *events.Bus
+	renditions []Rendition
+	format     OutputFormat
+	cache      *TranscodeCache // nil disables caching
+	sfuAPI     sfuAPI          // videoCall SFU for bridges; no URL disables them
+
+	// Sessions being recorded, and where their recordings go (see
+	// recordings.go); "" disables recording
+	recording     map[string]*recordingState
+	recordingsDir string
+	onRecorded    func(*models.Recording) error
+
+	// Folders files may be streamed from; nil allows only uploads
+	roots *MediaRoots
+
+	// Told when a stream has played to its natural end (see
+	// SetOnFinished); nil if nobody listens. Finished streams are checked
+	// every playbackPoll
+	onFinished   func(sessionID string)
+	playbackPoll time.Duration
+
+	// Transcode slots and the queue for them (see scheduler.go)
+	jobs *jobScheduler
+	// Runs the encoder; ffmpeg unless a test swaps it (see transcoder.go)
+	transcoder Transcoder
 }
 
 type streamInfo struct {
-	cmd       *exec.Cmd
+	run       TranscodeRun // the running encode; nil for cache hits and queued streams
 	outputDir string
 	filePath  string
+	name      string       // of a remote input; "" for local files
+	media     *MediaInfo   // nil if ffprobe wasn't available
+	layout    *mediaLayout // nil for a cache entry without layout.json
+	variants  []string     // playlists ffmpeg writes, one subdirectory each
+	subsRun   TranscodeRun // subtitle extraction, if the input has text subtitles
+	subsDone  <-chan struct{}
+	seg       *segmenter // nil unless segments are generated on demand
+	status    models.StreamStatus
+	startedAt time.Time // when ffmpeg was launched; anchors a live DASH timeline
+	endedAt   time.Time // when ffmpeg finished or failed; drives GC
+	playingAt time.Time // when viewers first fetched a segment
+	cacheKey  string    // "" if the input isn't hashed (yet)
+	cacheable bool      // the output goes into the cache once it's finished and hashed
+	cached    bool      // outputDir is a pinned cache entry, not ours to delete
+	following bool      // ffmpeg reads an upload that was still in progress
+
+	// Poster and thumbnail generation, if the input has video
+	previewRun   TranscodeRun
+	previewsDone <-chan struct{}
+
+	// LL-HLS packaging; nil unless the stream is low-latency (StartLive)
+	ll *llPackager
+	// Where the publisher pushes; nil unless the stream is an ingest
+	ingest *Ingest
+	// The SFU bridge feeding ffmpeg; nil unless the stream is bridged
+	bridge *sfuBridge
+	// ffmpeg was interrupted to end a live input that went away
+	interrupted bool
+	// The output was kept as a recording already
+	preserved bool
+	// Recording copies of the output still running, and what release
+	// left for the last of them to do with the output
+	copies  int
+	discard func()
+	// The stream's transcode slot, or its place in the queue for one; nil
+	// for cache hits, which run no ffmpeg
+	job *jobTicket
+
+	// Tracks the host picked; served as the master's defaults and
+	// broadcast to viewers
+	selectedAudio    string
+	selectedSubtitle string
 }
 
-// NewStreamManager creates a new StreamManager.
-func NewStreamManager() *StreamManager {
+// NewStreamManager creates a new StreamManager that publishes
+// StreamStarted/StreamStopped on the given bus and encodes every stream
+// into the given ABR ladder (see ParseRenditions), packaged as format.
+// Finished transcodes are kept in cache, if one is given, and served
+// instantly next time.
+func NewStreamManager(bus *events.Bus, renditions []Rendition, format OutputFormat, cache *TranscodeCache) *StreamManager {
 	return &StreamManager{
-		streams: make(map[string]*streamInfo),
+		streams:    make(map[string]*streamInfo),
+		bus:        bus,
+		renditions: renditions,
+		format:     format,
+		cache:      cache,
+		recording:  make(map[string]*recordingState),
+		jobs:       newJobScheduler(bus, DefaultJobLimits),
+		transcoder: FFmpegTranscoder{},
+
+		playbackPoll: time.Second,
 	}
 }
 
-// Start begins HLS transcoding of the given file for a session.
-// Returns the relative URL path for the HLS playlist.
+// SetTranscoder replaces ffprobe and ffmpeg as the prober and encoder of
+// new streams.
+func (sm *StreamManager) SetTranscoder(t Transcoder) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.transcoder = t
+}
+
+// Probe reads a file's streams and duration with the manager's transcoder
+// (ffprobe unless SetTranscoder replaced it).
+func (sm *StreamManager) Probe(filePath string) (*MediaInfo, error) {
+	sm.mu.RLock()
+	transcoder := sm.transcoder
+	sm.mu.RUnlock()
+	return transcoder.Probe(filePath)
+}
+
+// SetJobLimits changes how many transcodes run at once and what each may
+// take (see JobLimits).
+func (sm *StreamManager) SetJobLimits(limits JobLimits) {
+	sm.jobs.setLimits(limits)
+}
+
+// PlaylistURL returns the relative URL of a session's master playlist.
+func PlaylistURL(sessionID string) string {
+	return fmt.Sprintf("/stream/%s/%s", sessionID, MasterPlaylistName)
+}
+
+// Start begins HLS transcoding of the given file for a session. The file
+// must be in the media roots (see SetMediaRoots) or one of the session's
+// uploads.
+// Returns the relative URL path for the master playlist.
 func (sm *StreamManager) Start(sessionID, filePath string) (string, error) {
+	filePath, err := sm.ResolveMedia(sessionID, filePath)
+	if err != nil {
+		return "", err
+	}
+	return sm.start(sessionID, filePath, "", nil)
+}
+
+// StartRemote begins HLS transcoding of a file another node serves over
+// HTTP (see library.Sharing). ffmpeg pulls it with range requests, so
+// seeking only fetches what it needs. name stands in for the file name,
+// which a URL doesn't carry. Remote inputs aren't cached.
+func (sm *StreamManager) StartRemote(sessionID, url, name string) (string, error) {
+	if !isRemoteInput(url) {
+		return "", fmt.Errorf("not an http(s) URL")
+	}
+	return sm.start(sessionID, url, name, nil)
+}
+
+// SetMediaRoots sets the folders clients may stream files from.
+func (sm *StreamManager) SetMediaRoots(roots *MediaRoots) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	sm.roots = roots
+}
+
+// ResolveMedia checks a client-supplied path against the media roots and
+// the session's uploads, and returns the file's canonical path.
+func (sm *StreamManager) ResolveMedia(sessionID, filePath string) (string, error) {
+	sm.mu.RLock()
+	roots := sm.roots
+	sm.mu.RUnlock()
+	return roots.Resolve(sessionID, filePath)
+}
 
-	// Already streaming for this session?
-	if _, exists := sm.streams[sessionID]; exists {
-		return fmt.Sprintf("/stream/%s/index.m3u8", sessionID), nil
+// StartFollowing begins transcoding an upload that is still being written
+// (see CanFollowUpload). ffmpeg reads the file through a pipe as bytes are
+// committed, so segments appear while the host is still uploading; the
+// playlists stay EVENT type until the upload and transcode complete.
+func (sm *StreamManager) StartFollowing(sessionID string, upload *GrowingFile) (string, error) {
+	return sm.start(sessionID, upload.Path(), "", upload)
+}
+
+// isRemoteInput reports whether ffmpeg reads the input over HTTP.
+func isRemoteInput(filePath string) bool {
+	return strings.HasPrefix(filePath, "http://") || strings.HasPrefix(filePath, "https://")
+}
+
+func (sm *StreamManager) start(sessionID, filePath, name string, growing *GrowingFile) (string, error) {
+	remote := isRemoteInput(filePath)
+	// Probe outside the lock; a missing ffprobe just means we guess from
+	// the extension like before. A growing file's headers are already there.
+	media, probeErr := sm.Probe(filePath)
+	if probeErr != nil {
+		log.Printf("⚠️ [Stream] Probe failed for %s, falling back to extension: %v", filePath, probeErr)
+	}
+	// Only a file hashed before can be found in the cache; hashing a new
+	// one takes too long to wait for, so that happens in the background
+	// and the output is cached once it's done (see cacheWhenHashed). A
+	// partial file can't be hashed until the upload is complete.
+	cacheable := sm.cache != nil && !remote
+	var cacheKey string
+	if cacheable && growing == nil {
+		cacheKey = sm.cache.Lookup(filePath, cacheProfile(sm.renditions, sm.format))
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	// Already streaming for this session? A finished or failed stream is
+	// replaced, keeping the input if it's being restarted. An upload isn't
+	// followed by someone else's stream, so that's an error
+	if existing, exists := sm.streams[sessionID]; exists {
+		if isLive(existing.status.State) {
+			if growing != nil {
+				return "", fmt.Errorf("session %s is already streaming", sessionID)
+			}
+			return PlaylistURL(sessionID), nil
+		}
+		if existing.filePath == filePath {
+			existing.filePath = ""
+		}
+		sm.release(sessionID, existing)
 	}
 
-	// Validate input file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// Validate input file exists; a remote one is checked by ffprobe
+	if _, err := os.Stat(filePath); os.IsNotExist(err) && !remote {
 		return "", fmt.Errorf("file not found: %s", filePath)
 	}
+	if remote && media == nil {
+		return "", fmt.Errorf("failed to read %s from its node: %v", name, probeErr)
+	}
 
-	// Find ffmpeg
-	ffmpegPath, err := findFFmpeg()
-	if err != nil {
-		return "", err
+	// Same content transcoded before? Serve it as a finished VOD
+	if cacheKey != "" {
+		if dir, ok := sm.cache.Acquire(cacheKey); ok {
+			return sm.startCached(sessionID, filePath, dir, cacheKey, media), nil
+		}
 	}
 
 	// Create temp output directory
-	outputDir := filepath.Join(os.TempDir(), "0xnet-hls", sessionID)
+	outputDir := filepath.Join(hlsRoot, sessionID)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create output dir: %w", err)
 	}
 
-	// Build and start ffmpeg
-	args := buildFFmpegArgs(filePath, outputDir)
-	cmd := exec.Command(ffmpegPath, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// Decide copy vs transcode and which ladder rungs fit this input
+	plan := planTranscode(filePath, media, sm.format.DASH)
+	if growing != nil {
+		plan.Input = "pipe:0"
+		plan.EventPlaylist = true
+	}
+	if remote {
+		// Ride out a peer's Wi-Fi dropping for a moment
+		plan.InputOptions = []string{"-reconnect", "1", "-reconnect_on_network_error", "1", "-reconnect_delay_max", "10"}
+	}
+	ladder := buildLadder(sm.renditions, plan, media)
+	if len(ladder) == 0 {
+		os.RemoveAll(outputDir)
+		return "", fmt.Errorf("no playable video or audio in %s", filepath.Base(filePath))
+	}
+	audio, subtitles := buildTracks(media, sm.format.DASH)
+	layout := &mediaLayout{Variants: ladder, Audio: audio, Subtitles: subtitles, Format: sm.format}
+	variants := layout.outputs()
+	dirs := variants
+	if len(subtitles) > 0 {
+		dirs = append(dirs[:len(dirs):len(dirs)], subtitleDir)
+	}
+	for _, name := range dirs {
+		if err := os.MkdirAll(filepath.Join(outputDir, name), 0755); err != nil {
+			os.RemoveAll(outputDir)
+			return "", fmt.Errorf("failed to create output dir: %w", err)
+		}
+	}
+	for _, sub := range subtitles {
+		if err := writeSubtitlePlaylist(outputDir, sub.ID, media.Duration); err != nil {
+			os.RemoveAll(outputDir)
+			return "", fmt.Errorf("failed to write subtitle playlist: %w", err)
+		}
+	}
+	if err := writeMasterPlaylist(outputDir, layout); err != nil {
+		os.RemoveAll(outputDir)
+		return "", fmt.Errorf("failed to write master playlist: %w", err)
+	}
+	log.Printf("🎬 [Stream] Plan for session %s: copyVideo=%v copyAudio=%v variants=%v subtitles=%d", sessionID, plan.CopyVideo, plan.CopyAudio, variants, len(subtitles))
 
-	log.Printf("🎬 [Stream] Starting ffmpeg for session %s: %s %v", sessionID, ffmpegPath, args)
+	info := &streamInfo{
+		outputDir:        outputDir,
+		filePath:         filePath,
+		name:             name,
+		media:            media,
+		layout:           layout,
+		variants:         variants,
+		cacheKey:         cacheKey,
+		cacheable:        cacheable,
+		following:        growing != nil,
+		startedAt:        time.Now(),
+		selectedAudio:    layout.defaultAudio(),
+		selectedSubtitle: layout.defaultSubtitle(),
+		status: models.StreamStatus{
+			SessionID: sessionID,
+			State:     StreamStateStarting,
+			UpdatedAt: time.Now(),
+		},
+	}
+	if media != nil {
+		info.status.Duration = media.Duration
+	}
 
-	if err := cmd.Start(); err != nil {
+	// Seekable transcodes are segmented on demand; everything else is one
+	// linear ffmpeg run
+	var err error
+	if info.seg = newSegmenter(plan, media, growing); info.seg != nil {
+		err = writeVODPlaylists(outputDir, variants, media.Duration, sm.format)
+	}
+	// ffmpeg starts once the stream gets a transcode slot
+	if err == nil {
+		info.job = sm.jobs.enqueue(sessionID, kindOf(layout))
+		if info.job.granted {
+			err = sm.launch(sessionID, info, plan, growing)
+		} else {
+			info.status.State = StreamStateQueued
+		}
+	}
+	if err != nil {
+		sm.jobs.release(info.job)
+		info.killSideJobs()
 		os.RemoveAll(outputDir)
-		return "", fmt.Errorf("failed to start ffmpeg: %w", err)
+		return "", err
 	}
+	sm.streams[sessionID] = info
 
-	sm.streams[sessionID] = &streamInfo{
-		cmd:       cmd,
-		outputDir: outputDir,
-		filePath:  filePath,
+	playlistURL := PlaylistURL(sessionID)
+	if info.status.State == StreamStateQueued {
+		go sm.launchWhenScheduled(sessionID, info, plan, growing)
+		return playlistURL, nil
+	}
+	log.Printf("🎬 [Stream] ffmpeg started, playlist will be at %s", playlistURL)
+
+	go sm.announce(sessionID, info, playlistReadyTimeout)
+	return playlistURL, nil
+}
+
+// launch starts a file stream's ffmpeg, and its side runs, once it has a
+// slot. The caller must hold sm.mu.
+func (sm *StreamManager) launch(sessionID string, info *streamInfo, plan transcodePlan, growing *GrowingFile) error {
+	sm.startSideJobs(sessionID, info, growing)
+	if info.seg != nil {
+		return sm.startSegmentJob(sessionID, info, 0)
+	}
+	return sm.startTranscode(sessionID, info, plan, growing)
+}
+
+// startSideJobs starts the runs that extract subtitles and previews from
+// a file stream's input. They share the stream's transcode slot, so a
+// queued stream starts none; failing to start one only costs that extra.
+// The caller must hold sm.mu.
+func (sm *StreamManager) startSideJobs(sessionID string, info *streamInfo, growing *GrowingFile) {
+	// Subtitles come from a separate demux-only run, so they are ready long
+	// before a transcode reaches the end of the file
+	if subtitles := info.layout.Subtitles; len(subtitles) > 0 {
+		var subsErr error
+		input, subsFollower := info.filePath, io.ReadCloser(nil)
+		if growing != nil {
+			input = "pipe:0"
+			subsFollower, subsErr = growing.Follow()
+		}
+		if subsErr == nil {
+			info.subsRun, info.subsDone, subsErr = extractSubtitles(sm.transcoder, sm.jobs.niceFor(jobTranscode), input, subsFollower, info.outputDir, subtitles)
+		}
+		if subsErr != nil {
+			log.Printf("⚠️ [Stream] Failed to start subtitle extraction for session %s: %v", sessionID, subsErr)
+		}
+	}
+
+	// Poster and thumbnails come from another side run over the keyframes
+	if previews := planPreviews(info.media); previews != nil {
+		var previewErr error
+		input, previewFollower := info.filePath, io.ReadCloser(nil)
+		if growing != nil {
+			input = "pipe:0"
+			previewFollower, previewErr = growing.Follow()
+		}
+		if previewErr == nil {
+			info.previewRun, info.previewsDone, previewErr = generatePreviews(sm.transcoder, sm.jobs.niceFor(jobTranscode), input, previewFollower, info.outputDir, previews)
+		}
+		if previewErr != nil {
+			log.Printf("⚠️ [Stream] Failed to start preview generation for session %s: %v", sessionID, previewErr)
+		}
+	}
+}
+
+// launchWhenScheduled waits for a queued stream's slot and starts it,
+// unless the stream was stopped or replaced while it waited.
+func (sm *StreamManager) launchWhenScheduled(sessionID string, info *streamInfo, plan transcodePlan, growing *GrowingFile) {
+	<-info.job.ready
+
+	sm.mu.Lock()
+	if sm.streams[sessionID] != info || info.status.State != StreamStateQueued {
+		sm.mu.Unlock()
+		return
+	}
+	sm.transition(info, StreamStateStarting)
+	if err := sm.launch(sessionID, info, plan, growing); err != nil {
+		if info.seg != nil {
+			info.seg.closed = true
+		}
+		sm.mu.Unlock()
+		info.killSideJobs()
+		sm.handleExit(sessionID, info, err)
+		return
+	}
+	sm.mu.Unlock()
+
+	log.Printf("🎬 [Stream] ffmpeg started, playlist will be at %s", PlaylistURL(sessionID))
+	sm.announce(sessionID, info, playlistReadyTimeout)
+}
+
+// announce publishes StreamStarted once ffmpeg has produced the playlists,
+// i.e. the first segment has landed.
+func (sm *StreamManager) announce(sessionID string, info *streamInfo, timeout time.Duration) {
+	if sm.WaitForPlaylist(sessionID, timeout) && sm.markReady(sessionID, info) {
+		log.Printf("📡 [Stream] Stream ready for session %s", sessionID)
+		sm.bus.Publish(sessionID, events.StreamStarted{PlaylistURL: PlaylistURL(sessionID), DASHURL: sm.DASHURL(sessionID)})
+		sm.publishTracks(sessionID)
+	} else {
+		log.Printf("⚠️ [Stream] Playlist never appeared for session %s, not announcing", sessionID)
+	}
+}
+
+// startTranscode runs ffmpeg once over the whole input. The caller must
+// hold sm.mu.
+func (sm *StreamManager) startTranscode(sessionID string, info *streamInfo, plan transcodePlan, growing *GrowingFile) error {
+	if info.job == nil {
+		info.job = sm.jobs.enqueue(sessionID, jobLive) // granted right away
+	}
+	plan.Threads = sm.jobs.getLimits().Threads
+	args := append(progressArgs(), buildFFmpegArgs(info.filePath, info.outputDir, plan, info.layout)...)
+	var follower io.ReadCloser
+	if growing != nil {
+		var err error
+		if follower, err = growing.Follow(); err != nil {
+			sm.jobs.release(info.job)
+			return fmt.Errorf("failed to open upload: %w", err)
+		}
 	}
 
-	// Wait for ffmpeg to finish in background (cleanup on completion)
+	log.Printf("🎬 [Stream] Starting ffmpeg for session %s: %v", sessionID, args)
+
+	run, err := sm.transcoder.Start(TranscodeJob{Args: args, Stdin: growing != nil, Nice: sm.jobs.niceFor(info.job.kind)})
+	if err != nil {
+		if follower != nil {
+			follower.Close()
+		}
+		sm.jobs.release(info.job) // the stream ends here
+		return err
+	}
+	info.run = run
+
+	if growing != nil {
+		go sm.feedUpload(sessionID, info, follower, run.Stdin())
+	}
+
+	// Follow ffmpeg's progress and errors, then report how it exited
 	go func() {
-		if err := cmd.Wait(); err != nil {
-			log.Printf("⚠️ [Stream] ffmpeg exited for session %s: %v", sessionID, err)
-		} else {
-			log.Printf("✅ [Stream] ffmpeg completed for session %s", sessionID)
+		var readers sync.WaitGroup
+		readers.Add(2)
+		go func() { defer readers.Done(); sm.readProgress(sessionID, info, run.Progress()) }()
+		go func() { defer readers.Done(); sm.readErrors(info, run.Log()) }()
+		readers.Wait() // pipes must be drained before Wait
+		waitErr := run.Wait()
+		if info.ingest != nil && sm.rearmIngest(sessionID, info, plan) {
+			return
+		}
+		if info.ll != nil {
+			info.ll.finish() // the last parts, then #EXT-X-ENDLIST
 		}
+		info.waitSideJobs() // the output may move into the cache next
+		sm.handleExit(sessionID, info, waitErr)
 	}()
+	return nil
+}
 
-	playlistURL := fmt.Sprintf("/stream/%s/index.m3u8", sessionID)
-	log.Printf("🎬 [Stream] ffmpeg started, playlist will be at %s", playlistURL)
-	return playlistURL, nil
+// feedUpload pipes a growing upload into ffmpeg's stdin. If the upload is
+// aborted, ffmpeg is killed so the truncated input ends as a failure
+// rather than a "finished" half movie.
+func (sm *StreamManager) feedUpload(sessionID string, info *streamInfo, upload io.ReadCloser, stdin io.WriteCloser) {
+	defer upload.Close()
+
+	_, err := io.Copy(stdin, upload)
+	stdin.Close()
+	if err == nil || !errors.Is(err, ErrUploadAborted) {
+		return // done, or ffmpeg went away (stopped) and the pipe broke
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.streams[sessionID] != info || !isLive(info.status.State) {
+		return
+	}
+	log.Printf("⚠️ [Stream] Upload for session %s was aborted, stopping ffmpeg", sessionID)
+	info.status.Errors = append(info.status.Errors, err.Error())
+	info.run.Stop()
+}
+
+// startCached registers a stream served straight from a cache entry: no
+// ffmpeg, already finished, announced right away. The caller must hold
+// sm.mu.
+func (sm *StreamManager) startCached(sessionID, filePath, dir, cacheKey string, media *MediaInfo) string {
+	layout, err := readLayout(dir)
+	if err != nil {
+		log.Printf("⚠️ [Stream] Cache entry for %s has no layout, serving its master as is: %v", filepath.Base(filePath), err)
+	}
+
+	now := time.Now()
+	info := &streamInfo{
+		layout:    layout,
+		outputDir: dir,
+		filePath:  filePath,
+		media:     media,
+		endedAt:   now,
+		cacheKey:  cacheKey,
+		cached:    true,
+		status: models.StreamStatus{
+			SessionID: sessionID,
+			State:     StreamStateFinished,
+			UpdatedAt: now,
+		},
+	}
+	if media != nil {
+		info.status.Duration = media.Duration
+		info.status.OutTime = media.Duration
+		info.status.Progress = 1
+	}
+	if layout != nil {
+		info.selectedAudio, info.selectedSubtitle = layout.defaultAudio(), layout.defaultSubtitle()
+	}
+	sm.streams[sessionID] = info
+	removeUpload(filePath)
+	go sm.watchPlayback(sessionID, info)
+
+	playlistURL := PlaylistURL(sessionID)
+	log.Printf("🗄️ [Stream] Cache hit for %s, serving session %s instantly", filepath.Base(filePath), sessionID)
+	started := events.StreamStarted{PlaylistURL: playlistURL}
+	if layout != nil && layout.Format.DASH {
+		started.DASHURL = fmt.Sprintf("/stream/%s/%s", sessionID, DASHManifestName)
+	}
+	sm.bus.Publish(sessionID, started)
+	if tracks := sm.tracksLocked(info); len(tracks.Audio) > 0 || len(tracks.Subtitles) > 0 {
+		sm.bus.Publish(sessionID, events.StreamTracks{Tracks: tracks})
+	}
+	return playlistURL
+}
+
+// storeInCache moves a finished stream's output into the cache and keeps
+// serving it from there. The caller must hold sm.mu.
+func (sm *StreamManager) storeInCache(info *streamInfo) {
+	if sm.cache == nil || info.cacheKey == "" {
+		return
+	}
+	dir, err := sm.cache.Put(info.cacheKey, info.outputDir, info.filePath)
+	if err != nil {
+		log.Printf("🗄️ [Stream] Not caching session %s: %v", info.status.SessionID, err)
+		return
+	}
+	info.outputDir = dir
+	info.cached = true
+}
+
+// cacheWhenHashed hashes the input of a finished stream, outside the lock,
+// and then caches its output and removes its upload, unless the stream was
+// released meanwhile (which removes the upload itself).
+func (sm *StreamManager) cacheWhenHashed(sessionID string, info *streamInfo, filePath string) {
+	key, err := sm.cache.Key(filePath, cacheProfile(sm.renditions, sm.format))
+	if err != nil {
+		log.Printf("⚠️ [Stream] Failed to hash %s, not caching: %v", filepath.Base(filePath), err)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.streams[sessionID] != info {
+		return
+	}
+	info.cacheKey = key
+	sm.storeInCache(info)
+	removeUpload(filePath)
 }
 
-// WaitForPlaylist blocks until the HLS playlist file exists on disk
-// (i.e. ffmpeg has written the first segment). Returns false if the
-// timeout is hit or the stream was stopped before the file appeared.
+// markReady moves a starting stream to ready once its playlists exist.
+// Returns true if the stream can be announced (a short file may already
+// have finished by then).
+func (sm *StreamManager) markReady(sessionID string, info *streamInfo) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.streams[sessionID] != info {
+		return false
+	}
+	if info.status.State == StreamStateStarting {
+		sm.transition(info, StreamStateReady)
+	}
+	return isPlayable(info.status.State)
+}
+
+// handleExit moves the stream to finished or failed when ffmpeg exits on
+// its own. A stream that was stopped is already gone from the map and
+// isn't reported. Finished output is kept as VOD for replay until the
+// garbage collector reclaims it; the upload it came from is no longer
+// needed.
+func (sm *StreamManager) handleExit(sessionID string, info *streamInfo, waitErr error) {
+	sm.mu.Lock()
+	if sm.streams[sessionID] != info {
+		sm.mu.Unlock()
+		return
+	}
+	if info.bridge != nil {
+		go info.bridge.close()
+	}
+	if info.interrupted {
+		waitErr = nil // we ended a live input; ffmpeg exits 255 on SIGINT
+	}
+	if waitErr == nil {
+		sm.transition(info, StreamStateFinished)
+		if info.status.Duration > 0 {
+			info.status.Progress = 1
+		}
+		for _, name := range info.variants {
+			if err := ensureEndList(filepath.Join(info.outputDir, name, "index.m3u8")); err != nil {
+				log.Printf("⚠️ [Stream] Failed to finalize %s playlist for session %s: %v", name, sessionID, err)
+			}
+		}
+		if info.cacheKey == "" && info.cacheable {
+			go sm.cacheWhenHashed(sessionID, info, info.filePath) // keeps the upload until then
+		} else {
+			sm.storeInCache(info)
+			removeUpload(info.filePath)
+		}
+		go sm.watchPlayback(sessionID, info)
+	} else {
+		sm.transition(info, StreamStateFailed)
+	}
+	sm.preserveLocked(sessionID, info)
+	status := copyStatus(&info.status)
+	sm.mu.Unlock()
+
+	if waitErr == nil {
+		log.Printf("✅ [Stream] ffmpeg completed for session %s", sessionID)
+		sm.bus.Publish(sessionID, events.StreamProgress{Status: status})
+		return
+	}
+
+	// Prefer ffmpeg's own last error over the bare exit status
+	reason := waitErr.Error()
+	if n := len(status.Errors); n > 0 {
+		reason = status.Errors[n-1]
+	}
+	log.Printf("⚠️ [Stream] ffmpeg failed for session %s: %s", sessionID, reason)
+	sm.bus.Publish(sessionID, events.StreamFailed{Error: reason, Status: status})
+}
+
+// WaitForPlaylist blocks until every variant playlist exists on disk
+// (i.e. ffmpeg has written the first segment of each rung). Returns false
+// if the timeout is hit or the stream was stopped before they appeared.
 func (sm *StreamManager) WaitForPlaylist(sessionID string, timeout time.Duration) bool {
 	sm.mu.RLock()
 	info, exists := sm.streams[sessionID]
@@ -101,19 +680,27 @@ func (sm *StreamManager) WaitForPlaylist(sessionID string, timeout time.Duration
 		return false
 	}
 
-	playlistPath := filepath.Join(info.outputDir, "index.m3u8")
 	deadline := time.Now().Add(timeout)
 
 	for time.Now().Before(deadline) {
-		if fi, err := os.Stat(playlistPath); err == nil && fi.Size() > 0 {
-			log.Printf("✅ [Stream] Playlist ready for session %s (%d bytes)", sessionID, fi.Size())
+		ready := true
+		for _, name := range info.variants {
+			fi, err := os.Stat(filepath.Join(info.outputDir, name, "index.m3u8"))
+			if err != nil || fi.Size() == 0 {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			log.Printf("✅ [Stream] Playlists ready for session %s (%d variants)", sessionID, len(info.variants))
 			return true
 		}
-		// Check if stream was stopped while waiting
+		// Check if stream was stopped or ffmpeg died while waiting
 		sm.mu.RLock()
-		_, stillActive := sm.streams[sessionID]
+		current, stillActive := sm.streams[sessionID]
+		failed := stillActive && current.status.State == StreamStateFailed
 		sm.mu.RUnlock()
-		if !stillActive {
+		if !stillActive || failed {
 			return false
 		}
 		time.Sleep(250 * time.Millisecond)
@@ -123,7 +710,8 @@ func (sm *StreamManager) WaitForPlaylist(sessionID string, timeout time.Duration
 	return false
 }
 
-// Stop kills the ffmpeg process for a session and cleans up temp files.
+// Stop kills the ffmpeg process for a session (if still running) and
+// cleans up its output and upload.
 func (sm *StreamManager) Stop(sessionID string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -132,25 +720,17 @@ func (sm *StreamManager) Stop(sessionID string) {
 	if !exists {
 		return
 	}
+	defer sm.bus.Publish(sessionID, events.StreamStopped{})
 
-	// Kill the ffmpeg process
-	if info.cmd.Process != nil {
-		log.Printf("🛑 [Stream] Stopping ffmpeg for session %s", sessionID)
-		info.cmd.Process.Kill()
-	}
-
-	// Remove temp HLS files
-	os.RemoveAll(info.outputDir)
-	delete(sm.streams, sessionID)
-	log.Printf("🧹 [Stream] Cleaned up session %s", sessionID)
+	sm.release(sessionID, info)
 }
 
-// IsStreaming returns true if a stream is active for the session.
+// IsStreaming returns true if ffmpeg is still producing the session's stream.
 func (sm *StreamManager) IsStreaming(sessionID string) bool {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	_, exists := sm.streams[sessionID]
-	return exists
+	info, exists := sm.streams[sessionID]
+	return exists && isLive(info.status.State)
 }
 
 // GetOutputDir returns the HLS output directory for a session.
@@ -163,17 +743,23 @@ func (sm *StreamManager) GetOutputDir(sessionID string) string {
 	return ""
 }
 
+// GetMediaInfo returns the probe result of the file a session is streaming,
+// or nil if nothing is streaming or the probe failed.
+func (sm *StreamManager) GetMediaInfo(sessionID string) *MediaInfo {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if info, ok := sm.streams[sessionID]; ok {
+		return info.media
+	}
+	return nil
+}
+
 // StopAll kills all active streams (used on shutdown).
 func (sm *StreamManager) StopAll() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	for sid, info := range sm.streams {
-		if info.cmd.Process != nil {
-			info.cmd.Process.Kill()
-		}
-		os.RemoveAll(info.outputDir)
-		log.Printf("🧹 [Stream] Shutdown cleanup: session %s", sid)
+		sm.release(sid, info)
 	}
-	sm.streams = make(map[string]*streamInfo)
 }
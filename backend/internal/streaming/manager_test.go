@@ -0,0 +1,428 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+)
+
+// newTestManager returns a manager running tc instead of ffprobe and
+// ffmpeg, with its output in a temporary directory, and a file in its
+// media roots. PATH is emptied so nothing real runs; unless tc describes
+// media, streams are planned from the file extension.
+func newTestManager(t *testing.T, tc Transcoder) (*StreamManager, string) {
+	t.Helper()
+	t.Setenv("PATH", "")
+	root := hlsRoot
+	hlsRoot = t.TempDir()
+	t.Cleanup(func() { hlsRoot = root })
+
+	renditions, err := ParseRenditions("source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewStreamManager(events.NewBus(), renditions, DefaultOutputFormat, nil)
+	sm.SetTranscoder(tc)
+	sm.SetJobLimits(JobLimits{MaxTranscodes: 100})
+
+	media := t.TempDir()
+	roots, err := ParseMediaRoots(media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.SetMediaRoots(roots)
+	file := filepath.Join(media, "movie.mkv")
+	if err := os.WriteFile(file, []byte("not really a movie"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sm.StopAll)
+	return sm, file
+}
+
+// waitFor polls cond until it holds, failing the test after a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartWaitForPlaylist(t *testing.T) {
+	tc := &fakeTranscoder{segments: 3, interval: 20 * time.Millisecond}
+	sm, file := newTestManager(t, tc)
+
+	url, err := sm.Start("s1", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != PlaylistURL("s1") {
+		t.Errorf("playlist URL = %q, want %q", url, PlaylistURL("s1"))
+	}
+	if !sm.WaitForPlaylist("s1", 5*time.Second) {
+		t.Fatal("playlist never appeared")
+	}
+	if _, err := os.Stat(filepath.Join(sm.GetOutputDir("s1"), MasterPlaylistName)); err != nil {
+		t.Errorf("no master playlist: %v", err)
+	}
+
+	waitFor(t, "the stream to finish", func() bool {
+		status := sm.GetStatus("s1")
+		return status != nil && status.State == StreamStateFinished
+	})
+	if status := sm.GetStatus("s1"); status.OutTime != 6 {
+		t.Errorf("out time = %v, want 6 (from the progress blocks)", status.OutTime)
+	}
+	if sm.IsStreaming("s1") {
+		t.Error("a finished stream is still streaming")
+	}
+	if n := len(tc.started()); n != 1 {
+		t.Errorf("%d runs started, want 1", n)
+	}
+}
+
+func TestStartWhileLiveKeepsTheRun(t *testing.T) {
+	tc := &fakeTranscoder{segments: 100, interval: 50 * time.Millisecond}
+	sm, file := newTestManager(t, tc)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := sm.Start("s1", file); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(tc.started()); n != 1 {
+		t.Errorf("%d runs started for one session, want 1", n)
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	tc := &fakeTranscoder{err: errors.New("no encoder")}
+	sm, file := newTestManager(t, tc)
+
+	if _, err := sm.Start("s1", file); err == nil {
+		t.Fatal("Start succeeded without an encoder")
+	}
+	if sm.GetStatus("s1") != nil {
+		t.Error("a failed start left a stream behind")
+	}
+	if _, err := os.Stat(filepath.Join(hlsRoot, "s1")); !os.IsNotExist(err) {
+		t.Errorf("a failed start left its output behind: %v", err)
+	}
+}
+
+func TestStartOutsideMediaRoots(t *testing.T) {
+	sm, _ := newTestManager(t, &fakeTranscoder{})
+	outside := filepath.Join(t.TempDir(), "elsewhere.mkv")
+	os.WriteFile(outside, nil, 0644)
+
+	if _, err := sm.Start("s1", outside); err == nil {
+		t.Fatal("started a file outside the media roots")
+	}
+}
+
+func TestStop(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1000, interval: 10 * time.Millisecond}
+	sm, file := newTestManager(t, tc)
+
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	if !sm.WaitForPlaylist("s1", 5*time.Second) {
+		t.Fatal("playlist never appeared")
+	}
+	outputDir := sm.GetOutputDir("s1")
+	sm.Stop("s1")
+
+	if sm.IsStreaming("s1") || sm.GetStatus("s1") != nil {
+		t.Error("the stream outlived Stop")
+	}
+	run := tc.started()[0]
+	if !run.stopped() {
+		t.Error("Stop didn't stop the run")
+	}
+	waitFor(t, "the run to exit", run.exited)
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("output still on disk after Stop: %v", err)
+	}
+
+	// The session can stream again
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	if !sm.WaitForPlaylist("s1", 5*time.Second) {
+		t.Fatal("playlist of the restarted stream never appeared")
+	}
+}
+
+func TestWaitForPlaylistReturnsOnStop(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1, interval: time.Hour} // never writes
+	sm, file := newTestManager(t, tc)
+
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan bool)
+	go func() { result <- sm.WaitForPlaylist("s1", time.Minute) }()
+	time.Sleep(50 * time.Millisecond)
+	sm.Stop("s1")
+
+	select {
+	case ok := <-result:
+		if ok {
+			t.Error("WaitForPlaylist reported a stopped stream ready")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForPlaylist kept waiting after Stop")
+	}
+	if sm.WaitForPlaylist("s1", time.Second) {
+		t.Error("WaitForPlaylist reported a session without a stream ready")
+	}
+}
+
+func TestWaitForPlaylistTimeout(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1, interval: time.Hour}
+	sm, file := newTestManager(t, tc)
+
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if sm.WaitForPlaylist("s1", 300*time.Millisecond) {
+		t.Error("WaitForPlaylist reported a playlist that was never written")
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Errorf("WaitForPlaylist waited %v for a 300ms timeout", waited)
+	}
+}
+
+func TestStopAllRace(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1000, interval: 5 * time.Millisecond}
+	sm, file := newTestManager(t, tc)
+
+	// Start, stop, wait on and query many sessions at once, and stop
+	// everything in the middle of it
+	var wg sync.WaitGroup
+	for i := range 20 {
+		sessionID := fmt.Sprintf("s%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				if _, err := sm.Start(sessionID, file); err != nil {
+					t.Error(err)
+					return
+				}
+				sm.WaitForPlaylist(sessionID, 20*time.Millisecond)
+				sm.GetStatus(sessionID)
+				sm.IsStreaming(sessionID)
+				if i%2 == 0 {
+					sm.Stop(sessionID)
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(20 * time.Millisecond)
+		sm.StopAll()
+	}()
+	wg.Wait()
+	sm.StopAll()
+
+	for i := range 20 {
+		if sessionID := fmt.Sprintf("s%d", i); sm.GetStatus(sessionID) != nil {
+			t.Errorf("%s still has a stream after StopAll", sessionID)
+		}
+	}
+	for _, run := range tc.started() {
+		waitFor(t, "every run to exit", run.exited)
+	}
+	entries, _ := os.ReadDir(hlsRoot)
+	if len(entries) > 0 {
+		t.Errorf("%d output directories left after StopAll", len(entries))
+	}
+}
+
+func TestQueuedStreamStartsWhenASlotFrees(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1000, interval: 10 * time.Millisecond}
+	sm, file := newTestManager(t, tc)
+	sm.SetJobLimits(JobLimits{MaxTranscodes: 1})
+
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Start("s2", file); err != nil {
+		t.Fatal(err)
+	}
+	status := sm.GetStatus("s2")
+	if status.State != StreamStateQueued || status.QueuePosition != 1 {
+		t.Fatalf("second stream is %s at position %d, want queued at 1", status.State, status.QueuePosition)
+	}
+	if n := len(tc.started()); n != 1 {
+		t.Fatalf("%d runs started with one slot, want 1", n)
+	}
+
+	sm.Stop("s1")
+	if !sm.WaitForPlaylist("s2", 5*time.Second) {
+		t.Fatal("the queued stream never started")
+	}
+	if n := len(tc.started()); n != 2 {
+		t.Errorf("%d runs started, want 2", n)
+	}
+}
+
+func TestStopQueuedStream(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1000, interval: 10 * time.Millisecond}
+	sm, file := newTestManager(t, tc)
+	sm.SetJobLimits(JobLimits{MaxTranscodes: 1})
+
+	sm.Start("s1", file)
+	sm.Start("s2", file)
+	sm.Stop("s2")
+	sm.Stop("s1")
+
+	// Nothing was waiting on the freed slot
+	time.Sleep(50 * time.Millisecond)
+	if n := len(tc.started()); n != 1 {
+		t.Errorf("%d runs started, want 1: the stopped stream ran anyway", n)
+	}
+	if _, err := sm.Start("s3", file); err != nil {
+		t.Fatal(err)
+	}
+	if status := sm.GetStatus("s3"); status.State == StreamStateQueued {
+		t.Error("a stopped queued stream kept its place")
+	}
+}
+
+func TestSideRunsWaitForTheSlot(t *testing.T) {
+	media := probedMovie()
+	media.Subtitles = []SubtitleTrack{{Index: 2, Codec: "subrip", Language: "en"}}
+	tc := &fakeTranscoder{segments: 1000, interval: 200 * time.Millisecond, media: media}
+	sm, file := newTestManager(t, tc)
+	sm.SetJobLimits(JobLimits{MaxTranscodes: 1})
+
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	// The segment job, subtitle extraction and previews
+	if n := len(tc.started()); n != 3 {
+		t.Fatalf("%d runs for a movie with subtitles, want 3", n)
+	}
+	if _, err := sm.Start("s2", file); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tc.started()); n != 3 {
+		t.Errorf("a queued stream started %d runs without a slot", n-3)
+	}
+
+	sm.Stop("s1")
+	waitFor(t, "the queued stream to start", func() bool {
+		status := sm.GetStatus("s2")
+		return status != nil && status.State != StreamStateQueued
+	})
+	if n := len(tc.started()); n != 6 {
+		t.Errorf("%d runs once the queued stream started, want 6", n)
+	}
+}
+
+func TestFinishedTranscodeIsServedFromTheCache(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1000, interval: 5 * time.Millisecond, media: probedMovie()}
+	sm, file := newTestManager(t, tc)
+	cache, err := NewTranscodeCache(t.TempDir(), 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.cache = cache
+
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	// It's hashed in the background and cached once that's done
+	waitFor(t, "the transcode to be cached", func() bool {
+		return filepath.Dir(sm.GetOutputDir("s1")) != hlsRoot
+	})
+	runs := len(tc.started())
+
+	if _, err := sm.Start("s2", file); err != nil {
+		t.Fatal(err)
+	}
+	if status := sm.GetStatus("s2"); status.State != StreamStateFinished {
+		t.Errorf("cache hit is %s, want finished right away", status.State)
+	}
+	if n := len(tc.started()); n != runs {
+		t.Errorf("a cache hit started %d runs", n-runs)
+	}
+	dir := sm.GetOutputDir("s2")
+	if dir != sm.GetOutputDir("s1") || filepath.Dir(dir) == hlsRoot {
+		t.Errorf("cache hit served from %s, want the cache entry %s", dir, sm.GetOutputDir("s1"))
+	}
+
+	// Stopping the sessions unpins the entry; it stays for the next one
+	sm.Stop("s1")
+	sm.Stop("s2")
+	if _, err := os.Stat(filepath.Join(dir, MasterPlaylistName)); err != nil {
+		t.Errorf("the cache entry went with its sessions: %v", err)
+	}
+}
+
+func TestOnFinishedWaitsForPlayback(t *testing.T) {
+	movie := probedMovie()
+	movie.Duration = 0.5
+	tc := &fakeTranscoder{segments: 1, interval: 5 * time.Millisecond, media: movie}
+	sm, file := newTestManager(t, tc)
+	sm.playbackPoll = 10 * time.Millisecond
+
+	finished := make(chan string, 2)
+	sm.SetOnFinished(func(sessionID string) { finished <- sessionID })
+
+	for _, sessionID := range []string{"s1", "s2"} {
+		if _, err := sm.Start(sessionID, file); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the transcode to finish", func() bool {
+			status := sm.GetStatus(sessionID)
+			return status != nil && status.State == StreamStateFinished
+		})
+	}
+
+	// Nobody has played either yet; s2 is stopped before anyone does
+	time.Sleep(100 * time.Millisecond)
+	if len(finished) != 0 {
+		t.Fatalf("%s reported finished before anyone played it", <-finished)
+	}
+	sm.Stop("s2")
+	sm.MarkPlaying("s1")
+	played := time.Now()
+
+	select {
+	case sessionID := <-finished:
+		if sessionID != "s1" {
+			t.Errorf("%s reported finished, want s1", sessionID)
+		}
+		if elapsed := time.Since(played); elapsed < 500*time.Millisecond {
+			t.Errorf("reported finished %v after playback started, before the 0.5s movie ended", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a played stream was never reported finished")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(finished) != 0 {
+		t.Errorf("%s reported finished as well", <-finished)
+	}
+}
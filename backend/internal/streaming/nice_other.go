@@ -0,0 +1,9 @@
+//go:build !unix
+
+package streaming
+
+// setNice is a no-op where there's no niceness (Windows has priority
+// classes instead); the thread cap still applies.
+func setNice(pid, nice int) error {
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package streaming
+
+import "syscall"
+
+// setNice sets the niceness of a process.
+func setNice(pid, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
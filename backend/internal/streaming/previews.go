@@ -0,0 +1,198 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// PosterName and ThumbnailsName are served next to the master playlist.
+	PosterName     = "poster.jpg"
+	ThumbnailsName = "thumbnails.vtt"
+	thumbnailDir   = "thumbs"
+
+	posterWidth    = 640
+	thumbnailWidth = 160
+	// Thumbnails are tiled into sprite sheets of 10x10
+	spriteColumns = 10
+	spriteRows    = 10
+	// At most 300 thumbnails (3 sheets), one every 10s or more
+	maxThumbnails        = 300
+	minThumbnailInterval = 10
+)
+
+// previewPlan describes the preview images of a stream: a poster frame
+// and a track of thumbnails for the seek bar.
+type previewPlan struct {
+	Duration      float64 // seconds, from the probe
+	PosterAt      float64 // seconds into the input
+	Interval      int     // seconds between thumbnails
+	Count         int     // thumbnails; 0 when the duration is unknown (poster only)
+	Width, Height int     // of one thumbnail
+}
+
+// planPreviews returns nil for inputs without video.
+func planPreviews(media *MediaInfo) *previewPlan {
+	if media == nil || len(media.Video) == 0 {
+		return nil
+	}
+	p := &previewPlan{Width: thumbnailWidth, Height: thumbnailWidth * 9 / 16}
+	if v := media.Video[0]; v.Width > 0 && v.Height > 0 {
+		p.Height = int(math.Round(float64(thumbnailWidth*v.Height)/float64(v.Width)/2)) * 2
+	}
+	if media.Duration > 0 {
+		p.Duration = media.Duration
+		// A tenth of the way in skips logos and black openings
+		p.PosterAt = math.Min(media.Duration/10, 120)
+		p.Interval = max(minThumbnailInterval, int(math.Ceil(media.Duration/maxThumbnails)))
+		p.Count = int(math.Ceil(media.Duration / float64(p.Interval)))
+	}
+	return p
+}
+
+// previewArgs decode only the input's keyframes, which is plenty for
+// images and far cheaper than the transcode running next to it. One
+// branch tiles a frame every Interval seconds into sprite sheets, the
+// other keeps the first frame past PosterAt.
+func previewArgs(input, outputDir string, p *previewPlan) []string {
+	args := []string{"-y", "-hide_banner", "-loglevel", "error", "-skip_frame", "nokey", "-i", input, "-an", "-sn", "-dn"}
+
+	poster := fmt.Sprintf("select='gte(t\\,%g)',scale=%d:-2", p.PosterAt, posterWidth)
+	if p.Count == 0 {
+		return append(args,
+			"-map", "0:v:0", "-vf", poster,
+			"-frames:v", "1", "-q:v", "3", "-f", "image2", "-update", "1",
+			filepath.Join(outputDir, PosterName+".part"),
+		)
+	}
+
+	graph := fmt.Sprintf("[0:v:0]split=2[s][p];[s]fps=1/%d,scale=%d:%d,tile=%dx%d[sprites];[p]%s[poster]",
+		p.Interval, p.Width, p.Height, spriteColumns, spriteRows, poster)
+	return append(args,
+		"-filter_complex", graph,
+		"-map", "[sprites]", "-q:v", "5",
+		filepath.Join(outputDir, thumbnailDir, "sprite_%03d.jpg"),
+		"-map", "[poster]", "-frames:v", "1", "-q:v", "3", "-f", "image2", "-update", "1",
+		filepath.Join(outputDir, PosterName+".part"),
+	)
+}
+
+// generatePreviews starts an ffmpeg that renders the poster and thumbnail
+// sprites. The poster is renamed into place and thumbnails.vtt written
+// once ffmpeg is done, so neither is ever served half-written. stdin feeds
+// a growing upload when input is "pipe:0". The returned channel is closed
+// once the files are in place; failures only leave previews out.
+func generatePreviews(tc Transcoder, nice int, input string, stdin io.ReadCloser, outputDir string, p *previewPlan) (TranscodeRun, <-chan struct{}, error) {
+	if p.Count > 0 {
+		if err := os.MkdirAll(filepath.Join(outputDir, thumbnailDir), 0755); err != nil {
+			if stdin != nil {
+				stdin.Close()
+			}
+			return nil, nil, err
+		}
+	}
+
+	run, err := tc.Start(TranscodeJob{Args: previewArgs(input, outputDir, p), Stdin: stdin != nil, Nice: nice})
+	if err != nil {
+		if stdin != nil {
+			stdin.Close()
+		}
+		return nil, nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if stdin != nil {
+			go func() {
+				io.Copy(run.Stdin(), stdin)
+				run.Stdin().Close()
+				stdin.Close()
+			}()
+		}
+		if err := waitQuietly(run); err != nil {
+			log.Printf("⚠️ [Stream] Preview generation failed: %v", err)
+			os.Remove(filepath.Join(outputDir, PosterName+".part"))
+			return
+		}
+		os.Rename(filepath.Join(outputDir, PosterName+".part"), filepath.Join(outputDir, PosterName))
+		if p.Count > 0 {
+			if err := writeThumbnailTrack(outputDir, p); err != nil {
+				log.Printf("⚠️ [Stream] Failed to write thumbnail track: %v", err)
+			}
+		}
+	}()
+	return run, done, nil
+}
+
+// RenderPoster writes the poster frame of a file to outPath as a JPEG
+// width pixels wide, for listings like the media library. Inputs without
+// video are an error.
+func RenderPoster(ctx context.Context, input, outPath string, media *MediaInfo, width int) error {
+	p := planPreviews(media)
+	if p == nil {
+		return fmt.Errorf("no video to take a poster from")
+	}
+	ffmpegPath, err := findFFmpeg()
+	if err != nil {
+		return err
+	}
+	part := outPath + ".part"
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-y", "-hide_banner", "-loglevel", "error",
+		"-skip_frame", "nokey", "-i", input, "-an", "-sn", "-dn",
+		"-map", "0:v:0", "-vf", fmt.Sprintf("select='gte(t\\,%g)',scale=%d:-2", p.PosterAt, width),
+		"-frames:v", "1", "-q:v", "4", "-f", "image2", "-update", "1", part,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(part)
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.Rename(part, outPath)
+}
+
+// writeThumbnailTrack writes the WebVTT thumbnail track: one cue per
+// thumbnail, pointing at its tile in a sprite sheet with a media fragment
+// (sprite_001.jpg#xywh=x,y,w,h). Cues past the last sheet ffmpeg wrote
+// are left out.
+func writeThumbnailTrack(outputDir string, p *previewPlan) error {
+	perSheet := spriteColumns * spriteRows
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; i < p.Count; i++ {
+		sheet := fmt.Sprintf("sprite_%03d.jpg", i/perSheet+1) // image2 numbers from 1
+		if _, err := os.Stat(filepath.Join(outputDir, thumbnailDir, sheet)); err != nil {
+			break
+		}
+		tile := i % perSheet
+		fmt.Fprintf(&b, "\n%s --> %s\n%s/%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(float64(i*p.Interval)), vttTimestamp(math.Min(float64((i+1)*p.Interval), p.Duration)),
+			thumbnailDir, sheet, tile%spriteColumns*p.Width, tile/spriteColumns*p.Height, p.Width, p.Height)
+	}
+	return writeFileAtomic(filepath.Join(outputDir, ThumbnailsName), []byte(b.String()))
+}
+
+// vttTimestamp formats seconds as a WebVTT timestamp (hh:mm:ss.ttt).
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// PosterURL returns the URL of a session's poster frame, or "" until it
+// exists (or if the stream has no video).
+func (sm *StreamManager) PosterURL(sessionID string) string {
+	dir := sm.GetOutputDir(sessionID)
+	if dir == "" {
+		return ""
+	}
+	if _, err := os.Stat(filepath.Join(dir, PosterName)); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("/stream/%s/%s", sessionID, PosterName)
+}
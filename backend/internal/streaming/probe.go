@@ -0,0 +1,264 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probeTimeout bounds a single ffprobe run; headers of local files are
+// read in well under a second, so anything slower is a broken input.
+const probeTimeout = 15 * time.Second
+
+// MediaInfo is what ffprobe found in an input file.
+type MediaInfo struct {
+	FormatName string          `json:"formatName"`
+	Title      string          `json:"title,omitempty"` // from the container tags
+	Duration   float64         `json:"duration"`        // seconds, 0 if unknown
+	Size       int64           `json:"size"`
+	BitRate    int64           `json:"bitRate"`
+	Video      []VideoTrack    `json:"video"`
+	Audio      []AudioTrack    `json:"audio"`
+	Subtitles  []SubtitleTrack `json:"subtitles"`
+}
+
+// VideoTrack describes one video stream.
+type VideoTrack struct {
+	Index     int     `json:"index"`
+	Codec     string  `json:"codec"`
+	Profile   string  `json:"profile,omitempty"`
+	Level     int     `json:"level,omitempty"`
+	PixFmt    string  `json:"pixFmt,omitempty"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	FrameRate float64 `json:"frameRate,omitempty"`
+	BitRate   int64   `json:"bitRate,omitempty"`
+	Default   bool    `json:"default"`
+}
+
+// AudioTrack describes one audio stream.
+type AudioTrack struct {
+	Index      int    `json:"index"`
+	Codec      string `json:"codec"`
+	Profile    string `json:"profile,omitempty"`
+	Channels   int    `json:"channels"`
+	SampleRate int    `json:"sampleRate"`
+	BitRate    int64  `json:"bitRate,omitempty"`
+	Language   string `json:"language,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Default    bool   `json:"default"`
+}
+
+// SubtitleTrack describes one subtitle stream.
+type SubtitleTrack struct {
+	Index    int    `json:"index"`
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Default  bool   `json:"default"`
+	Forced   bool   `json:"forced"`
+}
+
+// PrimaryVideo returns the default (or first) video track, or nil for
+// audio-only inputs.
+func (m *MediaInfo) PrimaryVideo() *VideoTrack {
+	for i := range m.Video {
+		if m.Video[i].Default {
+			return &m.Video[i]
+		}
+	}
+	if len(m.Video) > 0 {
+		return &m.Video[0]
+	}
+	return nil
+}
+
+// PrimaryAudio returns the default (or first) audio track, or nil.
+func (m *MediaInfo) PrimaryAudio() *AudioTrack {
+	for i := range m.Audio {
+		if m.Audio[i].Default {
+			return &m.Audio[i]
+		}
+	}
+	if len(m.Audio) > 0 {
+		return &m.Audio[0]
+	}
+	return nil
+}
+
+// findFFprobe locates ffprobe: on PATH, or next to the ffmpeg binary
+// (Windows builds ship both in the same bin directory).
+func findFFprobe() (string, error) {
+	if path, err := exec.LookPath("ffprobe"); err == nil {
+		return path, nil
+	}
+	ffmpegPath, err := findFFmpeg()
+	if err != nil {
+		return "", err
+	}
+	name := "ffprobe"
+	if runtime.GOOS == "windows" {
+		name = "ffprobe.exe"
+	}
+	candidate := filepath.Join(filepath.Dir(ffmpegPath), name)
+	if path, err := exec.LookPath(candidate); err == nil {
+		return path, nil
+	}
+	return "", fmt.Errorf("ffprobe not found — it ships with ffmpeg: https://ffmpeg.org/download.html")
+}
+
+// ProbeMedia runs ffprobe on a file and returns its streams and duration.
+func ProbeMedia(filePath string) (*MediaInfo, error) {
+	ffprobePath, err := findFFprobe()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		filePath,
+	).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("ffprobe failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	return parseProbeOutput(out)
+}
+
+// ffprobeOutput mirrors the parts of ffprobe's JSON output we use.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+		Tags       struct {
+			Title string `json:"title"`
+		} `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		Index        int    `json:"index"`
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Profile      string `json:"profile"`
+		Level        int    `json:"level"`
+		PixFmt       string `json:"pix_fmt"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		BitRate      string `json:"bit_rate"`
+		Channels     int    `json:"channels"`
+		SampleRate   string `json:"sample_rate"`
+		Disposition  struct {
+			Default     int `json:"default"`
+			Forced      int `json:"forced"`
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+		Tags struct {
+			Language string `json:"language"`
+			Title    string `json:"title"`
+		} `json:"tags"`
+	} `json:"streams"`
+}
+
+// parseProbeOutput converts ffprobe's JSON into a MediaInfo.
+func parseProbeOutput(data []byte) (*MediaInfo, error) {
+	var raw ffprobeOutput
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+
+	info := &MediaInfo{
+		FormatName: raw.Format.FormatName,
+		Title:      raw.Format.Tags.Title,
+		Duration:   parseFloat(raw.Format.Duration),
+		Size:       int64(parseFloat(raw.Format.Size)),
+		BitRate:    int64(parseFloat(raw.Format.BitRate)),
+		Video:      []VideoTrack{},
+		Audio:      []AudioTrack{},
+		Subtitles:  []SubtitleTrack{},
+	}
+
+	for _, s := range raw.Streams {
+		switch s.CodecType {
+		case "video":
+			// Embedded cover art shows up as a one-frame video stream
+			if s.Disposition.AttachedPic == 1 {
+				continue
+			}
+			info.Video = append(info.Video, VideoTrack{
+				Index:     s.Index,
+				Codec:     s.CodecName,
+				Profile:   s.Profile,
+				Level:     s.Level,
+				PixFmt:    s.PixFmt,
+				Width:     s.Width,
+				Height:    s.Height,
+				FrameRate: parseFrameRate(s.AvgFrameRate),
+				BitRate:   int64(parseFloat(s.BitRate)),
+				Default:   s.Disposition.Default == 1,
+			})
+		case "audio":
+			info.Audio = append(info.Audio, AudioTrack{
+				Index:      s.Index,
+				Codec:      s.CodecName,
+				Profile:    s.Profile,
+				Channels:   s.Channels,
+				SampleRate: int(parseFloat(s.SampleRate)),
+				BitRate:    int64(parseFloat(s.BitRate)),
+				Language:   s.Tags.Language,
+				Title:      s.Tags.Title,
+				Default:    s.Disposition.Default == 1,
+			})
+		case "subtitle":
+			info.Subtitles = append(info.Subtitles, SubtitleTrack{
+				Index:    s.Index,
+				Codec:    s.CodecName,
+				Language: s.Tags.Language,
+				Title:    s.Tags.Title,
+				Default:  s.Disposition.Default == 1,
+				Forced:   s.Disposition.Forced == 1,
+			})
+		}
+	}
+
+	return info, nil
+}
+
+// parseFloat parses ffprobe's numeric strings, treating "N/A" and
+// garbage as zero.
+func parseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// parseFrameRate parses ffprobe rationals like "24000/1001".
+func parseFrameRate(s string) float64 {
+	num, den, found := strings.Cut(s, "/")
+	if !found {
+		return parseFloat(s)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return parseFloat(num) / d
+}
@@ -0,0 +1,122 @@
+package streaming
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+)
+
+const (
+	// progressPublishInterval throttles stream-progress events; ffmpeg
+	// reports twice a second, which is more than viewers need.
+	progressPublishInterval = time.Second
+	// maxStatusErrors is how many ffmpeg error lines a status keeps.
+	maxStatusErrors = 10
+)
+
+// progressArgs makes ffmpeg write machine-readable progress to stdout and
+// prefix log lines with their level so errors can be picked out.
+func progressArgs() []string {
+	return []string{
+		"-hide_banner",
+		"-loglevel", "level+warning",
+		"-nostats",
+		"-progress", "pipe:1",
+	}
+}
+
+// readProgress parses ffmpeg's -progress key=value blocks from r, updating
+// the session's status after each block until the pipe closes.
+func (sm *StreamManager) readProgress(sessionID string, info *streamInfo, r io.Reader) {
+	var lastPublish time.Time
+	block := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		block[key] = value
+		if key != "progress" {
+			continue
+		}
+
+		// "progress" closes a block
+		sm.mu.Lock()
+		status := &info.status
+		if us, err := strconv.ParseInt(block["out_time_us"], 10, 64); err == nil && us > 0 {
+			status.OutTime = float64(us) / 1e6
+		}
+		status.Speed = parseFloat(strings.TrimSuffix(block["speed"], "x"))
+		status.FPS = parseFloat(block["fps"])
+		if status.Duration > 0 {
+			status.Progress = status.OutTime / status.Duration
+			if status.Progress > 1 {
+				status.Progress = 1
+			}
+		}
+		status.UpdatedAt = time.Now()
+		snapshot := copyStatus(status)
+		sm.mu.Unlock()
+
+		if value == "end" || time.Since(lastPublish) >= progressPublishInterval {
+			lastPublish = time.Now()
+			sm.bus.Publish(sessionID, events.StreamProgress{Status: snapshot})
+		}
+		block = make(map[string]string)
+	}
+}
+
+// readErrors copies ffmpeg's log to our stderr, as before, and keeps the
+// most recent error lines in the session's status.
+func (sm *StreamManager) readErrors(info *streamInfo, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Fprintln(os.Stderr, line)
+		if info.ingest != nil {
+			sm.checkPublisher(info, line)
+		}
+
+		if !strings.Contains(line, "[error]") && !strings.Contains(line, "[fatal]") {
+			continue
+		}
+		sm.mu.Lock()
+		info.status.Errors = append(info.status.Errors, strings.TrimSpace(line))
+		if n := len(info.status.Errors); n > maxStatusErrors {
+			info.status.Errors = info.status.Errors[n-maxStatusErrors:]
+		}
+		sm.mu.Unlock()
+	}
+}
+
+// GetStatus returns a snapshot of a session's stream status, or nil if the
+// session has no stream.
+func (sm *StreamManager) GetStatus(sessionID string) *models.StreamStatus {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	info, ok := sm.streams[sessionID]
+	if !ok {
+		return nil
+	}
+	status := copyStatus(&info.status)
+	if status.State == StreamStateQueued {
+		status.QueuePosition = sm.jobs.position(info.job)
+	}
+	return &status
+}
+
+// copyStatus returns a copy that doesn't share the Errors slice.
+func copyStatus(s *models.StreamStatus) models.StreamStatus {
+	c := *s
+	c.Errors = append([]string(nil), s.Errors...)
+	return c
+}
@@ -0,0 +1,216 @@
+package streaming
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// Queue item states.
+const (
+	QueueStatusProposed = "PROPOSED" // suggested by a member, waiting for the host
+	QueueStatusApproved = "APPROVED" // will be played when the queue reaches it
+	QueueStatusPlaying  = "PLAYING"  // currently being streamed
+)
+
+// QueueManager keeps an ordered media queue per session.
+// Members propose items, the host approves and reorders them, and
+// Next() hands out the following approved item when playback advances.
+// Every change publishes a QueueUpdated event with the full queue.
+type QueueManager struct {
+	mu     sync.RWMutex
+	queues map[string][]*models.QueueItem // sessionID → ordered items
+	bus    *events.Bus
+}
+
+// NewQueueManager creates a new QueueManager.
+func NewQueueManager(bus *events.Bus) *QueueManager {
+	return &QueueManager{
+		queues: make(map[string][]*models.QueueItem),
+		bus:    bus,
+	}
+}
+
+// Add appends a media item to the session queue. Items added with
+// approved=true (e.g. by the host) skip the proposal step.
+func (qm *QueueManager) Add(sessionID, filePath, title, proposedBy string, approved bool) *models.QueueItem {
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	}
+
+	item := &models.QueueItem{
+		ID:         uuid.New().String(),
+		SessionID:  sessionID,
+		Title:      title,
+		FilePath:   filePath,
+		ProposedBy: proposedBy,
+		Status:     QueueStatusProposed,
+		AddedAt:    time.Now(),
+	}
+	if approved {
+		item.Status = QueueStatusApproved
+	}
+
+	qm.mu.Lock()
+	qm.queues[sessionID] = append(qm.queues[sessionID], item)
+	qm.mu.Unlock()
+	qm.publish(sessionID)
+
+	copied := *item
+	return &copied
+}
+
+// Approve marks a proposed item as ready to be played.
+func (qm *QueueManager) Approve(sessionID, itemID string) error {
+	qm.mu.Lock()
+	found := false
+	for _, item := range qm.queues[sessionID] {
+		if item.ID == itemID {
+			if item.Status == QueueStatusProposed {
+				item.Status = QueueStatusApproved
+			}
+			found = true
+			break
+		}
+	}
+	qm.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("queue item not found: %s", itemID)
+	}
+	qm.publish(sessionID)
+	return nil
+}
+
+// Remove deletes an item from the session queue.
+func (qm *QueueManager) Remove(sessionID, itemID string) error {
+	qm.mu.Lock()
+	found := false
+	items := qm.queues[sessionID]
+	for i, item := range items {
+		if item.ID == itemID {
+			qm.queues[sessionID] = append(items[:i], items[i+1:]...)
+			found = true
+			break
+		}
+	}
+	qm.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("queue item not found: %s", itemID)
+	}
+	qm.publish(sessionID)
+	return nil
+}
+
+// Reorder moves the given items to the front of the queue in the given order.
+// Items not listed keep their relative order after the listed ones.
+func (qm *QueueManager) Reorder(sessionID string, itemIDs []string) error {
+	if err := qm.reorder(sessionID, itemIDs); err != nil {
+		return err
+	}
+	qm.publish(sessionID)
+	return nil
+}
+
+func (qm *QueueManager) reorder(sessionID string, itemIDs []string) error {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	items := qm.queues[sessionID]
+	byID := make(map[string]*models.QueueItem, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	reordered := make([]*models.QueueItem, 0, len(items))
+	placed := make(map[string]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		item, ok := byID[id]
+		if !ok {
+			return fmt.Errorf("queue item not found: %s", id)
+		}
+		if placed[id] {
+			continue
+		}
+		placed[id] = true
+		reordered = append(reordered, item)
+	}
+	for _, item := range items {
+		if !placed[item.ID] {
+			reordered = append(reordered, item)
+		}
+	}
+
+	qm.queues[sessionID] = reordered
+	return nil
+}
+
+// Next drops the currently playing item and promotes the first approved
+// item to PLAYING. Returns nil when nothing approved is left.
+func (qm *QueueManager) Next(sessionID string) *models.QueueItem {
+	defer qm.publish(sessionID)
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	remaining := make([]*models.QueueItem, 0, len(qm.queues[sessionID]))
+	for _, item := range qm.queues[sessionID] {
+		if item.Status != QueueStatusPlaying {
+			remaining = append(remaining, item)
+		}
+	}
+	qm.queues[sessionID] = remaining
+
+	for _, item := range remaining {
+		if item.Status == QueueStatusApproved {
+			item.Status = QueueStatusPlaying
+			copied := *item
+			return &copied
+		}
+	}
+	return nil
+}
+
+// HasNext returns true if the session queue has an approved item waiting.
+func (qm *QueueManager) HasNext(sessionID string) bool {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	for _, item := range qm.queues[sessionID] {
+		if item.Status == QueueStatusApproved {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns a snapshot of the session queue in play order.
+func (qm *QueueManager) List(sessionID string) []models.QueueItem {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	items := make([]models.QueueItem, 0, len(qm.queues[sessionID]))
+	for _, item := range qm.queues[sessionID] {
+		items = append(items, *item)
+	}
+	return items
+}
+
+// publish announces the current queue of a session on the event bus.
+func (qm *QueueManager) publish(sessionID string) {
+	qm.bus.Publish(sessionID, events.QueueUpdated{Items: qm.List(sessionID)})
+}
+
+// Clear drops the whole queue for a session (used when the session ends).
+func (qm *QueueManager) Clear(sessionID string) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	delete(qm.queues, sessionID)
+}
@@ -0,0 +1,476 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+)
+
+// DefaultRecordingsDir is where recordings are kept unless RECORDINGS_DIR
+// says otherwise.
+const DefaultRecordingsDir = "./data/recordings"
+
+// Recording kinds: a stream's HLS output, or a call participant's track
+// as the SFU wrote it.
+const (
+	RecordingHLS  = "hls"
+	RecordingWebM = "webm"
+	RecordingOgg  = "ogg"
+)
+
+// recordingState is a session being recorded.
+type recordingState struct {
+	createdBy string
+	room      string // SFU room recorded alongside; "" if none
+}
+
+// sfuRecordingFile is a track the SFU wrote, as it reports it.
+type sfuRecordingFile struct {
+	Name        string    `json:"name"`
+	Participant string    `json:"participant"`
+	Kind        string    `json:"kind"`
+	Size        int64     `json:"size"`
+	Duration    float64   `json:"duration"`
+	StartedAt   time.Time `json:"startedAt"`
+}
+
+// SetRecordings lets hosts record their sessions. Recorded streams are
+// copied under dir and handed to onSaved, which indexes them; a recording
+// onSaved rejects is deleted again.
+func (sm *StreamManager) SetRecordings(dir string, onSaved func(*models.Recording) error) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create recordings dir: %w", err)
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.recordingsDir = dir
+	sm.onRecorded = onSaved
+	return nil
+}
+
+// StartRecording starts recording a session: every stream that ends
+// while it runs, and the one playing when it stops, is kept as a
+// recording instead of being deleted. With a room, the SFU also writes
+// each participant's audio and video to files.
+func (sm *StreamManager) StartRecording(sessionID, createdBy, room string) error {
+	sm.mu.RLock()
+	enabled := sm.recordingsDir != ""
+	_, recording := sm.recording[sessionID]
+	sm.mu.RUnlock()
+	if !enabled {
+		return fmt.Errorf("recording is not enabled")
+	}
+	if recording {
+		return fmt.Errorf("session is already being recorded")
+	}
+
+	if room != "" {
+		if err := sm.sfuRecord(room, "/record", nil); err != nil {
+			return err
+		}
+	}
+
+	sm.mu.Lock()
+	if _, recording := sm.recording[sessionID]; recording {
+		sm.mu.Unlock()
+		if room != "" {
+			sm.sfuRecord(room, "/record/stop", nil)
+		}
+		return fmt.Errorf("session is already being recorded")
+	}
+	sm.recording[sessionID] = &recordingState{createdBy: createdBy, room: room}
+	if info, exists := sm.streams[sessionID]; exists {
+		info.preserved = false // recorded before; it is kept again, whole
+	}
+	sm.mu.Unlock()
+
+	log.Printf("⏺️ [Stream] Recording session %s", sessionID)
+	sm.bus.Publish(sessionID, events.RecordingStarted{StartedBy: createdBy, Call: room != ""})
+	return nil
+}
+
+// StopRecording stops recording a session. The stream playing now is
+// kept up to where it is, and the SFU's files are indexed.
+func (sm *StreamManager) StopRecording(sessionID string) error {
+	sm.mu.Lock()
+	state, recording := sm.recording[sessionID]
+	if !recording {
+		sm.mu.Unlock()
+		return fmt.Errorf("session is not being recorded")
+	}
+	if info, exists := sm.streams[sessionID]; exists {
+		sm.preserveLocked(sessionID, info)
+	}
+	delete(sm.recording, sessionID)
+	onSaved := sm.onRecorded
+	sm.mu.Unlock()
+
+	if state.room != "" {
+		var files []sfuRecordingFile
+		if err := sm.sfuRecord(state.room, "/record/stop", &files); err != nil {
+			log.Printf("⚠️ [Stream] Call recording of session %s lost: %v", sessionID, err)
+		}
+		for _, f := range files {
+			rec := &models.Recording{
+				ID:          uuid.New().String(),
+				SessionID:   sessionID,
+				Kind:        f.Kind,
+				Title:       callTrackTitle(f.Kind),
+				Participant: f.Participant,
+				Path:        f.Name,
+				Size:        f.Size,
+				Duration:    f.Duration,
+				CreatedBy:   state.createdBy,
+				CreatedAt:   f.StartedAt,
+			}
+			if err := onSaved(rec); err != nil {
+				log.Printf("⚠️ [Stream] Failed to index call recording %s: %v", f.Name, err)
+			}
+		}
+	}
+
+	log.Printf("⏹️ [Stream] Stopped recording session %s", sessionID)
+	sm.bus.Publish(sessionID, events.RecordingStopped{})
+	return nil
+}
+
+// IsRecording reports whether a session is being recorded.
+func (sm *StreamManager) IsRecording(sessionID string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	_, recording := sm.recording[sessionID]
+	return recording
+}
+
+// DeleteRecordingFiles removes what a recording consists of: its
+// directory, or its file on the SFU.
+func (sm *StreamManager) DeleteRecordingFiles(rec *models.Recording) error {
+	if rec.Kind == RecordingHLS {
+		dir, err := sm.RecordingDir(rec)
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(dir)
+	}
+
+	api, err := sm.sfu()
+	if err != nil {
+		return err
+	}
+	resp, err := api.do(http.MethodDelete, "/recordings/"+rec.Path, nil)
+	if err != nil {
+		return fmt.Errorf("SFU unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("SFU refused to delete the recording (%s)", resp.Status)
+	}
+	return nil
+}
+
+// OpenSFURecording downloads a call track from the SFU. The caller closes
+// the body.
+func (sm *StreamManager) OpenSFURecording(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	api, err := sm.sfu()
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := api.request(ctx, http.MethodGet, "/recordings/"+name, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := http.DefaultClient.Do(req) // no timeout: the file may be large
+	if err != nil {
+		return nil, 0, fmt.Errorf("SFU unreachable: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("recording not on the SFU (%s)", resp.Status)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// RecordingDir returns the directory of an HLS recording, making sure
+// the indexed path is one of ours before it is served or deleted.
+func (sm *StreamManager) RecordingDir(rec *models.Recording) (string, error) {
+	sm.mu.RLock()
+	root := sm.recordingsDir
+	sm.mu.RUnlock()
+	dir := filepath.Clean(rec.Path)
+	if rec.Kind != RecordingHLS || root == "" || filepath.Dir(dir) != filepath.Clean(root) {
+		return "", fmt.Errorf("not a recording directory")
+	}
+	return dir, nil
+}
+
+// sfuRecord starts or stops an SFU room recording; out, if given,
+// receives the response.
+func (sm *StreamManager) sfuRecord(room, path string, out any) error {
+	api, err := sm.sfu()
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(map[string]string{"room": room})
+	resp, err := api.do(http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("SFU unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		return fmt.Errorf("SFU refused: %s", strings.TrimSpace(msg.String()))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("bad SFU response: %w", err)
+		}
+	}
+	return nil
+}
+
+func callTrackTitle(kind string) string {
+	if kind == RecordingOgg {
+		return "Call audio"
+	}
+	return "Call video"
+}
+
+// preserveLocked keeps a stream's output as a recording if its session is
+// being recorded, once per stream. The copy can take a while (a whole
+// movie, across filesystems), so it runs in the background from the open
+// directory, which follows the output into the cache or aside; release
+// leaves the output alone until it is done. The caller must hold sm.mu.
+func (sm *StreamManager) preserveLocked(sessionID string, info *streamInfo) {
+	state := sm.recording[sessionID]
+	if state == nil || info.preserved {
+		return
+	}
+	info.preserved = true
+
+	root, err := os.OpenRoot(info.outputDir)
+	if err != nil {
+		log.Printf("⚠️ [Stream] Not recording stream of session %s: %v", sessionID, err)
+		return
+	}
+	rec := &models.Recording{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Kind:      RecordingHLS,
+		Title:     info.title(),
+		CreatedBy: state.createdBy,
+		CreatedAt: info.startedAt,
+	}
+	srcDir, dir, onSaved := info.outputDir, filepath.Join(sm.recordingsDir, rec.ID), sm.onRecorded
+	info.copies++
+
+	go func() {
+		defer sm.copyDone(info)
+		defer root.Close()
+		duration, size, err := copyRecording(root, srcDir, dir)
+		if err == nil {
+			rec.Path, rec.Size, rec.Duration = dir, size, duration
+			err = onSaved(rec)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			log.Printf("⚠️ [Stream] Not recording stream of session %s: %v", sessionID, err)
+			return
+		}
+		log.Printf("⏺️ [Stream] Recorded %.0fs of session %s as %s", duration, sessionID, rec.ID)
+	}()
+}
+
+// copyDone counts off a finished recording copy of a stream's output, and
+// discards the output if the stream was released meanwhile.
+func (sm *StreamManager) copyDone(info *streamInfo) {
+	sm.mu.Lock()
+	info.copies--
+	var discard func()
+	if info.copies == 0 {
+		discard, info.discard = info.discard, nil
+	}
+	sm.mu.Unlock()
+	if discard != nil {
+		discard()
+	}
+}
+
+// title names a stream's recording.
+func (info *streamInfo) title() string {
+	switch {
+	case info.ingest != nil:
+		return strings.ToUpper(info.ingest.Protocol) + " ingest"
+	case info.bridge != nil:
+		return "Call presenter"
+	case info.ll != nil:
+		return "Live capture"
+	case info.name != "":
+		return info.name
+	case info.filePath != "":
+		return filepath.Base(info.filePath)
+	}
+	return "Stream"
+}
+
+// copyRecording copies a stream's output directory, opened as root at
+// srcDir, into a recording: playlists finished as VOD over the segments
+// that exist, everything else as is, minus files that only matter while
+// ffmpeg runs. Returns the longest variant's duration and the total size.
+func copyRecording(root *os.Root, srcDir, dst string) (duration float64, size int64, err error) {
+	fsys := root.FS()
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // removed while we walked, e.g. a temp file
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !keptInRecording(d.Name()) {
+			return nil
+		}
+
+		if d.Name() == "index.m3u8" {
+			seconds, err := writeRecordedPlaylist(fsys, name, target)
+			if err != nil {
+				return err
+			}
+			duration = max(duration, seconds)
+		} else if err := preserveFile(root, srcDir, name, target); errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(target); err == nil {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if err == nil && duration == 0 {
+		err = fmt.Errorf("no segments yet")
+	}
+	return duration, size, err
+}
+
+// keptInRecording reports whether an output file belongs in a recording.
+// LL-HLS parts are dropped; their segments have the same media.
+func keptInRecording(name string) bool {
+	switch {
+	case name == llPartsPlaylist, name == "job.m3u8", name == bridgeSDPName:
+		return false
+	case strings.HasPrefix(name, "part_"), strings.HasSuffix(name, ".tmp"):
+		return false
+	}
+	return true
+}
+
+// writeRecordedPlaylist writes a variant playlist as a finished VOD
+// playlist listing the segments that exist. On-demand streams only have
+// the stretches someone watched; the jumps between them are marked as
+// discontinuities. LL-HLS tags are dropped. Returns the duration listed.
+func writeRecordedPlaylist(fsys fs.FS, src, dst string) (float64, error) {
+	data, err := fs.ReadFile(fsys, src)
+	if err != nil {
+		return 0, err
+	}
+
+	var out strings.Builder
+	out.WriteString("#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	var pending []string // tags of the next segment
+	var length, duration float64
+	inSegments, gap := false, false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line == "#EXTM3U",
+			strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE"),
+			strings.HasPrefix(line, "#EXT-X-ENDLIST"),
+			strings.HasPrefix(line, "#EXT-X-PART"), // also PART-INF
+			strings.HasPrefix(line, "#EXT-X-PRELOAD-HINT"),
+			strings.HasPrefix(line, "#EXT-X-SERVER-CONTROL"):
+			continue
+
+		case strings.HasPrefix(line, "#EXTINF:"):
+			inSegments = true
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			length, _ = strconv.ParseFloat(value, 64)
+			pending = append(pending, line)
+
+		case strings.HasPrefix(line, "#") && !inSegments:
+			out.WriteString(line + "\n")
+
+		case strings.HasPrefix(line, "#"):
+			pending = append(pending, line)
+
+		default:
+			if _, err := fs.Stat(fsys, path.Join(path.Dir(src), line)); err != nil {
+				gap = duration > 0
+				pending = pending[:0]
+				continue
+			}
+			if gap && (len(pending) == 0 || pending[0] != "#EXT-X-DISCONTINUITY") {
+				out.WriteString("#EXT-X-DISCONTINUITY\n")
+			}
+			for _, tag := range pending {
+				out.WriteString(tag + "\n")
+			}
+			out.WriteString(line + "\n")
+			duration += length
+			pending, gap = pending[:0], false
+		}
+	}
+	out.WriteString("#EXT-X-ENDLIST\n")
+	return duration, os.WriteFile(dst, []byte(out.String()), 0644)
+}
+
+// preserveFile puts an output file into a recording. Segments never
+// change once written, so they are hard-linked where the filesystem
+// allows; anything else (init segments are rewritten by every job) is
+// copied. The output may have moved since root was opened, and a new
+// stream of the session may have taken its place, so a link only stands
+// if it is to the same file.
+func preserveFile(root *os.Root, srcDir, name, dst string) error {
+	name = filepath.FromSlash(name)
+	if strings.HasPrefix(filepath.Base(name), "seg_") && os.Link(filepath.Join(srcDir, name), dst) == nil {
+		linked, err := os.Stat(dst)
+		if orig, rootErr := root.Stat(name); err == nil && rootErr == nil && os.SameFile(linked, orig) {
+			return nil
+		}
+		os.Remove(dst)
+	}
+	in, err := root.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,94 @@
+package streaming
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+)
+
+func TestRecordingCopiesInTheBackground(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1000, interval: 10 * time.Millisecond}
+	sm, file := newTestManager(t, tc)
+
+	saved := make(chan *models.Recording, 2)
+	indexing := make(chan struct{})
+	err := sm.SetRecordings(t.TempDir(), func(rec *models.Recording) error {
+		<-indexing // a slow database
+		saved <- rec
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.StartRecording("s1", "host", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	if !sm.WaitForPlaylist("s1", 5*time.Second) {
+		t.Fatal("playlist never appeared")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		sm.Stop("s1")
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop waited for the recording to be saved")
+	}
+
+	// The session streams again while its old output is still recorded
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	if !sm.WaitForPlaylist("s1", 5*time.Second) {
+		t.Fatal("playlist of the restarted stream never appeared")
+	}
+	if entries, _ := os.ReadDir(hlsRoot); len(entries) != 2 {
+		t.Errorf("%d output directories while recording, want the new one and the old one set aside", len(entries))
+	}
+
+	close(indexing)
+	var rec *models.Recording
+	select {
+	case rec = <-saved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the recording was never saved")
+	}
+	if rec.Duration <= 0 {
+		t.Errorf("recorded %vs", rec.Duration)
+	}
+	segments := 0
+	filepath.WalkDir(rec.Path, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && strings.HasPrefix(d.Name(), "seg_") {
+			segments++
+		}
+		return nil
+	})
+	if segments == 0 {
+		t.Error("no segments in the recording")
+	}
+	waitFor(t, "the old output to be deleted", func() bool {
+		entries, _ := os.ReadDir(hlsRoot)
+		return len(entries) == 1
+	})
+
+	// Keep the restarted stream too, before the temp dirs go
+	if err := sm.StopRecording("s1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-saved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the playing stream was never saved")
+	}
+}
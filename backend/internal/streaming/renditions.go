@@ -0,0 +1,260 @@
+package streaming
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultRenditions is the ladder used when HLS_RENDITIONS isn't set: the
+// source (remuxed when browser-safe), two smaller rungs for weak Wi-Fi and
+// an audio-only fallback.
+const DefaultRenditions = "source,720p,480p,audio"
+
+// MasterPlaylistName is the playlist clients open; it lists every variant.
+const MasterPlaylistName = "master.m3u8"
+
+// Rendition is one rung of the ABR ladder as configured.
+type Rendition struct {
+	Name         string // "source", "720p", "audio", ...
+	Height       int    // output height; 0 keeps the source size
+	VideoBitrate int    // kbit/s; 0 for source and audio-only
+	AudioBitrate int    // kbit/s
+	AudioOnly    bool
+}
+
+// ladderBitrates are the video bitrates (kbit/s) for the supported heights,
+// roughly Apple's HLS authoring recommendations for H.264.
+var ladderBitrates = map[int]int{
+	2160: 14000,
+	1440: 8000,
+	1080: 5000,
+	720:  2800,
+	480:  1400,
+	360:  800,
+	240:  400,
+}
+
+// ParseRenditions parses a comma-separated ladder such as
+// "source,1080p,720p,480p,audio". An empty spec yields DefaultRenditions.
+func ParseRenditions(spec string) ([]Rendition, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = DefaultRenditions
+	}
+
+	var renditions []Rendition
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch {
+		case name == "source":
+			renditions = append(renditions, Rendition{Name: name, AudioBitrate: 128})
+		case name == "audio":
+			renditions = append(renditions, Rendition{Name: name, AudioBitrate: 128, AudioOnly: true})
+		case strings.HasSuffix(name, "p"):
+			height, err := strconv.Atoi(strings.TrimSuffix(name, "p"))
+			if err != nil || ladderBitrates[height] == 0 {
+				return nil, fmt.Errorf("unsupported rendition %q", name)
+			}
+			renditions = append(renditions, Rendition{
+				Name:         name,
+				Height:       height,
+				VideoBitrate: ladderBitrates[height],
+				AudioBitrate: 128,
+			})
+		default:
+			return nil, fmt.Errorf("unsupported rendition %q", name)
+		}
+	}
+
+	if len(renditions) == 0 {
+		return nil, fmt.Errorf("no renditions in %q", spec)
+	}
+	return renditions, nil
+}
+
+// variant is a rendition resolved against a probed input: what ffmpeg
+// actually produces and what the master playlist advertises.
+type variant struct {
+	Rendition
+	CopyVideo bool
+	Width     int   // 0 if unknown (no probe)
+	OutHeight int   // 0 if unknown (no probe)
+	Bandwidth int64 // bits/s, peak estimate for the master playlist
+	Codecs    string
+}
+
+// buildLadder picks the variants to produce for an input. Rungs at or
+// above the source height are dropped (upscaling only wastes bandwidth),
+// audio-only inputs collapse to a single audio variant, and without probe
+// info only the source rung is kept since nothing else can be sized.
+func buildLadder(renditions []Rendition, plan transcodePlan, info *MediaInfo) []variant {
+	if plan.VideoMap == "" && plan.AudioMap == "" {
+		return nil // nothing playable in the input
+	}
+
+	var src *VideoTrack
+	var audioCodec string
+	if info != nil {
+		src = info.PrimaryVideo()
+		if a := info.PrimaryAudio(); a != nil {
+			audioCodec = a.Codec
+		}
+	}
+	hasAudio := plan.AudioMap != ""
+
+	audioCodecs := "mp4a.40.2" // AAC-LC, what we encode to
+	if plan.CopyAudio && audioCodec == "mp3" {
+		audioCodecs = "mp4a.40.34"
+	}
+
+	var ladder []variant
+	for _, r := range renditions {
+		switch {
+		case r.AudioOnly:
+			// Without a probe we can't tell whether there is audio at all
+			if !hasAudio || (info == nil && plan.VideoMap != "") {
+				continue
+			}
+			ladder = append(ladder, variant{
+				Rendition: r,
+				Bandwidth: int64(r.AudioBitrate) * 1000 * 11 / 10,
+				Codecs:    audioCodecs,
+			})
+
+		case plan.VideoMap == "":
+			// Audio-only input: video rungs make no sense
+
+		case r.Height == 0:
+			v := variant{Rendition: r, CopyVideo: plan.CopyVideo, Bandwidth: 5000000}
+			if src != nil {
+				v.Width, v.OutHeight = src.Width, src.Height
+				v.Bandwidth = sourceBandwidth(src, info, plan.CopyVideo)
+				v.Codecs = h264Codec(src.Profile, src.Level, plan.CopyVideo, src.Height)
+			}
+			if v.Codecs != "" && hasAudio {
+				v.Codecs += "," + audioCodecs
+			}
+			ladder = append(ladder, v)
+
+		default:
+			if src == nil || r.Height >= src.Height {
+				continue
+			}
+			v := variant{
+				Rendition: r,
+				Width:     scaledWidth(src.Width, src.Height, r.Height),
+				OutHeight: r.Height,
+				Bandwidth: int64(r.VideoBitrate+r.AudioBitrate) * 1000 * 11 / 10,
+				Codecs:    h264Codec("Main", 0, false, r.Height),
+			}
+			if hasAudio {
+				v.Codecs += "," + audioCodecs
+			}
+			ladder = append(ladder, v)
+		}
+	}
+
+	// A ladder of only smaller rungs (e.g. "720p" for a 480p file) would be
+	// empty; fall back to the source so there's always something to play.
+	if len(ladder) == 0 {
+		fallback := Rendition{Name: "source", AudioBitrate: 128}
+		if plan.VideoMap == "" {
+			fallback = Rendition{Name: "audio", AudioBitrate: 128, AudioOnly: true}
+		}
+		return buildLadder([]Rendition{fallback}, plan, info)
+	}
+	return ladder
+}
+
+// sourceBandwidth estimates the peak bitrate of the source rung. Copied
+// video keeps its own bitrate; re-encoded video at crf 23 lands near the
+// ladder bitrate for its height.
+func sourceBandwidth(src *VideoTrack, info *MediaInfo, copied bool) int64 {
+	var bps int64
+	switch {
+	case copied && src.BitRate > 0:
+		bps = src.BitRate + 128000
+	case copied && info.BitRate > 0:
+		bps = info.BitRate
+	default:
+		bps = int64(bitrateForHeight(src.Height)+128) * 1000
+	}
+	return bps * 12 / 10 // headroom for VBR peaks
+}
+
+// bitrateForHeight returns the ladder bitrate of the nearest rung at or
+// above the given height.
+func bitrateForHeight(height int) int {
+	best := 0
+	for h, kbps := range ladderBitrates {
+		if h >= height && (best == 0 || kbps < best) {
+			best = kbps
+		}
+	}
+	if best == 0 {
+		best = ladderBitrates[2160]
+	}
+	return best
+}
+
+// scaledWidth keeps the aspect ratio and rounds to an even width, as
+// ffmpeg's scale=-2:h does.
+func scaledWidth(srcW, srcH, h int) int {
+	if srcH == 0 {
+		return 0
+	}
+	w := (srcW*h + srcH/2) / srcH
+	return w + w%2
+}
+
+// h264Codec builds the RFC 6381 codec string (avc1.PPCCLL) for the master
+// playlist. Re-encoded rungs use the profile we ask libx264 for and a level
+// that covers their resolution.
+func h264Codec(profile string, level int, copied bool, height int) string {
+	if !copied {
+		profile = "Main"
+		level = 31
+		if height > 720 {
+			level = 40
+		}
+		if height > 1080 {
+			level = 51
+		}
+	}
+	if level == 0 {
+		level = 40
+	}
+
+	var pc string
+	switch profile {
+	case "Baseline":
+		pc = "4200"
+	case "Constrained Baseline":
+		pc = "42e0"
+	case "Main":
+		pc = "4d40"
+	default:
+		pc = "6400" // High
+	}
+	return fmt.Sprintf("avc1.%s%02x", pc, level)
+}
+
+// writeMasterPlaylist writes master.m3u8 listing every variant, best
+// first, with the file's default audio and subtitle tracks selected, and
+// saves the layout beside it. Sessions are served a master rendered with
+// the tracks their host picked (see StreamManager.MasterPlaylist); the
+// file on disk keeps the output directory playable on its own.
+func writeMasterPlaylist(outputDir string, layout *mediaLayout) error {
+	if err := writeLayout(outputDir, layout); err != nil {
+		return err
+	}
+	master := renderMasterPlaylist(layout, layout.defaultAudio(), layout.defaultSubtitle())
+	return writeFileAtomic(filepath.Join(outputDir, MasterPlaylistName), master)
+}
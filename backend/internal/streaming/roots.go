@@ -0,0 +1,141 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideMediaRoots rejects files that aren't in the media library.
+var ErrOutsideMediaRoots = errors.New("file is outside the media library")
+
+// defaultMediaFolders are the folders in the user's home used as media
+// roots when MEDIA_ROOTS isn't set, if they exist.
+var defaultMediaFolders = []string{"Videos", "Movies", "Music"}
+
+// MediaRoots are the folders hosts may stream files from. Clients name
+// files by path, so without them any LAN device could make ffmpeg read
+// anything the node can. Browser uploads are always allowed.
+type MediaRoots struct {
+	dirs []string // canonical: absolute, symlinks resolved
+}
+
+// ParseMediaRoots parses a list of folders separated like PATH entries
+// (":" on Unix, ";" on Windows), e.g. MEDIA_ROOTS="/srv/movies:/home/me/Videos".
+// An empty spec yields the user's Videos, Movies and Music folders.
+// Folders that don't exist are an error.
+func ParseMediaRoots(spec string) (*MediaRoots, error) {
+	var dirs []string
+	if strings.TrimSpace(spec) == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return &MediaRoots{}, nil
+		}
+		for _, name := range defaultMediaFolders {
+			if fi, err := os.Stat(filepath.Join(home, name)); err == nil && fi.IsDir() {
+				dirs = append(dirs, filepath.Join(home, name))
+			}
+		}
+	} else {
+		for _, dir := range filepath.SplitList(spec) {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	roots := &MediaRoots{}
+	for _, dir := range dirs {
+		canonical, err := canonicalPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("media root %s: %w", dir, err)
+		}
+		if fi, err := os.Stat(canonical); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("media root %s is not a directory", dir)
+		}
+		roots.dirs = append(roots.dirs, canonical)
+	}
+	return roots, nil
+}
+
+// Dirs returns the configured roots.
+func (m *MediaRoots) Dirs() []string {
+	if m == nil {
+		return nil
+	}
+	return append([]string(nil), m.dirs...)
+}
+
+// Resolve returns the canonical path of a regular file inside one of the
+// roots or the session's upload directory (none if sessionID is "").
+// Symlinks are resolved before the check, so a link inside a root can't
+// point out of it. A nil *MediaRoots only allows uploads.
+func (m *MediaRoots) Resolve(sessionID, path string) (string, error) {
+	canonical, err := canonicalPath(path)
+	if err != nil {
+		return "", fmt.Errorf("file not found: %s", filepath.Base(path))
+	}
+
+	allowed := false
+	if dir := UploadDir(sessionID); sessionID != "" && filepath.Dir(dir) == filepath.Clean(uploadRoot) {
+		if uploads, err := canonicalPath(dir); err == nil && within(uploads, canonical) {
+			// Spelled under uploadRoot, so the upload is cleaned up after
+			rel, _ := filepath.Rel(uploads, canonical)
+			canonical, allowed = filepath.Join(dir, rel), true
+		}
+	}
+	if m != nil {
+		for _, dir := range m.dirs {
+			allowed = allowed || within(dir, canonical)
+		}
+	}
+	if !allowed {
+		return "", ErrOutsideMediaRoots
+	}
+
+	fi, err := os.Stat(canonical)
+	if err != nil {
+		return "", fmt.Errorf("file not found: %s", filepath.Base(path))
+	}
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("not a regular file: %s", filepath.Base(path))
+	}
+	return canonical, nil
+}
+
+// ResolveDir returns the canonical path of a folder inside one of the
+// roots, e.g. one to share with other nodes.
+func (m *MediaRoots) ResolveDir(path string) (string, error) {
+	canonical, err := canonicalPath(path)
+	if err != nil {
+		return "", fmt.Errorf("folder not found: %s", path)
+	}
+	if fi, err := os.Stat(canonical); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("not a folder: %s", path)
+	}
+	if m != nil {
+		for _, dir := range m.dirs {
+			if within(dir, canonical) {
+				return canonical, nil
+			}
+		}
+	}
+	return "", ErrOutsideMediaRoots
+}
+
+// canonicalPath makes a path absolute and resolves its symlinks.
+func canonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// within reports whether path is dir or inside it; both are canonical.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
@@ -0,0 +1,33 @@
+package streaming
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveScopesUploadsToTheSession(t *testing.T) {
+	root := uploadRoot
+	uploadRoot = t.TempDir()
+	t.Cleanup(func() { uploadRoot = root })
+
+	upload := filepath.Join(UploadDir("s1"), "upload-1", "movie.mkv")
+	if err := os.MkdirAll(filepath.Dir(upload), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(upload, []byte("movie"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(UploadDir("s2"), 0755)
+
+	var roots *MediaRoots // uploads only
+	if path, err := roots.Resolve("s1", upload); err != nil || path != upload {
+		t.Errorf("Resolve of the session's own upload = %q, %v", path, err)
+	}
+	for _, sessionID := range []string{"s2", "", ".", "s2/.."} {
+		if _, err := roots.Resolve(sessionID, upload); !errors.Is(err, ErrOutsideMediaRoots) {
+			t.Errorf("session %q may stream another session's upload: %v", sessionID, err)
+		}
+	}
+}
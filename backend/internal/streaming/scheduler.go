@@ -0,0 +1,192 @@
+package streaming
+
+import (
+	"log"
+	"runtime"
+	"sync"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+)
+
+// JobLimits bound what ffmpeg may take from the machine.
+type JobLimits struct {
+	// MaxTranscodes is how many streams may run ffmpeg at once; more wait
+	// in a queue. Live inputs are never queued, but count.
+	MaxTranscodes int
+	// Nice is the niceness of ffmpeg runs over files (0 leaves it alone).
+	// Live inputs keep normal priority: they can't fall behind.
+	Nice int
+	// Threads caps the encoder and filter threads of each run; 0 lets
+	// ffmpeg use every core.
+	Threads int
+}
+
+// DefaultJobLimits leave half the cores to everything else: a libx264
+// transcode uses all of them given the chance.
+var DefaultJobLimits = JobLimits{
+	MaxTranscodes: max(1, runtime.NumCPU()/2),
+	Nice:          10,
+}
+
+// jobKind orders the queue: copy-remux jobs take seconds and little CPU,
+// so they go ahead of full transcodes.
+type jobKind int
+
+const (
+	jobLive jobKind = iota
+	jobRemux
+	jobTranscode
+)
+
+// jobScheduler hands out the transcode slots. A stream holds one from
+// the time its ffmpeg starts until it finishes, fails or is stopped; the
+// ffmpeg runs within it (on-demand segment jobs, seeks) don't queue again.
+type jobScheduler struct {
+	mu      sync.Mutex
+	limits  JobLimits
+	bus     *events.Bus
+	running int
+	queue   []*jobTicket // by kind, then arrival
+}
+
+// jobTicket is a stream's place in the scheduler.
+type jobTicket struct {
+	sessionID string
+	kind      jobKind
+	ready     chan struct{} // closed when granted or cancelled
+	granted   bool
+	done      bool
+	position  int // 1-based while queued, as last announced
+}
+
+func newJobScheduler(bus *events.Bus, limits JobLimits) *jobScheduler {
+	return &jobScheduler{bus: bus, limits: limits}
+}
+
+// enqueue asks for a slot. The ticket is granted right away if one is
+// free (always, for live inputs); otherwise it waits for release.
+func (s *jobScheduler) enqueue(sessionID string, kind jobKind) *jobTicket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &jobTicket{sessionID: sessionID, kind: kind, ready: make(chan struct{})}
+	if kind == jobLive || s.running < s.limits.MaxTranscodes {
+		s.grantLocked(t)
+		return t
+	}
+
+	i := len(s.queue)
+	for i > 0 && s.queue[i-1].kind > kind {
+		i--
+	}
+	s.queue = append(s.queue[:i], append([]*jobTicket{t}, s.queue[i:]...)...)
+	log.Printf("⏳ [Jobs] Session %s queued for a transcode slot (%d running, %d waiting)", sessionID, s.running, len(s.queue))
+	s.announceLocked()
+	return t
+}
+
+// release gives the slot back, or leaves the queue. Safe to call more
+// than once.
+func (s *jobScheduler) release(t *jobTicket) {
+	if t == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	if t.granted {
+		s.running--
+	} else {
+		for i, q := range s.queue {
+			if q == t {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+		close(t.ready)
+	}
+	s.dispatchLocked()
+}
+
+// position returns a ticket's place in the queue (1 is next), or 0 once
+// it isn't waiting.
+func (s *jobScheduler) position(t *jobTicket) int {
+	if t == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, q := range s.queue {
+		if q == t {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// setLimits changes the limits; a higher MaxTranscodes starts queued
+// streams right away.
+func (s *jobScheduler) setLimits(limits JobLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = limits
+	s.dispatchLocked()
+}
+
+func (s *jobScheduler) getLimits() JobLimits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limits
+}
+
+// niceFor returns the niceness of an ffmpeg run: lowered for runs over
+// files, left alone for live inputs.
+func (s *jobScheduler) niceFor(kind jobKind) int {
+	if kind == jobLive {
+		return 0
+	}
+	return s.getLimits().Nice
+}
+
+// dispatchLocked grants free slots to the head of the queue. The caller
+// must hold s.mu.
+func (s *jobScheduler) dispatchLocked() {
+	for len(s.queue) > 0 && s.running < s.limits.MaxTranscodes {
+		t := s.queue[0]
+		s.queue = s.queue[1:]
+		s.grantLocked(t)
+		log.Printf("▶️ [Jobs] Session %s got a transcode slot", t.sessionID)
+	}
+	s.announceLocked()
+}
+
+func (s *jobScheduler) grantLocked(t *jobTicket) {
+	t.granted = true
+	t.position = 0
+	s.running++
+	close(t.ready)
+}
+
+// announceLocked tells each waiting session its place when it changed.
+// Publishing never blocks, so it's fine under the lock.
+func (s *jobScheduler) announceLocked() {
+	for i, t := range s.queue {
+		if t.position != i+1 {
+			t.position = i + 1
+			s.bus.Publish(t.sessionID, events.StreamQueued{Position: i + 1, Running: s.running})
+		}
+	}
+}
+
+// kindOf classifies a file stream by its ladder: without any video
+// encoding it's a remux (audio is cheap to encode either way).
+func kindOf(layout *mediaLayout) jobKind {
+	for _, v := range layout.Variants {
+		if !v.AudioOnly && !v.CopyVideo {
+			return jobTranscode
+		}
+	}
+	return jobRemux
+}
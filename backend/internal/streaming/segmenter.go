@@ -0,0 +1,306 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// segmentDuration is the length of every on-demand segment, in seconds.
+	segmentDuration = 2
+	// seekAheadSegments is how far past the running job's head a requested
+	// segment may be and still be waited for rather than seeked to (10s).
+	seekAheadSegments = 5
+	// segmentWaitTimeout bounds how long a segment request blocks; a seek
+	// has to start ffmpeg and encode one segment within it.
+	segmentWaitTimeout = 30 * time.Second
+)
+
+// segmentName matches segment requests: <variant>/seg_<n>.ts (or .m4s),
+// and LL-HLS parts: <variant>/part_<n>.m4s
+var segmentName = regexp.MustCompile(`^([^/]+)/(?:seg|part)_(\d+)\.(?:ts|m4s)$`)
+
+// segmenter generates the segments of a transcoded stream on demand.
+// The variant playlists are written up front from the probed duration,
+// listing every 2s segment, so players see the whole movie and can seek
+// anywhere. ffmpeg then runs as a series of jobs, each encoding a range of
+// segments that aren't on disk yet; a request for a segment far from the
+// running job restarts ffmpeg there with -ss. Once a job ends, the next
+// gap is filled, until every segment exists and the stream is finished.
+type segmenter struct {
+	plan   transcodePlan
+	total  int         // segments per variant
+	job    *segmentJob // running job; nil between jobs
+	closed bool        // no more jobs: every segment exists, or ffmpeg failed
+}
+
+// segmentJob is one ffmpeg run of an on-demand stream.
+type segmentJob struct {
+	segmentRange
+	run  TranscodeRun
+	head int // first segment of the range not seen on disk yet
+}
+
+// segmentRange is the part of the input a job encodes: segments
+// [first, end) of total.
+type segmentRange struct {
+	first, end, total int
+}
+
+// start returns the input position of the range, in seconds.
+func (r *segmentRange) start() float64 {
+	return float64(r.first * segmentDuration)
+}
+
+// inputArgs seek the input to the range and stop at its end. -copyts keeps
+// the input's timestamps, so segments written by different jobs line up on
+// one timeline.
+func (r *segmentRange) inputArgs() []string {
+	args := []string{"-copyts"}
+	if r.first > 0 {
+		args = append(args, "-ss", strconv.Itoa(r.first*segmentDuration))
+	}
+	if r.end < r.total {
+		args = append(args, "-t", strconv.Itoa((r.end-r.first)*segmentDuration))
+	}
+	return args
+}
+
+// outputArgs number the segments from the start of the range. ffmpeg's
+// own playlist goes to job.m3u8; clients get the precomputed index.m3u8.
+// Every job rewrites the fMP4 init segment; it comes out the same.
+func (r *segmentRange) outputArgs(outputDir, name string, format OutputFormat) []string {
+	return append(format.segmentArgs(name),
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentDuration),
+		"-hls_list_size", "0",
+		"-start_number", strconv.Itoa(r.first),
+		"-hls_segment_filename", filepath.Join(outputDir, name, format.segmentPattern()),
+		"-hls_flags", "independent_segments+temp_file",
+		filepath.Join(outputDir, name, "job.m3u8"),
+	)
+}
+
+// newSegmenter returns a segmenter if the input can be segmented on
+// demand: a complete file of known duration whose video, if any, is
+// transcoded. Copied video can only be cut at the source's own keyframes,
+// which won't match a precomputed playlist, and remuxing is fast enough
+// to not need seeking anyway.
+func newSegmenter(plan transcodePlan, media *MediaInfo, growing *GrowingFile) *segmenter {
+	if growing != nil || media == nil || media.Duration <= 0 || plan.CopyVideo {
+		return nil
+	}
+	return &segmenter{
+		plan:  plan,
+		total: int(math.Ceil(media.Duration / segmentDuration)),
+	}
+}
+
+// writeVODPlaylists writes the complete playlist of every variant before
+// any segment exists.
+func writeVODPlaylists(outputDir string, variants []string, duration float64, format OutputFormat) error {
+	total := int(math.Ceil(duration / segmentDuration))
+
+	var segments strings.Builder
+	for i := 0; i < total; i++ {
+		length := math.Min(segmentDuration, duration-float64(i*segmentDuration))
+		fmt.Fprintf(&segments, "#EXTINF:%.3f,\n%s\n", length, format.segmentFile(i))
+	}
+	segments.WriteString("#EXT-X-ENDLIST\n")
+
+	for _, name := range variants {
+		var b strings.Builder
+		if format.fmp4() {
+			fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-MAP:URI=\"%s\"\n", segmentDuration, initSegmentName(name))
+		} else {
+			fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n", segmentDuration)
+		}
+		b.WriteString(segments.String())
+		if err := writeFileAtomic(filepath.Join(outputDir, name, "index.m3u8"), []byte(b.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasSegment reports whether segment i exists in every variant.
+func (info *streamInfo) hasSegment(i int) bool {
+	for _, name := range info.variants {
+		if _, err := os.Stat(filepath.Join(info.outputDir, name, info.layout.Format.segmentFile(i))); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// firstMissingSegment returns the first segment not yet in every variant,
+// or -1 when the stream is complete.
+func (info *streamInfo) firstMissingSegment() int {
+	for i := 0; i < info.seg.total; i++ {
+		if !info.hasSegment(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// startSegmentJob starts ffmpeg at segment first, replacing the running
+// job if there is one. The job stops at the next segment already on disk,
+// so nothing is encoded twice. The caller must hold sm.mu.
+func (sm *StreamManager) startSegmentJob(sessionID string, info *streamInfo, first int) error {
+	seg := info.seg
+	if old := seg.job; old != nil {
+		seg.job = nil // its exit is ignored
+		old.run.Stop()
+	}
+
+	end := first + 1
+	for end < seg.total && !info.hasSegment(end) {
+		end++
+	}
+	job := &segmentJob{segmentRange: segmentRange{first: first, end: end, total: seg.total}, head: first}
+
+	plan := seg.plan
+	plan.Segments = &job.segmentRange
+	plan.Threads = sm.jobs.getLimits().Threads
+	args := append(progressArgs(), buildFFmpegArgs(info.filePath, info.outputDir, plan, info.layout)...)
+	log.Printf("⏩ [Stream] Session %s: encoding segments %d–%d of %d: ffmpeg %v", sessionID, first, end-1, seg.total, args)
+
+	run, err := sm.transcoder.Start(TranscodeJob{Args: args, Nice: sm.jobs.niceFor(info.job.kind)})
+	if err != nil {
+		return err
+	}
+	job.run = run
+	seg.job = job
+	info.run = run
+
+	go func() {
+		var readers sync.WaitGroup
+		readers.Add(2)
+		go func() { defer readers.Done(); sm.readProgress(sessionID, info, run.Progress()) }()
+		go func() { defer readers.Done(); sm.readErrors(info, run.Log()) }()
+		readers.Wait() // pipes must be drained before Wait
+		sm.segmentJobExited(sessionID, info, job, run.Wait())
+	}()
+	return nil
+}
+
+// segmentJobExited moves on to the next gap when a job finishes, or ends
+// the stream once every segment exists or ffmpeg fails. Jobs replaced by a
+// seek, and jobs of stopped streams, are ignored.
+func (sm *StreamManager) segmentJobExited(sessionID string, info *streamInfo, job *segmentJob, waitErr error) {
+	sm.mu.Lock()
+	if sm.streams[sessionID] != info || info.seg.job != job {
+		sm.mu.Unlock()
+		return
+	}
+	info.seg.job = nil
+
+	if waitErr == nil {
+		gap := info.firstMissingSegment()
+		switch {
+		case gap < 0:
+			// Complete
+		case gap >= job.first && gap < job.end:
+			// ffmpeg covered it and didn't write it, typically a last
+			// segment the probed duration promised but the file lacks;
+			// retrying would loop forever
+			log.Printf("⚠️ [Stream] Session %s: segment %d was never written, finishing without it", sessionID, gap)
+		default:
+			waitErr = sm.startSegmentJob(sessionID, info, gap)
+			if waitErr == nil {
+				sm.mu.Unlock()
+				return
+			}
+		}
+	}
+	info.seg.closed = true
+	sm.mu.Unlock()
+
+	info.waitSideJobs() // the output may move into the cache next
+	sm.handleExit(sessionID, info, waitErr)
+}
+
+// advance moves the job's head past the segments it has written and
+// returns it. The caller must hold sm.mu.
+func (job *segmentJob) advance(info *streamInfo) int {
+	for job.head < job.end && info.hasSegment(job.head) {
+		job.head++
+	}
+	return job.head
+}
+
+// PrepareSegment makes sure a segment of an on-demand stream exists before
+// it is served: it waits for the running job if the segment is just ahead
+// of it, and otherwise restarts ffmpeg at the segment (a seek). Other
+// streams, and requests that aren't segments, return nil right away.
+func (sm *StreamManager) PrepareSegment(sessionID, name string) error {
+	m := segmentName.FindStringSubmatch(name)
+	if m == nil {
+		return nil
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return nil
+	}
+
+	sm.mu.Lock()
+	info, exists := sm.streams[sessionID]
+	if exists && info.ll != nil && isLive(info.status.State) {
+		sm.mu.Unlock()
+		return info.ll.waitForFile(filepath.Base(name))
+	}
+	if !exists || info.seg == nil || info.seg.closed || n >= info.seg.total || !isLive(info.status.State) {
+		sm.mu.Unlock()
+		return nil // served from disk as is
+	}
+	if info.status.State == StreamStateQueued {
+		sm.mu.Unlock()
+		return fmt.Errorf("stream is waiting for a transcode slot")
+	}
+	known := false
+	for _, v := range info.variants {
+		known = known || v == m[1]
+	}
+	known = known && filepath.Ext(name) == info.layout.Format.segmentExt()
+	path := filepath.Join(info.outputDir, m[1], filepath.Base(name))
+	if _, err := os.Stat(path); !known || err == nil {
+		sm.mu.Unlock()
+		return nil
+	}
+	if job := info.seg.job; job == nil || n < job.first || n >= job.end || n >= job.advance(info)+seekAheadSegments {
+		log.Printf("⏩ [Stream] Session %s: seek to segment %d", sessionID, n)
+		if err := sm.startSegmentJob(sessionID, info, n); err != nil {
+			sm.mu.Unlock()
+			return err
+		}
+	}
+	sm.mu.Unlock()
+
+	deadline := time.Now().Add(segmentWaitTimeout)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		sm.mu.RLock()
+		current, stillActive := sm.streams[sessionID]
+		state := info.status.State
+		sm.mu.RUnlock()
+		if !stillActive || current != info || state == StreamStateFailed {
+			return fmt.Errorf("stream ended before segment %d was ready", n)
+		}
+		if !isLive(state) {
+			return nil // finished (every segment exists, maybe in the cache now)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("segment %d not ready after %s", n, segmentWaitTimeout)
+}
@@ -0,0 +1,135 @@
+package streaming
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// probedMovie is a 20s HEVC movie with one AAC track: its video is
+// transcoded, so it is segmented on demand into 10 segments.
+func probedMovie() *MediaInfo {
+	return &MediaInfo{
+		FormatName: "matroska,webm",
+		Duration:   20,
+		Video:      []VideoTrack{{Index: 0, Codec: "hevc", Width: 1920, Height: 1080, Default: true}},
+		Audio:      []AudioTrack{{Index: 1, Codec: "aac", Channels: 2, SampleRate: 48000, Default: true}},
+	}
+}
+
+// segmentPath returns where segment n of a session's first variant goes.
+func segmentPath(sm *StreamManager, sessionID string, n int) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	info := sm.streams[sessionID]
+	return filepath.Join(info.outputDir, info.variants[0], info.layout.Format.segmentFile(n))
+}
+
+// segmentRequest names segment n of a session's first variant as a
+// player requests it.
+func segmentRequest(sm *StreamManager, sessionID string, n int) string {
+	path := segmentPath(sm, sessionID, n)
+	return filepath.Base(filepath.Dir(path)) + "/" + filepath.Base(path)
+}
+
+// hlsRuns returns the runs writing HLS, leaving out the side runs.
+func hlsRuns(tc *fakeTranscoder) []*fakeRun {
+	var runs []*fakeRun
+	for _, run := range tc.started() {
+		if playlist, _ := run.outputs(); playlist != "" {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+func TestSegmenterSeek(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1000, interval: 50 * time.Millisecond, media: probedMovie()}
+	sm, file := newTestManager(t, tc)
+
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	sm.mu.RLock()
+	seg := sm.streams["s1"].seg
+	sm.mu.RUnlock()
+	if seg == nil || seg.total != 10 {
+		t.Fatalf("segmenter = %+v, want 10 segments on demand", seg)
+	}
+
+	// Far ahead of the first job: ffmpeg restarts there
+	if err := sm.PrepareSegment("s1", segmentRequest(sm, "s1", 8)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(segmentPath(sm, "s1", 8)); err != nil {
+		t.Fatalf("segment 8 isn't there after PrepareSegment: %v", err)
+	}
+	runs := hlsRuns(tc)
+	if len(runs) != 2 {
+		t.Fatalf("%d runs after a seek, want 2", len(runs))
+	}
+	if !runs[0].stopped() {
+		t.Error("the seek left the first job running")
+	}
+	seek := runs[1]
+	if i := indexOf(seek.args, "-ss"); i < 0 || seek.args[i+1] != "16" {
+		t.Errorf("seek job doesn't start at 16s: %v", seek.args)
+	}
+	if i := indexOf(seek.args, "-start_number"); i < 0 || seek.args[i+1] != "8" {
+		t.Errorf("seek job doesn't number from segment 8: %v", seek.args)
+	}
+
+	// Once the seek job reaches the end, the gap behind it is filled
+	waitFor(t, "the stream to finish", func() bool {
+		status := sm.GetStatus("s1")
+		return status != nil && status.State == StreamStateFinished
+	})
+	for n := range 10 {
+		if _, err := os.Stat(segmentPath(sm, "s1", n)); err != nil {
+			t.Errorf("segment %d missing from the finished stream", n)
+		}
+	}
+	if _, err := os.Stat(segmentPath(sm, "s1", 10)); err == nil {
+		t.Error("a segment past the probed duration was written")
+	}
+	// ...by jobs that stop where the seek job began
+	for _, run := range hlsRuns(tc)[2:] {
+		first, seconds := run.intArg("-start_number", 0), run.intArg("-t", 0)
+		if seconds == 0 || first+seconds/2 > 8 {
+			t.Errorf("gap job encodes segments the seek wrote: %v", run.args)
+		}
+	}
+}
+
+func TestSegmenterStop(t *testing.T) {
+	tc := &fakeTranscoder{segments: 1000, interval: 20 * time.Millisecond, media: probedMovie()}
+	sm, file := newTestManager(t, tc)
+
+	if _, err := sm.Start("s1", file); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.PrepareSegment("s1", segmentRequest(sm, "s1", 6)); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := sm.GetOutputDir("s1")
+	sm.Stop("s1")
+
+	started := len(tc.started())
+	for _, run := range tc.started() {
+		if !run.stopped() && !run.exited() {
+			t.Error("a segment job outlived Stop")
+		}
+		waitFor(t, "every run to exit", run.exited)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := len(tc.started()); n != started {
+		t.Errorf("%d jobs started after Stop", n-started)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("output still on disk after Stop: %v", err)
+	}
+	if err := sm.PrepareSegment("s1", "source/seg_007.ts"); err != nil {
+		t.Errorf("PrepareSegment of a stopped stream: %v", err)
+	}
+}
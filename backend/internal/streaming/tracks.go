@@ -0,0 +1,596 @@
+package streaming
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// audioGroupID and subtitleGroupID name the EXT-X-MEDIA groups.
+	audioGroupID    = "audio"
+	subtitleGroupID = "subs"
+	// subtitleDir holds every WebVTT track and its one-segment playlist.
+	subtitleDir = "subs"
+	// layoutName records the layout of an output directory next to the
+	// playlists, so a cache hit can be served without re-probing.
+	layoutName = "layout.json"
+	// MaxSubtitleSize bounds sidecar subtitle uploads; a feature film's
+	// SRT is well under 1 MB.
+	MaxSubtitleSize = 10 << 20
+)
+
+// textSubtitleCodecs are the embedded subtitle formats ffmpeg converts to
+// WebVTT. Bitmap subtitles (PGS, VobSub, DVB) would need OCR or burning in
+// and are skipped.
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"ass":      true,
+	"ssa":      true,
+	"mov_text": true,
+	"webvtt":   true,
+	"text":     true,
+}
+
+// trackSource is an alternate rendition plus the input stream it is made
+// from; Stream is -1 for sidecar subtitles.
+type trackSource struct {
+	models.MediaTrack
+	Stream int  `json:"-"`
+	Copy   bool `json:"-"` // audio that is AAC already and is remuxed as is
+}
+
+// mediaLayout is everything master.m3u8 lists: the variants of the ladder,
+// the alternate audio group (only when the input has several audio
+// tracks, or for DASH; otherwise audio is muxed into each variant), the
+// subtitles and how the segments are packaged.
+type mediaLayout struct {
+	Variants  []variant     `json:"variants"`
+	Audio     []trackSource `json:"audio"`
+	Subtitles []trackSource `json:"subtitles"`
+	Format    OutputFormat  `json:"format"` // zero (TS) for entries cached before formats existed
+}
+
+// buildTracks turns the probed audio and text subtitle streams into
+// alternate renditions with unique names. separateAudio puts even a
+// single audio track in its own rendition, as DASH players don't play
+// audio muxed into the video.
+func buildTracks(info *MediaInfo, separateAudio bool) (audio, subtitles []trackSource) {
+	if info == nil {
+		return nil, nil
+	}
+
+	names := make(map[string]bool)
+	if len(info.Audio) > 1 || separateAudio && len(info.Audio) > 0 {
+		for i, a := range info.Audio {
+			lang := languageTag(a.Language)
+			copyAudio := a.Codec == "aac"
+			channels := a.Channels
+			if !copyAudio {
+				channels = min(channels, 2) // audioEncodeArgs downmixes
+			}
+			audio = append(audio, trackSource{
+				MediaTrack: models.MediaTrack{
+					ID:       fmt.Sprintf("audio_%d", i),
+					Language: lang,
+					Name:     uniqueName(names, trackName(a.Title, lang, "Audio", i)),
+					Channels: channels,
+					Default:  a.Default,
+				},
+				Stream: a.Index,
+				Copy:   copyAudio,
+			})
+		}
+	}
+
+	names = make(map[string]bool)
+	for _, s := range info.Subtitles {
+		if !textSubtitleCodecs[s.Codec] {
+			continue
+		}
+		lang := languageTag(s.Language)
+		name := trackName(s.Title, lang, "Subtitles", len(subtitles))
+		if s.Forced && s.Title == "" {
+			name += " (forced)"
+		}
+		subtitles = append(subtitles, trackSource{
+			MediaTrack: models.MediaTrack{
+				ID:       fmt.Sprintf("sub_%d", len(subtitles)),
+				Language: lang,
+				Name:     uniqueName(names, name),
+				Default:  s.Default,
+				Forced:   s.Forced,
+			},
+			Stream: s.Index,
+		})
+	}
+	return audio, subtitles
+}
+
+// outputs returns the playlist directories ffmpeg writes. With an audio
+// group the audio-only rung needs no output of its own: it points at the
+// default audio track's playlist.
+func (l *mediaLayout) outputs() []string {
+	var names []string
+	for _, v := range l.Variants {
+		if v.AudioOnly && len(l.Audio) > 0 {
+			continue
+		}
+		names = append(names, v.Name)
+	}
+	for _, a := range l.Audio {
+		names = append(names, a.ID)
+	}
+	return names
+}
+
+// defaultAudio returns the ID of the audio track flagged default in the
+// file, or the first one.
+func (l *mediaLayout) defaultAudio() string {
+	for _, a := range l.Audio {
+		if a.Default {
+			return a.ID
+		}
+	}
+	if len(l.Audio) > 0 {
+		return l.Audio[0].ID
+	}
+	return ""
+}
+
+// defaultSubtitle returns the ID of the subtitle track flagged default in
+// the file, or "" (subtitles off).
+func (l *mediaLayout) defaultSubtitle() string {
+	for _, s := range l.Subtitles {
+		if s.Default {
+			return s.ID
+		}
+	}
+	return ""
+}
+
+// hasTrack reports whether id is one of the tracks.
+func hasTrack(tracks []trackSource, id string) bool {
+	for _, t := range tracks {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// renderMasterPlaylist builds master.m3u8 with the given audio and
+// subtitle tracks as the defaults players select.
+func renderMasterPlaylist(l *mediaLayout, selectedAudio, selectedSubtitle string) []byte {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	audioURI := ""
+	for _, a := range l.Audio {
+		uri := a.ID + "/index.m3u8"
+		if a.ID == selectedAudio {
+			audioURI = uri
+		}
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"%s\",NAME=\"%s\"", audioGroupID, quoteAttr(a.Name))
+		if a.Language != "" {
+			fmt.Fprintf(&b, ",LANGUAGE=\"%s\"", a.Language)
+		}
+		fmt.Fprintf(&b, ",DEFAULT=%s,AUTOSELECT=YES", yesNo(a.ID == selectedAudio))
+		if a.Channels > 0 {
+			fmt.Fprintf(&b, ",CHANNELS=\"%d\"", a.Channels)
+		}
+		fmt.Fprintf(&b, ",URI=\"%s\"\n", uri)
+	}
+	for _, s := range l.Subtitles {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=\"%s\"", subtitleGroupID, quoteAttr(s.Name))
+		if s.Language != "" {
+			fmt.Fprintf(&b, ",LANGUAGE=\"%s\"", s.Language)
+		}
+		fmt.Fprintf(&b, ",DEFAULT=%s,AUTOSELECT=YES,FORCED=%s,URI=\"%s/%s.m3u8\"\n",
+			yesNo(s.ID == selectedSubtitle), yesNo(s.Forced), subtitleDir, s.ID)
+	}
+
+	for _, v := range l.Variants {
+		uri := v.Name + "/index.m3u8"
+		if v.AudioOnly && audioURI != "" {
+			uri = audioURI
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", v.Bandwidth)
+		if v.Width > 0 && v.OutHeight > 0 {
+			fmt.Fprintf(&b, ",RESOLUTION=%dx%d", v.Width, v.OutHeight)
+		}
+		if v.Codecs != "" {
+			fmt.Fprintf(&b, ",CODECS=\"%s\"", v.Codecs)
+		}
+		if len(l.Audio) > 0 {
+			fmt.Fprintf(&b, ",AUDIO=\"%s\"", audioGroupID)
+		}
+		if len(l.Subtitles) > 0 {
+			fmt.Fprintf(&b, ",SUBTITLES=\"%s\"", subtitleGroupID)
+		}
+		fmt.Fprintf(&b, "\n%s\n", uri)
+	}
+	return []byte(b.String())
+}
+
+// writeSubtitlePlaylist writes the media playlist of a subtitle track: a
+// single WebVTT segment spanning the whole stream.
+func writeSubtitlePlaylist(outputDir, id string, duration float64) error {
+	if duration <= 0 {
+		duration = 24 * 60 * 60 // unknown; one segment must still cover everything
+	}
+	playlist := fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:%.3f,\n%s.vtt\n#EXT-X-ENDLIST\n",
+		int(math.Ceil(duration)), duration, id)
+	return writeFileAtomic(filepath.Join(outputDir, subtitleDir, id+".m3u8"), []byte(playlist))
+}
+
+// writeLayout saves the layout next to the playlists.
+func writeLayout(outputDir string, l *mediaLayout) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(outputDir, layoutName), data)
+}
+
+// readLayout loads the layout of a finished output directory.
+func readLayout(outputDir string) (*mediaLayout, error) {
+	data, err := os.ReadFile(filepath.Join(outputDir, layoutName))
+	if err != nil {
+		return nil, err
+	}
+	var l mediaLayout
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// writeFileAtomic writes via a temp file so a client never reads a
+// half-written playlist.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// extractSubtitles starts a second, demux-only ffmpeg that converts the
+// embedded text subtitles to WebVTT, one file per track. Each file is
+// renamed into place when ffmpeg is done, so a player never fetches a
+// partial track. stdin feeds a growing upload when input is "pipe:0".
+// The returned channel is closed once the files are in place.
+func extractSubtitles(tc Transcoder, nice int, input string, stdin io.ReadCloser, outputDir string, subtitles []trackSource) (TranscodeRun, <-chan struct{}, error) {
+	args := []string{"-y", "-hide_banner", "-loglevel", "error", "-i", input}
+	for _, s := range subtitles {
+		args = append(args,
+			"-map", fmt.Sprintf("0:%d", s.Stream),
+			"-c:s", "webvtt",
+			"-f", "webvtt",
+			filepath.Join(outputDir, subtitleDir, s.ID+".vtt.part"),
+		)
+	}
+
+	run, err := tc.Start(TranscodeJob{Args: args, Stdin: stdin != nil, Nice: nice})
+	if err != nil {
+		if stdin != nil {
+			stdin.Close()
+		}
+		return nil, nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if stdin != nil {
+			// Subtitles are interleaved with the video, so this reads the
+			// whole upload; errors just mean ffmpeg stopped early
+			go func() {
+				io.Copy(run.Stdin(), stdin)
+				run.Stdin().Close()
+				stdin.Close()
+			}()
+		}
+		err := waitQuietly(run)
+		if err != nil {
+			log.Printf("⚠️ [Stream] Subtitle extraction failed: %v", err)
+		}
+		for _, s := range subtitles {
+			part := filepath.Join(outputDir, subtitleDir, s.ID+".vtt.part")
+			final := filepath.Join(outputDir, subtitleDir, s.ID+".vtt")
+			if err != nil || os.Rename(part, final) != nil {
+				// Leave an empty track rather than a playlist pointing at nothing
+				os.Remove(part)
+				os.WriteFile(final, []byte("WEBVTT\n"), 0644)
+			}
+		}
+	}()
+	return run, done, nil
+}
+
+// srtTimestamp matches SRT cue timings, which use a comma before the
+// milliseconds where WebVTT uses a dot.
+var srtTimestamp = regexp.MustCompile(`(\d{1,2}:\d{2}:\d{2}),(\d{3})`)
+
+// ToWebVTT converts a sidecar subtitle file to WebVTT. SRT is converted;
+// WebVTT is passed through after a sanity check.
+func ToWebVTT(fileName string, data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".vtt":
+		if !bytes.HasPrefix(data, []byte("WEBVTT")) {
+			return nil, fmt.Errorf("not a WebVTT file")
+		}
+		return data, nil
+
+	case ".srt":
+		lines := strings.Split(string(data), "\n")
+		for i, line := range lines {
+			if strings.Contains(line, "-->") {
+				lines[i] = srtTimestamp.ReplaceAllString(line, "$1.$2")
+			}
+		}
+		return []byte("WEBVTT\n\n" + strings.TrimLeft(strings.Join(lines, "\n"), "\n")), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported subtitle format %q (use .srt or .vtt)", filepath.Ext(fileName))
+	}
+}
+
+// languageTags maps the ISO 639-2 codes containers use to the BCP 47 tags
+// HLS expects, with a display name for unlabelled tracks.
+var languageTags = map[string][2]string{
+	"eng": {"en", "English"},
+	"fre": {"fr", "French"},
+	"fra": {"fr", "French"},
+	"ger": {"de", "German"},
+	"deu": {"de", "German"},
+	"spa": {"es", "Spanish"},
+	"ita": {"it", "Italian"},
+	"por": {"pt", "Portuguese"},
+	"rus": {"ru", "Russian"},
+	"jpn": {"ja", "Japanese"},
+	"chi": {"zh", "Chinese"},
+	"zho": {"zh", "Chinese"},
+	"kor": {"ko", "Korean"},
+	"hin": {"hi", "Hindi"},
+	"ara": {"ar", "Arabic"},
+	"dut": {"nl", "Dutch"},
+	"nld": {"nl", "Dutch"},
+	"swe": {"sv", "Swedish"},
+	"pol": {"pl", "Polish"},
+	"tur": {"tr", "Turkish"},
+}
+
+// languageTag normalizes a container language code; "und" and empty
+// become "".
+func languageTag(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" || code == "und" {
+		return ""
+	}
+	if t, ok := languageTags[code]; ok {
+		return t[0]
+	}
+	return code
+}
+
+// languageName returns a display name for a BCP 47 tag, or "".
+func languageName(tag string) string {
+	for _, t := range languageTags {
+		if t[0] == tag {
+			return t[1]
+		}
+	}
+	return ""
+}
+
+// trackName picks a label: the track title, else the language, else
+// "<kind> <n>".
+func trackName(title, lang, kind string, n int) string {
+	if title = strings.TrimSpace(title); title != "" {
+		return title
+	}
+	if name := languageName(lang); name != "" {
+		return name
+	}
+	if lang != "" {
+		return lang
+	}
+	return fmt.Sprintf("%s %d", kind, n+1)
+}
+
+// uniqueName makes a NAME unique within its group, as HLS requires.
+func uniqueName(seen map[string]bool, name string) string {
+	unique := name
+	for n := 2; seen[unique]; n++ {
+		unique = fmt.Sprintf("%s (%d)", name, n)
+	}
+	seen[unique] = true
+	return unique
+}
+
+// quoteAttr strips characters a quoted-string attribute can't hold.
+func quoteAttr(s string) string {
+	return strings.NewReplacer("\"", "'", "\n", " ", "\r", " ").Replace(s)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+// MasterPlaylist renders a session's master playlist with the tracks its
+// host picked as the defaults. ok is false when the stream has no layout
+// and the master.m3u8 on disk should be served instead.
+func (sm *StreamManager) MasterPlaylist(sessionID string) ([]byte, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	info, exists := sm.streams[sessionID]
+	if !exists || info.layout == nil {
+		return nil, false
+	}
+	return renderMasterPlaylist(info.layout, info.selectedAudio, info.selectedSubtitle), true
+}
+
+// GetTracks returns a session's alternate audio and subtitle tracks, or nil
+// if the session has no stream.
+func (sm *StreamManager) GetTracks(sessionID string) *models.StreamTracks {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	info, exists := sm.streams[sessionID]
+	if !exists {
+		return nil
+	}
+	tracks := sm.tracksLocked(info)
+	return &tracks
+}
+
+// SelectTracks sets the audio and subtitle tracks everyone in the session
+// should use and broadcasts them. A nil argument keeps the current
+// choice; an empty subtitle turns subtitles off.
+func (sm *StreamManager) SelectTracks(sessionID string, audio, subtitle *string) (*models.StreamTracks, error) {
+	sm.mu.Lock()
+	info, exists := sm.streams[sessionID]
+	if !exists || info.layout == nil {
+		sm.mu.Unlock()
+		return nil, fmt.Errorf("no stream with selectable tracks for this session")
+	}
+	if audio != nil && !hasTrack(info.layout.Audio, *audio) {
+		sm.mu.Unlock()
+		return nil, fmt.Errorf("unknown audio track %q", *audio)
+	}
+	if subtitle != nil && *subtitle != "" && !hasTrack(info.layout.Subtitles, *subtitle) {
+		sm.mu.Unlock()
+		return nil, fmt.Errorf("unknown subtitle track %q", *subtitle)
+	}
+	if audio != nil {
+		info.selectedAudio = *audio
+	}
+	if subtitle != nil {
+		info.selectedSubtitle = *subtitle
+	}
+	tracks := sm.tracksLocked(info)
+	sm.mu.Unlock()
+
+	log.Printf("🎧 [Stream] Session %s tracks: audio=%q subtitles=%q", sessionID, tracks.SelectedAudio, tracks.SelectedSubtitle)
+	sm.bus.Publish(sessionID, events.StreamTracks{Tracks: tracks})
+	return &tracks, nil
+}
+
+// AddSubtitle adds a sidecar WebVTT track (see ToWebVTT) to a session's
+// stream. It is written to the session's sidecar directory, not the output
+// directory: a cached stream shares that with every session serving the
+// same file, and only this session's master lists the track.
+func (sm *StreamManager) AddSubtitle(sessionID, language, name string, vtt []byte) (*models.StreamTracks, error) {
+	sm.mu.Lock()
+	info, exists := sm.streams[sessionID]
+	if !exists || info.layout == nil || !(isLive(info.status.State) || isPlayable(info.status.State)) {
+		sm.mu.Unlock()
+		return nil, fmt.Errorf("no stream to add subtitles to for this session")
+	}
+
+	lang := languageTag(language)
+	seen := make(map[string]bool)
+	for _, s := range info.layout.Subtitles {
+		seen[s.Name] = true
+	}
+	sub := trackSource{
+		MediaTrack: models.MediaTrack{
+			ID:       "ext_" + uuid.New().String()[:8],
+			Language: lang,
+			Name:     uniqueName(seen, trackName(name, lang, "Subtitles", len(info.layout.Subtitles))),
+			Sidecar:  true,
+		},
+		Stream: -1,
+	}
+
+	dir := filepath.Join(sidecarDir(sessionID), subtitleDir)
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(dir, sub.ID+".vtt"), vtt)
+	}
+	if err == nil {
+		err = writeSubtitlePlaylist(sidecarDir(sessionID), sub.ID, info.status.Duration)
+	}
+	if err != nil {
+		sm.mu.Unlock()
+		return nil, fmt.Errorf("failed to save subtitles: %w", err)
+	}
+
+	info.layout.Subtitles = append(info.layout.Subtitles, sub)
+	tracks := sm.tracksLocked(info)
+	sm.mu.Unlock()
+
+	log.Printf("💬 [Stream] Added subtitles %q to session %s", sub.Name, sessionID)
+	sm.bus.Publish(sessionID, events.StreamTracks{Tracks: tracks})
+	return &tracks, nil
+}
+
+// SidecarDir returns the directory to serve a stream file from if it is
+// one of the session's sidecar subtitle files (see AddSubtitle), or "" if
+// it comes from the output directory.
+func (sm *StreamManager) SidecarDir(sessionID, filename string) string {
+	name, ok := strings.CutPrefix(filename, subtitleDir+"/")
+	if !ok {
+		return ""
+	}
+	id := strings.TrimSuffix(strings.TrimSuffix(name, ".vtt"), ".m3u8")
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	info, exists := sm.streams[sessionID]
+	if !exists || info.layout == nil {
+		return ""
+	}
+	for _, s := range info.layout.Subtitles {
+		if s.Sidecar && s.ID == id {
+			return sidecarDir(sessionID)
+		}
+	}
+	return ""
+}
+
+// publishTracks announces a stream's tracks, if it has any to choose from.
+func (sm *StreamManager) publishTracks(sessionID string) {
+	tracks := sm.GetTracks(sessionID)
+	if tracks != nil && (len(tracks.Audio) > 0 || len(tracks.Subtitles) > 0) {
+		sm.bus.Publish(sessionID, events.StreamTracks{Tracks: *tracks})
+	}
+}
+
+// tracksLocked builds the public track list. The caller must hold sm.mu.
+func (sm *StreamManager) tracksLocked(info *streamInfo) models.StreamTracks {
+	tracks := models.StreamTracks{
+		SessionID:        info.status.SessionID,
+		Audio:            []models.MediaTrack{},
+		Subtitles:        []models.MediaTrack{},
+		SelectedAudio:    info.selectedAudio,
+		SelectedSubtitle: info.selectedSubtitle,
+	}
+	if info.layout != nil {
+		for _, a := range info.layout.Audio {
+			tracks.Audio = append(tracks.Audio, a.MediaTrack)
+		}
+		for _, s := range info.layout.Subtitles {
+			tracks.Subtitles = append(tracks.Subtitles, s.MediaTrack)
+		}
+	}
+	return tracks
+}
@@ -0,0 +1,118 @@
+package streaming
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// Transcoder probes inputs and launches the encoder runs behind streams.
+// The manager only speaks ffmpeg's command line and -progress output, so
+// the default, FFmpegTranscoder, runs ffprobe and ffmpeg themselves; tests
+// plug in a fake that describes made-up media and writes synthetic
+// playlists and segments instead.
+type Transcoder interface {
+	// Probe reads an input's streams and duration, like ProbeMedia.
+	Probe(input string) (*MediaInfo, error)
+	// Start launches a run of an ffmpeg command line.
+	Start(job TranscodeJob) (TranscodeRun, error)
+}
+
+// TranscodeJob is one encoder run to start.
+type TranscodeJob struct {
+	Args []string
+	// Stdin opens TranscodeRun.Stdin, for input "pipe:0"
+	Stdin bool
+	// Nice is the run's niceness; 0 leaves it alone
+	Nice int
+}
+
+// TranscodeRun is a started encoder run. Progress and Log must both be
+// read to the end before Wait, like the pipes of an exec.Cmd.
+type TranscodeRun interface {
+	// Progress streams ffmpeg's -progress key=value blocks.
+	Progress() io.Reader
+	// Log streams ffmpeg's log lines.
+	Log() io.Reader
+	// Stdin feeds the input; nil unless the job asked for it.
+	Stdin() io.WriteCloser
+	// Stop kills the run; its Wait returns an error.
+	Stop() error
+	// Interrupt asks the run to finish its output and exit, as ffmpeg
+	// does on SIGINT.
+	Interrupt() error
+	// Wait blocks until the run exits and reports how.
+	Wait() error
+}
+
+// FFmpegTranscoder runs ffprobe and ffmpeg, found on PATH (or in the
+// usual Windows install folders) at each use.
+type FFmpegTranscoder struct{}
+
+func (FFmpegTranscoder) Probe(input string) (*MediaInfo, error) {
+	return ProbeMedia(input)
+}
+
+func (FFmpegTranscoder) Start(job TranscodeJob) (TranscodeRun, error) {
+	ffmpegPath, err := findFFmpeg()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(ffmpegPath, job.Args...)
+	run := &ffmpegRun{cmd: cmd}
+	if run.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	if run.stderr, err = cmd.StderrPipe(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	if job.Stdin {
+		if run.stdin, err = cmd.StdinPipe(); err != nil {
+			return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	if job.Nice != 0 {
+		if err := setNice(cmd.Process.Pid, job.Nice); err != nil {
+			log.Printf("⚠️ [Jobs] Failed to renice ffmpeg: %v", err)
+		}
+	}
+	return run, nil
+}
+
+// ffmpegRun is a running ffmpeg process.
+type ffmpegRun struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+	stdin  io.WriteCloser
+}
+
+func (r *ffmpegRun) Progress() io.Reader   { return r.stdout }
+func (r *ffmpegRun) Log() io.Reader        { return r.stderr }
+func (r *ffmpegRun) Stdin() io.WriteCloser { return r.stdin }
+func (r *ffmpegRun) Stop() error           { return r.cmd.Process.Kill() }
+func (r *ffmpegRun) Wait() error           { return r.cmd.Wait() }
+
+func (r *ffmpegRun) Interrupt() error {
+	if err := r.cmd.Process.Signal(os.Interrupt); err != nil {
+		return r.cmd.Process.Kill() // no SIGINT on Windows
+	}
+	return nil
+}
+
+// waitQuietly drains a side run's output, its log to our stderr, and
+// waits for it.
+func waitQuietly(run TranscodeRun) error {
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() { defer readers.Done(); io.Copy(io.Discard, run.Progress()) }()
+	go func() { defer readers.Done(); io.Copy(os.Stderr, run.Log()) }()
+	readers.Wait()
+	return run.Wait()
+}
@@ -0,0 +1,250 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeTranscoder stands in for ffprobe and ffmpeg. Probe describes media
+// to the manager's liking; each run reads the HLS outputs off the command
+// line and writes segments of 2s, one every interval, into every variant
+// playlist, reporting -progress blocks as it goes. Like ffmpeg, a run
+// numbers its segments from -start_number and stops after -t seconds or
+// at the end of the probed input.
+// Runs that write no HLS (subtitles, previews) just exit after an interval.
+type fakeTranscoder struct {
+	segments int           // per run, at most
+	interval time.Duration // between segments
+	err      error         // returned by Start, if set
+	media    *MediaInfo    // returned by Probe; nil fails it, as without ffprobe
+
+	mu   sync.Mutex
+	runs []*fakeRun
+}
+
+func (f *fakeTranscoder) Probe(input string) (*MediaInfo, error) {
+	if f.media == nil {
+		return nil, errors.New("ffprobe not found")
+	}
+	media := *f.media
+	return &media, nil
+}
+
+func (f *fakeTranscoder) Start(job TranscodeJob) (TranscodeRun, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	run := &fakeRun{
+		args:      job.Args,
+		stop:      make(chan struct{}),
+		interrupt: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	var progress, logs *io.PipeWriter
+	run.progress, progress = io.Pipe()
+	run.log, logs = io.Pipe()
+	if job.Stdin {
+		var stdin *io.PipeReader
+		stdin, run.stdin = io.Pipe()
+		go io.Copy(io.Discard, stdin)
+	}
+
+	f.mu.Lock()
+	f.runs = append(f.runs, run)
+	f.mu.Unlock()
+
+	segments := f.segments
+	if f.media != nil && f.media.Duration > 0 {
+		// The input ends there
+		segments = min(segments, int(math.Ceil(f.media.Duration/2))-run.intArg("-start_number", 0))
+	}
+	go func() {
+		run.err = run.encode(segments, f.interval, progress)
+		progress.Close()
+		logs.Close()
+		close(run.done)
+	}()
+	return run, nil
+}
+
+// started returns the runs so far.
+func (f *fakeTranscoder) started() []*fakeRun {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*fakeRun(nil), f.runs...)
+}
+
+// fakeRun is one fake ffmpeg run.
+type fakeRun struct {
+	args      []string
+	progress  *io.PipeReader
+	log       *io.PipeReader
+	stdin     *io.PipeWriter
+	stop      chan struct{}
+	interrupt chan struct{}
+	intOnce   sync.Once
+	done      chan struct{}
+	err       error
+
+	// Held while writing output, so nothing is written once Stop
+	// returns, as with a killed process
+	writing sync.Mutex
+}
+
+func (r *fakeRun) Progress() io.Reader { return r.progress }
+func (r *fakeRun) Log() io.Reader      { return r.log }
+
+func (r *fakeRun) Stdin() io.WriteCloser {
+	if r.stdin == nil {
+		return nil
+	}
+	return r.stdin
+}
+
+func (r *fakeRun) Stop() error {
+	r.writing.Lock()
+	defer r.writing.Unlock()
+	if !r.stopped() {
+		close(r.stop)
+	}
+	return nil
+}
+
+func (r *fakeRun) Interrupt() error {
+	r.intOnce.Do(func() { close(r.interrupt) })
+	return nil
+}
+
+func (r *fakeRun) Wait() error {
+	<-r.done
+	return r.err
+}
+
+// stopped reports whether the run was killed.
+func (r *fakeRun) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// exited reports whether the run is over.
+func (r *fakeRun) exited() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// encode writes the segments, ending the playlists with #EXT-X-ENDLIST
+// unless the run is killed first.
+func (r *fakeRun) encode(segments int, interval time.Duration, progress io.Writer) error {
+	playlist, pattern := r.outputs()
+	names := []string{""}
+	if i := indexOf(r.args, "-var_stream_map"); i >= 0 {
+		names = nil
+		for _, group := range strings.Fields(r.args[i+1]) {
+			for _, field := range strings.Split(group, ",") {
+				if name, ok := strings.CutPrefix(field, "name:"); ok {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+
+	if playlist == "" {
+		segments = min(segments, 1) // a side run; over in a moment
+	}
+	first := r.intArg("-start_number", 0)
+	if seconds := r.intArg("-t", 0); seconds > 0 {
+		segments = min(segments, seconds/2)
+	}
+	lists := make([]string, len(names))
+	for i := range lists {
+		lists[i] = "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n"
+	}
+	for n := first; n < first+segments; n++ {
+		select {
+		case <-r.stop:
+			return errors.New("signal: killed")
+		case <-r.interrupt:
+			n = segments // finish what's written
+			continue
+		case <-time.After(interval):
+		}
+		if playlist == "" {
+			continue // not an HLS run
+		}
+		r.writing.Lock()
+		if r.stopped() {
+			r.writing.Unlock()
+			return errors.New("signal: killed")
+		}
+		for i, name := range names {
+			// Like ffmpeg, write into the directories the manager made
+			segment := fmt.Sprintf(strings.ReplaceAll(pattern, "%v", name), n)
+			if err := os.WriteFile(segment, []byte("segment"), 0644); err != nil {
+				r.writing.Unlock()
+				return err
+			}
+			lists[i] += fmt.Sprintf("#EXTINF:2.000000,\n%s\n", filepath.Base(segment))
+			if err := writeFileAtomic(strings.ReplaceAll(playlist, "%v", name), []byte(lists[i])); err != nil {
+				r.writing.Unlock()
+				return err
+			}
+		}
+		r.writing.Unlock()
+		fmt.Fprintf(progress, "out_time_us=%d\nspeed=4x\nprogress=continue\n", (n+1)*2000000)
+	}
+
+	r.writing.Lock()
+	defer r.writing.Unlock()
+	for i, name := range names {
+		if playlist != "" && !r.stopped() {
+			writeFileAtomic(strings.ReplaceAll(playlist, "%v", name), []byte(lists[i]+"#EXT-X-ENDLIST\n"))
+		}
+	}
+	fmt.Fprintf(progress, "out_time_us=%d\nprogress=end\n", (first+segments)*2000000)
+	return nil
+}
+
+// outputs returns the playlist and segment pattern of an HLS run, or ""
+// for other runs.
+func (r *fakeRun) outputs() (playlist, pattern string) {
+	i := indexOf(r.args, "-hls_segment_filename")
+	if i < 0 || indexOf(r.args, "hls") < 0 {
+		return "", ""
+	}
+	return r.args[len(r.args)-1], r.args[i+1]
+}
+
+// intArg returns the value of a numeric option, or def.
+func (r *fakeRun) intArg(name string, def int) int {
+	if i := indexOf(r.args, name); i >= 0 && i+1 < len(r.args) {
+		if v, err := strconv.Atoi(r.args[i+1]); err == nil {
+			return v
+		}
+	}
+	return def
+}
+
+func indexOf(args []string, arg string) int {
+	for i, a := range args {
+		if a == arg {
+			return i
+		}
+	}
+	return -1
+}
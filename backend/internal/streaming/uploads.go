@@ -0,0 +1,336 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadBusy       = errors.New("another request is writing to this upload")
+	ErrOffsetMismatch   = errors.New("offset does not match the upload")
+	ErrChecksumMismatch = errors.New("chunk checksum mismatch")
+	ErrUploadTooLarge   = errors.New("upload exceeds the maximum size")
+	ErrQuotaExceeded    = errors.New("session upload quota exceeded")
+	ErrNotUploader      = errors.New("only the device that created an upload can use it")
+)
+
+// UploadLimits bounds resumable uploads.
+type UploadLimits struct {
+	MaxSize      int64         // largest single file, bytes
+	SessionQuota int64         // total bytes of unfinished uploads per session
+	Expiry       time.Duration // unfinished uploads idle this long are deleted
+}
+
+// DefaultUploadLimits fit a couple of full-length movies per session. The
+// expiry stays below DefaultGCPolicy.OrphanAge so the upload store, not
+// the stream GC, is what reclaims abandoned partial files.
+var DefaultUploadLimits = UploadLimits{
+	MaxSize:      8 << 30,
+	SessionQuota: 16 << 30,
+	Expiry:       30 * time.Minute,
+}
+
+// Upload is a resumable upload in progress.
+type Upload struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"sessionId"`
+	DeviceID  string    `json:"-"` // who created it; never sent, it's what proves ownership
+	FileName  string    `json:"fileName"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Following bool      `json:"following"` // a stream is already reading it
+	path      string
+	busy      bool
+	offered   bool // Follow has handed out growing
+	growing   *GrowingFile
+}
+
+// UploadStore tracks resumable uploads. Clients create an upload with its
+// final size, then send chunks at the current offset; a dropped connection
+// only loses the chunk in flight. Each upload is written under its final
+// name in its own directory, so a stream can follow it while it grows
+// (see Follow) and nothing has to be renamed on completion.
+type UploadStore struct {
+	mu      sync.Mutex
+	uploads map[string]*Upload
+	limits  UploadLimits
+}
+
+// NewUploadStore creates an empty upload store.
+func NewUploadStore(limits UploadLimits) *UploadStore {
+	return &UploadStore{
+		uploads: make(map[string]*Upload),
+		limits:  limits,
+	}
+}
+
+// Limits returns the limits the store enforces.
+func (us *UploadStore) Limits() UploadLimits {
+	return us.limits
+}
+
+// Create registers a new upload of size bytes by deviceID and creates its
+// partial file.
+func (us *UploadStore) Create(sessionID, deviceID, fileName string, size int64) (*Upload, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("upload size must be positive")
+	}
+	if size > us.limits.MaxSize {
+		return nil, ErrUploadTooLarge
+	}
+	fileName = SanitizeFileName(fileName)
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	var pending int64
+	for _, u := range us.uploads {
+		if u.SessionID == sessionID {
+			pending += u.Size
+		}
+	}
+	if pending+size > us.limits.SessionQuota {
+		return nil, ErrQuotaExceeded
+	}
+
+	now := time.Now()
+	upload := &Upload{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		DeviceID:  deviceID,
+		FileName:  fileName,
+		Size:      size,
+		CreatedAt: now,
+		ExpiresAt: now.Add(us.limits.Expiry),
+	}
+
+	dir := filepath.Join(UploadDir(sessionID), upload.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload dir: %w", err)
+	}
+	upload.path = filepath.Join(dir, fileName)
+	upload.growing = NewGrowingFile(upload.path)
+
+	f, err := os.Create(upload.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	f.Close()
+
+	us.uploads[upload.ID] = upload
+	log.Printf("📁 [Upload] Created %s for %s (%d MB) in session %s", upload.ID, fileName, size/(1024*1024), sessionID)
+
+	copied := *upload
+	return &copied, nil
+}
+
+// Get returns a snapshot of an upload, if deviceID created it.
+func (us *UploadStore) Get(id, deviceID string) (*Upload, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	upload, ok := us.uploads[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	if deviceID == "" || deviceID != upload.DeviceID {
+		return nil, ErrNotUploader
+	}
+	copied := *upload
+	return &copied, nil
+}
+
+// WriteChunk appends data at offset, which must equal the upload's current
+// offset. If sum is given (a fresh hash.Hash matching the client's
+// Upload-Checksum algorithm), the chunk is verified against expected and
+// discarded on mismatch; without it, whatever arrived before a dropped
+// connection is kept so the client can resume from there. Only kept bytes
+// are visible to a following stream. Returns the updated upload, plus the
+// file's path once Offset == Size.
+func (us *UploadStore) WriteChunk(id string, offset int64, data io.Reader, sum hash.Hash, expected []byte) (*Upload, string, error) {
+	us.mu.Lock()
+	upload, ok := us.uploads[id]
+	switch {
+	case !ok:
+		us.mu.Unlock()
+		return nil, "", ErrUploadNotFound
+	case upload.busy:
+		us.mu.Unlock()
+		return nil, "", ErrUploadBusy
+	case offset != upload.Offset:
+		us.mu.Unlock()
+		return nil, "", ErrOffsetMismatch
+	}
+	upload.busy = true
+	path, size := upload.path, upload.Size
+	us.mu.Unlock()
+
+	written, writeErr := writeAt(path, offset, data, size-offset, sum)
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	upload.busy = false
+
+	if sum != nil && writeErr == nil && !bytes.Equal(sum.Sum(nil), expected) {
+		writeErr = ErrChecksumMismatch
+	}
+	if writeErr != nil && (sum != nil || errors.Is(writeErr, ErrUploadTooLarge)) {
+		// Verified chunks are all-or-nothing
+		os.Truncate(path, offset)
+		written = 0
+	}
+
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(us.limits.Expiry)
+	upload.growing.Advance(upload.Offset)
+	copied := *upload
+
+	if writeErr != nil {
+		return &copied, "", writeErr
+	}
+	if upload.Offset < upload.Size {
+		return &copied, "", nil
+	}
+
+	upload.growing.Complete()
+	delete(us.uploads, id)
+	log.Printf("📁 [Upload] Completed %s (%d MB) for session %s", upload.FileName, upload.Size/(1024*1024), upload.SessionID)
+	return &copied, path, nil
+}
+
+// Follow hands out the growing file of an upload so a stream can start
+// reading it before it completes. It returns nil until enough of the file
+// is there (FollowUploadThreshold), for containers ffmpeg can't read front
+// to back, and for every call after the first. Call MarkFollowing once the
+// stream has started.
+func (us *UploadStore) Follow(id string) *GrowingFile {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	upload, ok := us.uploads[id]
+	if !ok || upload.offered || upload.Offset < FollowUploadThreshold {
+		return nil
+	}
+	if !CanFollowUpload(upload.path) {
+		return nil
+	}
+	upload.offered = true
+	return upload.growing
+}
+
+// MarkFollowing records that a stream is reading the upload, so completing
+// it doesn't start another.
+func (us *UploadStore) MarkFollowing(id string) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if upload, ok := us.uploads[id]; ok {
+		upload.Following = true
+	}
+}
+
+// Remove cancels an upload and deletes its partial file.
+func (us *UploadStore) Remove(id string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	upload, ok := us.uploads[id]
+	if !ok {
+		return ErrUploadNotFound
+	}
+	upload.growing.Abort(ErrUploadAborted)
+	removeUpload(upload.path)
+	delete(us.uploads, id)
+	return nil
+}
+
+// StartExpiry deletes abandoned uploads in the background until ctx is
+// cancelled.
+func (us *UploadStore) StartExpiry(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				us.expire()
+			}
+		}
+	}()
+}
+
+func (us *UploadStore) expire() {
+	us.mu.Lock()
+	var expired []string
+	for id, u := range us.uploads {
+		if !u.busy && time.Now().After(u.ExpiresAt) {
+			expired = append(expired, id)
+		}
+	}
+	us.mu.Unlock()
+
+	for _, id := range expired {
+		if us.Remove(id) == nil {
+			log.Printf("🧹 [Upload] Expired abandoned upload %s", id)
+		}
+	}
+}
+
+// writeAt copies at most limit bytes from data into the file at offset,
+// feeding them to sum if set. Sending more than limit is an error.
+func writeAt(path string, offset int64, data io.Reader, limit int64, sum hash.Hash) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var w io.Writer = f
+	if sum != nil {
+		w = io.MultiWriter(f, sum)
+	}
+	// Read one byte past the limit to detect oversized chunks
+	written, err := io.Copy(w, io.LimitReader(data, limit+1))
+	if written > limit {
+		return written, ErrUploadTooLarge
+	}
+	return written, err
+}
+
+// SanitizeFileName strips directories and characters that are awkward on
+// disk from a client-supplied file name, keeping it recognisable.
+func SanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" {
+		name = "upload"
+	}
+	return name
+}
@@ -0,0 +1,65 @@
+package streaming
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestUploadIsFollowingOnlyOnceMarked(t *testing.T) {
+	root := uploadRoot
+	uploadRoot = t.TempDir()
+	t.Cleanup(func() { uploadRoot = root })
+
+	// An EBML header makes it a Matroska file, which can be followed
+	head := append([]byte{0x1A, 0x45, 0xDF, 0xA3}, make([]byte, FollowUploadThreshold)...)
+	size := int64(len(head)) + 1
+
+	for _, started := range []bool{false, true} {
+		us := NewUploadStore(DefaultUploadLimits)
+		upload, err := us.Create("s1", "host", "movie.mkv", size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := us.WriteChunk(upload.ID, 0, bytes.NewReader(head), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if us.Follow(upload.ID) == nil {
+			t.Fatal("Follow offered nothing past the threshold")
+		}
+		if us.Follow(upload.ID) != nil {
+			t.Error("Follow offered the upload twice")
+		}
+		if started {
+			us.MarkFollowing(upload.ID)
+		}
+
+		done, path, err := us.WriteChunk(upload.ID, int64(len(head)), bytes.NewReader([]byte{0}), nil, nil)
+		if err != nil || path == "" {
+			t.Fatalf("last chunk = %q, %v", path, err)
+		}
+		if done.Following != started {
+			t.Errorf("stream started = %v, but the completed upload has Following = %v", started, done.Following)
+		}
+	}
+}
+
+func TestUploadBelongsToItsCreator(t *testing.T) {
+	root := uploadRoot
+	uploadRoot = t.TempDir()
+	t.Cleanup(func() { uploadRoot = root })
+
+	us := NewUploadStore(DefaultUploadLimits)
+	upload, err := us.Create("s1", "host", "movie.mkv", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := us.Get(upload.ID, "host"); err != nil {
+		t.Errorf("the creator can't get its upload: %v", err)
+	}
+	for _, deviceID := range []string{"guest", ""} {
+		if _, err := us.Get(upload.ID, deviceID); !errors.Is(err, ErrNotUploader) {
+			t.Errorf("device %q got the host's upload: %v", deviceID, err)
+		}
+	}
+}
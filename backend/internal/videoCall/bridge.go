@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+// pliInterval is how often a bridge asks the publisher for a keyframe.
+// The receiver (ffmpeg) can't decode anything until one arrives, and
+// keyframes also repair what packet loss broke.
+const pliInterval = 3 * time.Second
+
+// BridgeTrack describes a track a bridge forwards: enough for the receiver
+// to write the SDP file ffmpeg reads the RTP with.
+type BridgeTrack struct {
+	Kind        string `json:"kind"` // "audio" or "video"
+	MimeType    string `json:"mimeType"`
+	ClockRate   uint32 `json:"clockRate"`
+	Channels    uint16 `json:"channels,omitempty"`
+	PayloadType uint8  `json:"payloadType"`
+	Fmtp        string `json:"fmtp,omitempty"`
+}
+
+// Publisher is a peer that sends media, and what it sends.
+type Publisher struct {
+	ID     string        `json:"id"`
+	Tracks []BridgeTrack `json:"tracks"`
+}
+
+// Bridge copies one publisher's RTP packets, as they arrive, to UDP ports
+// on another host — a 0Xnet node whose ffmpeg turns them into HLS, so a
+// presenter on WebRTC reaches viewers who never join the call.
+type Bridge struct {
+	ID          string        `json:"id"`
+	Room        string        `json:"room"`
+	PublisherID string        `json:"publisher"`
+	Tracks      []BridgeTrack `json:"tracks"`
+
+	conns     map[webrtc.RTPCodecType]*net.UDPConn
+	done      chan struct{}
+	closeOnce sync.Once
+	onClose   func() // unregisters the bridge from its room and the SFU
+}
+
+// trackInfo describes a publisher's incoming track.
+func trackInfo(remote *webrtc.TrackRemote) BridgeTrack {
+	codec := remote.Codec()
+	return BridgeTrack{
+		Kind:        remote.Kind().String(),
+		MimeType:    codec.MimeType,
+		ClockRate:   codec.ClockRate,
+		Channels:    codec.Channels,
+		PayloadType: uint8(remote.PayloadType()),
+		Fmtp:        codec.SDPFmtpLine,
+	}
+}
+
+// write forwards one RTP packet of the given kind; packets of kinds the
+// receiver didn't ask for are dropped.
+func (b *Bridge) write(kind webrtc.RTPCodecType, pkt []byte) {
+	if conn := b.conns[kind]; conn != nil {
+		conn.Write(pkt) // UDP: a receiver that isn't listening yet just misses packets
+	}
+}
+
+// Close stops forwarding. Safe to call more than once.
+func (b *Bridge) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		for _, conn := range b.conns {
+			conn.Close()
+		}
+		if b.onClose != nil {
+			b.onClose()
+		}
+		log.Printf("[bridge %s] closed", b.ID)
+	})
+}
+
+// ── Room side ────────────────────────────────────────────────────────────────
+
+// Publishers lists the peers currently sending media.
+func (r *Room) Publishers() []Publisher {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []Publisher
+	index := make(map[string]int)
+	for _, pt := range r.tracks {
+		i, ok := index[pt.publisherID]
+		if !ok {
+			i = len(out)
+			index[pt.publisherID] = i
+			out = append(out, Publisher{ID: pt.publisherID})
+		}
+		out[i].Tracks = append(out[i].Tracks, trackInfo(pt.remote))
+	}
+	return out
+}
+
+// StartBridge forwards a publisher's tracks to host, one UDP port per
+// kind ("audio"/"video"); kinds without a port aren't forwarded. onClose
+// runs once the bridge closes.
+func (r *Room) StartBridge(publisherID, host string, ports map[string]int, onClose func(*Bridge)) (*Bridge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	publisher, ok := r.peers[publisherID]
+	if !ok {
+		return nil, errors.New("no such peer in this room")
+	}
+
+	b := &Bridge{
+		ID:          uuid.New().String(),
+		Room:        r.id,
+		PublisherID: publisherID,
+		conns:       make(map[webrtc.RTPCodecType]*net.UDPConn),
+		done:        make(chan struct{}),
+	}
+	b.onClose = func() {
+		r.removeBridge(b)
+		onClose(b)
+	}
+	var videoSSRCs []uint32
+	for _, pt := range r.tracks {
+		if pt.publisherID != publisherID {
+			continue
+		}
+		info := trackInfo(pt.remote)
+		port := ports[info.Kind]
+		if port <= 0 || b.conns[pt.remote.Kind()] != nil {
+			continue // not wanted, or a second track of the kind
+		}
+		addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err == nil {
+			b.conns[pt.remote.Kind()], err = net.DialUDP("udp", nil, addr)
+		}
+		if err != nil {
+			for _, conn := range b.conns {
+				conn.Close()
+			}
+			return nil, fmt.Errorf("bridge %s to %s:%d: %w", info.Kind, host, port, err)
+		}
+		b.Tracks = append(b.Tracks, info)
+		if pt.remote.Kind() == webrtc.RTPCodecTypeVideo {
+			videoSSRCs = append(videoSSRCs, uint32(pt.remote.SSRC()))
+		}
+	}
+	if len(b.Tracks) == 0 {
+		return nil, errors.New("the peer publishes none of the requested tracks")
+	}
+
+	r.bridges = append(r.bridges, b)
+	if len(videoSSRCs) > 0 {
+		go requestKeyframes(b, publisher, videoSSRCs)
+	}
+	log.Printf("[room %s] bridging %s to %s (%d tracks)", r.id, publisherID, host, len(b.Tracks))
+	return b, nil
+}
+
+// removeBridge forgets a closed bridge.
+func (r *Room) removeBridge(b *Bridge) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.bridges {
+		if existing == b {
+			r.bridges = append(r.bridges[:i], r.bridges[i+1:]...)
+			return
+		}
+	}
+}
+
+// tapRTP hands a publisher's packet to the bridges forwarding it and to
+// the room's recording.
+func (r *Room) tapRTP(publisherID string, remote *webrtc.TrackRemote, pkt []byte) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, b := range r.bridges {
+		if b.PublisherID == publisherID {
+			b.write(remote.Kind(), pkt)
+		}
+	}
+	if r.recording != nil {
+		r.recording.write(remote, pkt)
+	}
+}
+
+// requestKeyframes sends the publisher a PLI now and every pliInterval
+// until the bridge closes.
+func requestKeyframes(b *Bridge, publisher *Peer, ssrcs []uint32) {
+	ticker := time.NewTicker(pliInterval)
+	defer ticker.Stop()
+	for {
+		for _, ssrc := range ssrcs {
+			if err := publisher.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: ssrc}}); err != nil {
+				return // publisher gone; RemovePeer closes the bridge
+			}
+		}
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ── SFU side ─────────────────────────────────────────────────────────────────
+
+// StartBridge bridges a publisher in an existing room; see Room.StartBridge.
+func (s *SFU) StartBridge(roomID, publisherID, host string, ports map[string]int) (*Bridge, error) {
+	s.mu.RLock()
+	room, ok := s.rooms[roomID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errors.New("no such room")
+	}
+
+	b, err := room.StartBridge(publisherID, host, ports, func(b *Bridge) {
+		s.mu.Lock()
+		delete(s.bridges, b.ID)
+		s.mu.Unlock()
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	select {
+	case <-b.done: // the publisher left already
+	default:
+		s.bridges[b.ID] = b
+	}
+	s.mu.Unlock()
+	return b, nil
+}
+
+// Bridge returns a running bridge, or nil once it has closed (e.g. the
+// publisher left).
+func (s *SFU) Bridge(id string) *Bridge {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bridges[id]
+}
+
+// Publishers lists the publishers of a room; nil if there is no such room.
+func (s *SFU) Publishers(roomID string) []Publisher {
+	s.mu.RLock()
+	room, ok := s.rooms[roomID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return room.Publishers()
+}
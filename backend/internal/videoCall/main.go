@@ -1,9 +1,14 @@
 package main
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gorilla/websocket"
 )
@@ -21,6 +26,19 @@ func main() {
 		port = "8080"
 	}
 
+	// Where recorded tracks are written (see recorder.go)
+	recordingsDir := os.Getenv("RECORDINGS_DIR")
+	if recordingsDir == "" {
+		recordingsDir = "./recordings"
+	}
+
+	// Shared with the 0Xnet node (its SFU_TOKEN), which alone may use the
+	// bridge and recording endpoints: they hand media to whoever asks.
+	token := os.Getenv("SFU_TOKEN")
+	if token == "" {
+		log.Printf("[main] SFU_TOKEN not set: bridges and recording are disabled")
+	}
+
 	sfu := NewSFU()
 
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
@@ -54,6 +72,141 @@ func main() {
 		log.Printf("[sfu] peer %s left room %s", peer.id, roomID)
 	})
 
+	// ── HLS bridge ───────────────────────────────────────────────────────────
+	// A 0Xnet node picks a publisher and asks for its RTP on two UDP ports;
+	// the packets go to the address the request came from.
+
+	http.HandleFunc("/publishers", nodeOnly(token, func(w http.ResponseWriter, r *http.Request) {
+		publishers := sfu.Publishers(r.URL.Query().Get("room"))
+		if publishers == nil {
+			publishers = []Publisher{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(publishers)
+	}))
+
+	http.HandleFunc("/bridge", nodeOnly(token, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var body struct {
+			Room      string `json:"room"`
+			Publisher string `json:"publisher"`
+			VideoPort int    `json:"videoPort"`
+			AudioPort int    `json:"audioPort"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Room == "" || body.Publisher == "" {
+			http.Error(w, "room and publisher required", http.StatusBadRequest)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bridge, err := sfu.StartBridge(body.Room, body.Publisher, host, map[string]int{
+			"video": body.VideoPort,
+			"audio": body.AudioPort,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bridge)
+	}))
+
+	// GET: 404 once the bridge has closed (the publisher left). DELETE: stop it.
+	http.HandleFunc("/bridge/", nodeOnly(token, func(w http.ResponseWriter, r *http.Request) {
+		bridge := sfu.Bridge(strings.TrimPrefix(r.URL.Path, "/bridge/"))
+		if bridge == nil {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(bridge)
+		case http.MethodDelete:
+			bridge.Close()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "use GET or DELETE", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// ── Recording ────────────────────────────────────────────────────────────
+	// A 0Xnet host records a call; each published track becomes a file the
+	// node indexes and later downloads or deletes.
+
+	http.HandleFunc("/record", nodeOnly(token, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var body struct {
+			Room string `json:"room"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Room == "" {
+			http.Error(w, "room required", http.StatusBadRequest)
+			return
+		}
+		if err := sfu.StartRecording(body.Room, recordingsDir); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "recording"})
+	}))
+
+	http.HandleFunc("/record/stop", nodeOnly(token, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var body struct {
+			Room string `json:"room"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Room == "" {
+			http.Error(w, "room required", http.StatusBadRequest)
+			return
+		}
+		files, err := sfu.StopRecording(body.Room)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if files == nil {
+			files = []RecordingFile{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(files)
+	}))
+
+	// GET downloads a recorded file, DELETE removes it.
+	http.HandleFunc("/recordings/", nodeOnly(token, func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/recordings/")
+		if !recordingName.MatchString(name) {
+			http.NotFound(w, r)
+			return
+		}
+		path := filepath.Join(recordingsDir, name)
+		switch r.Method {
+		case http.MethodGet:
+			http.ServeFile(w, r, path)
+		case http.MethodDelete:
+			if err := os.Remove(path); err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "use GET or DELETE", http.StatusMethodNotAllowed)
+		}
+	}))
+
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"status":"ok"}`))
@@ -62,3 +215,16 @@ func main() {
 	log.Printf("🚀 WebRTC SFU listening on :%s", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
+
+// nodeOnly serves next only to requests with the shared token
+// ("Authorization: Bearer <token>"); without a token, to none.
+func nodeOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
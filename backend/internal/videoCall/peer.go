@@ -115,11 +115,11 @@ func NewPeer(room *Room, conn *websocket.Conn) (*Peer, error) {
 		}
 
 		// Register in room — all other peers will Subscribe.
-		room.PublishTrack(local, p.id)
+		room.PublishTrack(local, remote, p.id)
 
 		// Forward RTP packets from the publisher into the local track.
 		// This goroutine runs for the lifetime of the track.
-		go forwardRTP(p.id, remote, local)
+		go forwardRTP(room, p.id, remote, local)
 	})
 
 	return p, nil
@@ -339,8 +339,9 @@ func (p *Peer) writeJSON(v interface{}) {
 // ── Helpers ───────────────────────────────────────────────────────────────────
 
 // forwardRTP copies raw RTP packets from a remote (publisher) track into a
-// local (forwarding) track. Runs in its own goroutine per incoming track.
-func forwardRTP(peerID string, remote *webrtc.TrackRemote, local *webrtc.TrackLocalStaticRTP) {
+// local (forwarding) track, and to the room's bridges. Runs in its own
+// goroutine per incoming track.
+func forwardRTP(room *Room, peerID string, remote *webrtc.TrackRemote, local *webrtc.TrackLocalStaticRTP) {
 	buf := make([]byte, 1500) // max RTP packet size
 	for {
 		n, _, err := remote.Read(buf)
@@ -351,6 +352,7 @@ func forwardRTP(peerID string, remote *webrtc.TrackRemote, local *webrtc.TrackLo
 		if _, err := local.Write(buf[:n]); err != nil {
 			return
 		}
+		room.tapRTP(peerID, remote, buf[:n])
 	}
 }
 
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+// recordingName matches the files a Recording writes, so HTTP handlers
+// never touch anything else in the directory.
+var recordingName = regexp.MustCompile(`^[0-9a-f-]{36}\.(webm|ogg)$`)
+
+// RecordingFile is one published track written to disk.
+type RecordingFile struct {
+	Name        string    `json:"name"` // in the recordings directory
+	Participant string    `json:"participant"`
+	Kind        string    `json:"kind"` // "webm" (VP8 video) or "ogg" (Opus audio)
+	Size        int64     `json:"size"`
+	Duration    float64   `json:"duration"` // seconds
+	StartedAt   time.Time `json:"startedAt"`
+}
+
+// mediaWriter is what a track is written with: oggwriter or webmWriter.
+type mediaWriter interface {
+	WriteRTP(*rtp.Packet) error
+	Close() error
+}
+
+// trackRecorder writes one published track.
+type trackRecorder struct {
+	file      RecordingFile
+	path      string
+	w         mediaWriter
+	clockRate uint32
+	first     uint32 // RTP timestamps, for the duration
+	last      uint32
+	started   bool
+	failed    bool
+}
+
+// Recording writes every track published in a room to its own file
+// while it runs: Opus audio to Ogg, VP8 video to WebM. Other codecs
+// (H.264, VP9) are skipped.
+type Recording struct {
+	dir string
+
+	mu       sync.Mutex
+	tracks   map[*webrtc.TrackRemote]*trackRecorder // open writers
+	finished []RecordingFile
+	stopped  bool
+}
+
+func newRecording(dir string) (*Recording, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Recording{dir: dir, tracks: make(map[*webrtc.TrackRemote]*trackRecorder)}, nil
+}
+
+// addTrack starts writing a published track.
+func (rec *Recording) addTrack(publisherID string, remote *webrtc.TrackRemote) {
+	codec := remote.Codec()
+	file := RecordingFile{
+		Name:        uuid.New().String(),
+		Participant: publisherID,
+		StartedAt:   time.Now(),
+	}
+
+	var w mediaWriter
+	var err error
+	switch strings.ToLower(codec.MimeType) {
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		file.Kind = "ogg"
+		w, err = oggwriter.New(filepath.Join(rec.dir, file.Name+".ogg"), codec.ClockRate, codec.Channels)
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		file.Kind = "webm"
+		w, err = newWebMWriter(filepath.Join(rec.dir, file.Name+".webm"), codec.ClockRate)
+	default:
+		log.Printf("[recording] not recording %s track of %s (only Opus and VP8 are)", codec.MimeType, publisherID)
+		return
+	}
+	if err != nil {
+		log.Printf("[recording] %s track of %s: %v", file.Kind, publisherID, err)
+		return
+	}
+	file.Name += "." + file.Kind
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.stopped || rec.tracks[remote] != nil {
+		w.Close()
+		os.Remove(filepath.Join(rec.dir, file.Name))
+		return
+	}
+	rec.tracks[remote] = &trackRecorder{
+		file:      file,
+		path:      filepath.Join(rec.dir, file.Name),
+		w:         w,
+		clockRate: codec.ClockRate,
+	}
+	log.Printf("[recording] writing %s of %s to %s", codec.MimeType, publisherID, file.Name)
+}
+
+// write records one RTP packet of a track. raw is copied; the caller
+// reuses its buffer.
+func (rec *Recording) write(remote *webrtc.TrackRemote, raw []byte) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	t := rec.tracks[remote]
+	if t == nil || t.failed {
+		return
+	}
+	pkt := &rtp.Packet{}
+	if err := pkt.Unmarshal(append([]byte(nil), raw...)); err != nil {
+		return
+	}
+	if !t.started {
+		t.first, t.started = pkt.Timestamp, true
+	}
+	t.last = pkt.Timestamp
+	if err := t.w.WriteRTP(pkt); err != nil {
+		log.Printf("[recording] %s: %v; dropping the rest of the track", t.file.Name, err)
+		t.failed = true
+	}
+}
+
+// closeTrack finishes the file of a track whose publisher left.
+func (rec *Recording) closeTrack(remote *webrtc.TrackRemote) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if t := rec.tracks[remote]; t != nil {
+		delete(rec.tracks, remote)
+		rec.finish(t)
+	}
+}
+
+// finish closes a track's writer and keeps the file, unless nothing
+// usable was written. The caller must hold rec.mu.
+func (rec *Recording) finish(t *trackRecorder) {
+	if err := t.w.Close(); err != nil {
+		log.Printf("[recording] closing %s: %v", t.file.Name, err)
+	}
+	fi, err := os.Stat(t.path)
+	if !t.started || err != nil || fi.Size() == 0 {
+		os.Remove(t.path)
+		return
+	}
+	t.file.Size = fi.Size()
+	t.file.Duration = float64(t.last-t.first) / float64(t.clockRate)
+	rec.finished = append(rec.finished, t.file)
+}
+
+// Stop finishes every open file and returns all files the recording
+// produced.
+func (rec *Recording) Stop() []RecordingFile {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.stopped = true
+	for remote, t := range rec.tracks {
+		delete(rec.tracks, remote)
+		rec.finish(t)
+	}
+	return rec.finished
+}
+
+// ── Room side ────────────────────────────────────────────────────────────────
+
+// setRecording attaches a recording to the room (nil detaches it) and
+// starts it on the tracks already published.
+func (r *Room) setRecording(rec *Recording) {
+	r.mu.Lock()
+	r.recording = rec
+	tracks := append([]publishedTrack(nil), r.tracks...)
+	r.mu.Unlock()
+
+	if rec != nil {
+		for _, pt := range tracks {
+			rec.addTrack(pt.publisherID, pt.remote)
+		}
+	}
+}
+
+// ── SFU side ─────────────────────────────────────────────────────────────────
+
+// StartRecording records a room until StopRecording. The room may be
+// empty, or not exist yet; whoever publishes in it is recorded.
+func (s *SFU) StartRecording(roomID, dir string) error {
+	s.mu.Lock()
+	if s.recordings[roomID] != nil {
+		s.mu.Unlock()
+		return errors.New("room is already being recorded")
+	}
+	rec, err := newRecording(dir)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.recordings[roomID] = rec
+	room := s.rooms[roomID]
+	s.mu.Unlock()
+
+	if room != nil {
+		room.setRecording(rec)
+	}
+	log.Printf("[sfu] recording room %s", roomID)
+	return nil
+}
+
+// StopRecording ends a room's recording and returns its files.
+func (s *SFU) StopRecording(roomID string) ([]RecordingFile, error) {
+	s.mu.Lock()
+	rec := s.recordings[roomID]
+	delete(s.recordings, roomID)
+	room := s.rooms[roomID]
+	s.mu.Unlock()
+	if rec == nil {
+		return nil, errors.New("room is not being recorded")
+	}
+
+	if room != nil {
+		room.setRecording(nil)
+	}
+	files := rec.Stop()
+	log.Printf("[sfu] stopped recording room %s (%d files)", roomID, len(files))
+	return files, nil
+}
@@ -11,6 +11,7 @@ import (
 // so we can clean up when that publisher leaves.
 type publishedTrack struct {
 	track       *webrtc.TrackLocalStaticRTP
+	remote      *webrtc.TrackRemote // what the publisher sends; codec and SSRC for bridges
 	publisherID string
 }
 
@@ -19,9 +20,12 @@ type Room struct {
 	id      string
 	onEmpty func() // called when the last peer leaves
 
-	mu     sync.RWMutex
-	peers  map[string]*Peer
-	tracks []publishedTrack
+	mu      sync.RWMutex
+	peers   map[string]*Peer
+	tracks  []publishedTrack
+	bridges []*Bridge // publishers forwarded to HLS (see bridge.go)
+
+	recording *Recording // nil unless the room is being recorded (see recorder.go)
 }
 
 func newRoom(id string, onEmpty func()) *Room {
@@ -50,9 +54,11 @@ func (r *Room) RemovePeer(p *Peer) {
 	// Collect and remove any tracks published by this peer.
 	remaining := r.tracks[:0]
 	var removedTracks []*webrtc.TrackLocalStaticRTP
+	var removedRemotes []*webrtc.TrackRemote
 	for _, pt := range r.tracks {
 		if pt.publisherID == p.id {
 			removedTracks = append(removedTracks, pt.track)
+			removedRemotes = append(removedRemotes, pt.remote)
 		} else {
 			remaining = append(remaining, pt)
 		}
@@ -65,8 +71,28 @@ func (r *Room) RemovePeer(p *Peer) {
 		subscribers = append(subscribers, sub)
 	}
 
+	var bridges []*Bridge
+	for _, b := range r.bridges {
+		if b.PublisherID == p.id {
+			bridges = append(bridges, b)
+		}
+	}
+
+	recording := r.recording
+
 	r.mu.Unlock()
 
+	// The publisher is gone, so are its bridges; the receivers notice
+	// through the SFU's bridge lookup.
+	for _, b := range bridges {
+		b.Close()
+	}
+	if recording != nil {
+		for _, remote := range removedRemotes {
+			recording.closeTrack(remote)
+		}
+	}
+
 	// Remove departed tracks from each subscriber's PeerConnection and
 	// trigger renegotiation so the client drops the dead streams.
 	for _, sub := range subscribers {
@@ -87,9 +113,9 @@ func (r *Room) RemovePeer(p *Peer) {
 
 // PublishTrack registers a new forwarding track and subscribes all current
 // peers (except the publisher) to it.
-func (r *Room) PublishTrack(track *webrtc.TrackLocalStaticRTP, publisherID string) {
+func (r *Room) PublishTrack(track *webrtc.TrackLocalStaticRTP, remote *webrtc.TrackRemote, publisherID string) {
 	r.mu.Lock()
-	r.tracks = append(r.tracks, publishedTrack{track: track, publisherID: publisherID})
+	r.tracks = append(r.tracks, publishedTrack{track: track, remote: remote, publisherID: publisherID})
 
 	subscribers := make([]*Peer, 0, len(r.peers))
 	for id, p := range r.peers {
@@ -97,8 +123,13 @@ func (r *Room) PublishTrack(track *webrtc.TrackLocalStaticRTP, publisherID strin
 			subscribers = append(subscribers, p)
 		}
 	}
+	recording := r.recording
 	r.mu.Unlock()
 
+	if recording != nil {
+		recording.addTrack(publisherID, remote)
+	}
+
 	log.Printf("[room %s] track published by %s → %d subscribers", r.id, publisherID, len(subscribers))
 
 	for _, sub := range subscribers {
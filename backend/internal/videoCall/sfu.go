@@ -8,13 +8,18 @@ import (
 // SFU is the top-level Selective Forwarding Unit.
 // It owns the room registry and is the single entry point for the HTTP layer.
 type SFU struct {
-	mu    sync.RWMutex
-	rooms map[string]*Room
+	mu      sync.RWMutex
+	rooms   map[string]*Room
+	bridges map[string]*Bridge // bridge ID → bridge
+
+	recordings map[string]*Recording // room ID → recording, kept across the room emptying
 }
 
 func NewSFU() *SFU {
 	return &SFU{
-		rooms: make(map[string]*Room),
+		rooms:      make(map[string]*Room),
+		bridges:    make(map[string]*Bridge),
+		recordings: make(map[string]*Recording),
 	}
 }
 
@@ -35,6 +40,7 @@ func (s *SFU) GetOrCreateRoom(id string) *Room {
 		log.Printf("[sfu] room %s removed (empty)", id)
 	})
 
+	r.recording = s.recordings[id] // a recorded room that emptied and refilled
 	s.rooms[id] = r
 	log.Printf("[sfu] room %s created", id)
 	return r
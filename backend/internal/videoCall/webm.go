@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3/pkg/media/samplebuilder"
+)
+
+// Matroska element IDs used by webmWriter.
+const (
+	ebmlHeaderID       = 0x1A45DFA3
+	ebmlVersionID      = 0x4286
+	ebmlReadVersionID  = 0x42F7
+	ebmlMaxIDLengthID  = 0x42F2
+	ebmlMaxSizeLenID   = 0x42F3
+	ebmlDocTypeID      = 0x4282
+	ebmlDocTypeVerID   = 0x4287
+	ebmlDocTypeReadID  = 0x4285
+	mkvSegmentID       = 0x18538067
+	mkvInfoID          = 0x1549A966
+	mkvTimecodeScaleID = 0x2AD7B1
+	mkvMuxingAppID     = 0x4D80
+	mkvWritingAppID    = 0x5741
+	mkvTracksID        = 0x1654AE6B
+	mkvTrackEntryID    = 0xAE
+	mkvTrackNumberID   = 0xD7
+	mkvTrackUIDID      = 0x73C5
+	mkvTrackTypeID     = 0x83
+	mkvCodecID         = 0x86
+	mkvVideoID         = 0xE0
+	mkvPixelWidthID    = 0xB0
+	mkvPixelHeightID   = 0xBA
+	mkvClusterID       = 0x1F43B675
+	mkvTimecodeID      = 0xE7
+	mkvSimpleBlockID   = 0xA3
+)
+
+// maxClusterMillis keeps block timecodes, which are relative to their
+// cluster and 16 bits wide, in range.
+const maxClusterMillis = 30000
+
+// webmWriter writes a VP8 track to a WebM file. RTP packets are put back
+// together into frames; nothing is written until the first keyframe,
+// which also gives the picture size for the header. The file is a live
+// WebM (unknown segment size, no cues): players show it from the start
+// and seek by scanning.
+type webmWriter struct {
+	f       *os.File
+	builder *samplebuilder.SampleBuilder
+
+	headerWritten bool
+	firstTS       uint32 // RTP timestamp of the first frame written
+	clockRate     uint32
+
+	cluster     bytes.Buffer // blocks of the open cluster
+	clusterTime int64        // ms; start of the open cluster
+}
+
+func newWebMWriter(path string, clockRate uint32) (*webmWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &webmWriter{
+		f:         f,
+		builder:   samplebuilder.New(128, &codecs.VP8Packet{}, clockRate),
+		clockRate: clockRate,
+	}, nil
+}
+
+// WriteRTP adds a packet; the packet must not be reused by the caller.
+func (w *webmWriter) WriteRTP(pkt *rtp.Packet) error {
+	w.builder.Push(pkt)
+	for sample := w.builder.Pop(); sample != nil; sample = w.builder.Pop() {
+		if err := w.writeFrame(sample.Data, sample.PacketTimestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *webmWriter) writeFrame(frame []byte, ts uint32) error {
+	// VP8 frame tag: bit 0 clear on keyframes, which carry the size at 6..9
+	keyframe := len(frame) >= 10 && frame[0]&0x01 == 0
+	if !w.headerWritten {
+		if !keyframe {
+			return nil // undecodable without the keyframe before it
+		}
+		width := int(binary.LittleEndian.Uint16(frame[6:8]) & 0x3FFF)
+		height := int(binary.LittleEndian.Uint16(frame[8:10]) & 0x3FFF)
+		if err := w.writeHeader(width, height); err != nil {
+			return err
+		}
+		w.firstTS = ts
+		w.headerWritten = true
+	}
+
+	millis := int64(ts-w.firstTS) * 1000 / int64(w.clockRate) // uint32 math handles wraparound
+	if w.cluster.Len() == 0 || keyframe || millis-w.clusterTime > maxClusterMillis {
+		if err := w.flushCluster(); err != nil {
+			return err
+		}
+		w.clusterTime = millis
+	}
+
+	flags := byte(0)
+	if keyframe {
+		flags = 0x80
+	}
+	block := make([]byte, 0, 4+len(frame))
+	block = append(block, 0x81) // track number 1 as a vint
+	block = binary.BigEndian.AppendUint16(block, uint16(int16(millis-w.clusterTime)))
+	block = append(block, flags)
+	block = append(block, frame...)
+	w.cluster.Write(ebmlElement(mkvSimpleBlockID, block))
+	return nil
+}
+
+func (w *webmWriter) writeHeader(width, height int) error {
+	var header bytes.Buffer
+	header.Write(ebmlElement(ebmlHeaderID, concat(
+		ebmlUint(ebmlVersionID, 1),
+		ebmlUint(ebmlReadVersionID, 1),
+		ebmlUint(ebmlMaxIDLengthID, 4),
+		ebmlUint(ebmlMaxSizeLenID, 8),
+		ebmlElement(ebmlDocTypeID, []byte("webm")),
+		ebmlUint(ebmlDocTypeVerID, 2),
+		ebmlUint(ebmlDocTypeReadID, 2),
+	)))
+	header.Write(ebmlID(mkvSegmentID))
+	header.Write([]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) // unknown size
+	header.Write(ebmlElement(mkvInfoID, concat(
+		ebmlUint(mkvTimecodeScaleID, 1000000), // timecodes in ms
+		ebmlElement(mkvMuxingAppID, []byte("0Xnet")),
+		ebmlElement(mkvWritingAppID, []byte("0Xnet")),
+	)))
+	header.Write(ebmlElement(mkvTracksID, ebmlElement(mkvTrackEntryID, concat(
+		ebmlUint(mkvTrackNumberID, 1),
+		ebmlUint(mkvTrackUIDID, 1),
+		ebmlUint(mkvTrackTypeID, 1), // video
+		ebmlElement(mkvCodecID, []byte("V_VP8")),
+		ebmlElement(mkvVideoID, concat(
+			ebmlUint(mkvPixelWidthID, uint64(width)),
+			ebmlUint(mkvPixelHeightID, uint64(height)),
+		)),
+	))))
+	_, err := w.f.Write(header.Bytes())
+	return err
+}
+
+// flushCluster writes the open cluster, if it has any blocks.
+func (w *webmWriter) flushCluster() error {
+	if w.cluster.Len() == 0 {
+		return nil
+	}
+	body := append(ebmlUint(mkvTimecodeID, uint64(w.clusterTime)), w.cluster.Bytes()...)
+	w.cluster.Reset()
+	_, err := w.f.Write(ebmlElement(mkvClusterID, body))
+	return err
+}
+
+// Close writes what is buffered and closes the file.
+func (w *webmWriter) Close() error {
+	err := w.flushCluster()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ── EBML encoding ────────────────────────────────────────────────────────────
+
+// ebmlID encodes an element ID; IDs carry their own length marker.
+func ebmlID(id uint32) []byte {
+	b := binary.BigEndian.AppendUint32(nil, id)
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// ebmlSize encodes a data size as the shortest vint that holds it.
+func ebmlSize(n int) []byte {
+	for length := 1; length <= 8; length++ {
+		if uint64(n) < 1<<(7*length)-1 {
+			b := make([]byte, length)
+			v := uint64(n) | 1<<(7*length)
+			for i := length - 1; i >= 0; i-- {
+				b[i] = byte(v)
+				v >>= 8
+			}
+			return b
+		}
+	}
+	panic(fmt.Sprintf("EBML size %d too large", n))
+}
+
+func ebmlElement(id uint32, data []byte) []byte {
+	return concat(ebmlID(id), ebmlSize(len(data)), data)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return ebmlElement(id, b)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
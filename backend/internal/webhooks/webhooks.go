@@ -0,0 +1,129 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+)
+
+const (
+	deliveryTimeout = 5 * time.Second
+	maxAttempts     = 3
+	queueSize       = 128 // per endpoint; events beyond this are dropped
+)
+
+// Dispatcher POSTs every bus event as JSON to a set of webhook URLs.
+// Each endpoint has its own delivery queue so a slow or dead receiver
+// doesn't hold up the others.
+type Dispatcher struct {
+	urls   []string
+	secret string
+	client *http.Client
+}
+
+// NewDispatcher creates a dispatcher for the given endpoints. If secret is
+// set, each request carries an X-0Xnet-Signature HMAC-SHA256 of the body.
+func NewDispatcher(urls []string, secret string) *Dispatcher {
+	return &Dispatcher{
+		urls:   urls,
+		secret: secret,
+		client: &http.Client{Timeout: deliveryTimeout},
+	}
+}
+
+// Run subscribes to the bus and delivers events until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, bus *events.Bus) {
+	queues := make([]chan events.Event, len(d.urls))
+	for i, url := range d.urls {
+		queues[i] = make(chan events.Event, queueSize)
+		go d.deliverLoop(ctx, url, queues[i])
+		log.Printf("🪝 [Webhooks] Delivering events to %s", url)
+	}
+
+	bus.Listen(ctx, func(ev events.Event) {
+		for i, q := range queues {
+			select {
+			case q <- ev:
+			default:
+				log.Printf("⚠️ [Webhooks] Queue full for %s, dropping %s", d.urls[i], ev.Type)
+			}
+		}
+	})
+}
+
+func (d *Dispatcher) deliverLoop(ctx context.Context, url string, queue <-chan events.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-queue:
+			d.deliver(ctx, url, ev)
+		}
+	}
+}
+
+// deliver POSTs one event, retrying with backoff on network errors and 5xx.
+func (d *Dispatcher) deliver(ctx context.Context, url string, ev events.Event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("⚠️ [Webhooks] Failed to encode %s: %v", ev.Type, err)
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := d.post(ctx, url, ev, body)
+		if err == nil {
+			return
+		}
+		if attempt == maxAttempts {
+			log.Printf("⚠️ [Webhooks] Giving up on %s → %s: %v", ev.Type, url, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, url string, ev events.Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-0Xnet-Event", string(ev.Type))
+	if d.secret != "" {
+		mac := hmac.New(sha256.New, []byte(d.secret))
+		mac.Write(body)
+		req.Header.Set("X-0Xnet-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		// The receiver rejected it; retrying won't help
+		log.Printf("⚠️ [Webhooks] %s rejected %s with status %d", url, ev.Type, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// Ephemeral signals are never persisted: they live in the hub, expire on
+// their own and are cleared as soon as the client disconnects.
+const (
+	typingTTL      = 5 * time.Second  // "is typing" clears after this much silence
+	raisedHandTTL  = 30 * time.Minute // forgotten hands eventually come down
+	maxReactionLen = 16               // bytes — enough for any emoji sequence
+)
+
+// signalLimit is a token-bucket rate (per second) and burst for one message type.
+type signalLimit struct {
+	rate  float64
+	burst float64
+}
+
+// signalLimits caps how often a single client may send each ephemeral signal.
+var signalLimits = map[string]signalLimit{
+	"typing":     {rate: 1, burst: 3},
+	"raise-hand": {rate: 0.5, burst: 2},
+	"lower-hand": {rate: 0.5, burst: 2},
+	"reaction":   {rate: 2, burst: 5},
+}
+
+// RaisedHand is one entry in the session's ordered hand-raise list.
+type RaisedHand struct {
+	DeviceID string    `json:"deviceId"`
+	RaisedAt time.Time `json:"raisedAt"`
+}
+
+// ephemeralState holds the typing and hand-raise state of a SessionHub.
+type ephemeralState struct {
+	mu         sync.Mutex
+	typing     map[string]*time.Timer // deviceID → expiry timer
+	hands      []RaisedHand           // in raise order
+	handTimers map[string]*time.Timer // deviceID → expiry timer
+}
+
+func newEphemeralState() *ephemeralState {
+	return &ephemeralState{
+		typing:     make(map[string]*time.Timer),
+		handTimers: make(map[string]*time.Timer),
+	}
+}
+
+// SetTyping updates the typing state of a device and tells the other clients.
+// A typing device that goes quiet is cleared automatically after typingTTL.
+func (h *SessionHub) SetTyping(deviceID string, typing bool) {
+	st := h.signals
+	st.mu.Lock()
+	timer, wasTyping := st.typing[deviceID]
+	if typing {
+		if wasTyping {
+			timer.Reset(typingTTL)
+		} else {
+			st.typing[deviceID] = time.AfterFunc(typingTTL, func() {
+				h.SetTyping(deviceID, false)
+			})
+		}
+	} else if wasTyping {
+		timer.Stop()
+		delete(st.typing, deviceID)
+	}
+	st.mu.Unlock()
+
+	// Only announce actual state changes
+	if typing == wasTyping {
+		return
+	}
+	h.BroadcastExcludingDevice(map[string]interface{}{
+		"type":     "typing",
+		"sender":   deviceID,
+		"isTyping": typing,
+	}, deviceID)
+}
+
+// RaiseHand appends a device to the hand-raise list (no-op if already raised).
+func (h *SessionHub) RaiseHand(deviceID string) {
+	st := h.signals
+	st.mu.Lock()
+	if _, raised := st.handTimers[deviceID]; raised {
+		st.mu.Unlock()
+		return
+	}
+	st.hands = append(st.hands, RaisedHand{DeviceID: deviceID, RaisedAt: time.Now()})
+	st.handTimers[deviceID] = time.AfterFunc(raisedHandTTL, func() {
+		h.LowerHand(deviceID)
+	})
+	st.mu.Unlock()
+
+	h.broadcastHands()
+}
+
+// LowerHand removes a device from the hand-raise list.
+// Returns false if the device's hand wasn't raised.
+func (h *SessionHub) LowerHand(deviceID string) bool {
+	st := h.signals
+	st.mu.Lock()
+	timer, raised := st.handTimers[deviceID]
+	if !raised {
+		st.mu.Unlock()
+		return false
+	}
+	timer.Stop()
+	delete(st.handTimers, deviceID)
+	for i, hand := range st.hands {
+		if hand.DeviceID == deviceID {
+			st.hands = append(st.hands[:i], st.hands[i+1:]...)
+			break
+		}
+	}
+	st.mu.Unlock()
+
+	h.broadcastHands()
+	return true
+}
+
+// RaisedHands returns the current hand-raise list, oldest first.
+func (h *SessionHub) RaisedHands() []RaisedHand {
+	st := h.signals
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]RaisedHand{}, st.hands...)
+}
+
+// clearSignals drops every ephemeral state held for a device once it has
+// no connection left in the hub.
+func (h *SessionHub) clearSignals(deviceID string) {
+	if h.HasDevice(deviceID) {
+		return
+	}
+	h.SetTyping(deviceID, false)
+	h.LowerHand(deviceID)
+}
+
+func (h *SessionHub) broadcastHands() {
+	h.Broadcast(map[string]interface{}{
+		"type":  "hands-updated",
+		"hands": h.RaisedHands(),
+	})
+}
+
+// rateLimiter is a per-client set of token buckets keyed by message type.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow reports whether a message of the given type may be sent now.
+// Types without a configured limit are always allowed.
+func (l *rateLimiter) Allow(msgType string) bool {
+	limit, ok := signalLimits[msgType]
+	if !ok {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[msgType]
+	if !ok {
+		b = &tokenBucket{tokens: limit.burst, last: now}
+		l.buckets[msgType] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * limit.rate
+	if b.tokens > limit.burst {
+		b.tokens = limit.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bhawani-prajapat2006/0Xnet/backend/internal/events"
+)
+
+// ForwardEvents subscribes the hubs to the event bus and relays the
+// session-scoped domain events to connected clients as WebSocket messages.
+func (m *SessionManager) ForwardEvents(ctx context.Context, bus *events.Bus) {
+	// Listen drops nothing, and forwardEvent only queues messages on the
+	// clients, so a slow client can't back this up.
+	bus.Listen(ctx, m.forwardEvent)
+}
+
+func (m *SessionManager) forwardEvent(ev events.Event) {
+	if ev.SessionID == "" {
+		return
+	}
+	hub := m.existingHub(ev.SessionID)
+	if hub == nil {
+		return
+	}
+
+	switch p := ev.Data.(type) {
+	case events.StreamStarted:
+		msg := map[string]string{
+			"type":        "stream-started",
+			"playlistUrl": p.PlaylistURL,
+		}
+		if p.DASHURL != "" {
+			msg["dashUrl"] = p.DASHURL
+		}
+		hub.Broadcast(msg)
+
+	case events.StreamStopped:
+		hub.Broadcast(map[string]string{
+			"type": "stream-stopped",
+		})
+
+	case events.StreamProgress:
+		hub.Broadcast(map[string]interface{}{
+			"type":   "stream-progress",
+			"status": p.Status,
+		})
+
+	case events.StreamQueued:
+		hub.Broadcast(map[string]interface{}{
+			"type":     "stream-queued",
+			"position": p.Position,
+			"running":  p.Running,
+		})
+
+	case events.StreamFailed:
+		hub.Broadcast(map[string]interface{}{
+			"type":   "stream-failed",
+			"error":  p.Error,
+			"status": p.Status,
+		})
+
+	case events.StreamTracks:
+		hub.Broadcast(map[string]interface{}{
+			"type":   "stream-tracks",
+			"tracks": p.Tracks,
+		})
+
+	case events.HostLeft:
+		hub.Broadcast(map[string]interface{}{
+			"type":      "host-left",
+			"countdown": p.Countdown,
+			"message":   fmt.Sprintf("Host has left. Session ending in %d seconds…", p.Countdown),
+		})
+
+	case events.SessionEnded:
+		hub.Broadcast(map[string]interface{}{
+			"type":    "session-ended",
+			"message": "Session has been closed by the host.",
+		})
+
+	case events.QueueUpdated:
+		hub.Broadcast(map[string]interface{}{
+			"type":  "queue-updated",
+			"items": p.Items,
+		})
+
+	case events.PollUpdated:
+		hub.Broadcast(map[string]interface{}{
+			"type": "poll-updated",
+			"poll": p.Poll,
+		})
+
+	case events.PollClosed:
+		hub.Broadcast(map[string]interface{}{
+			"type":   "poll-closed",
+			"poll":   p.Poll,
+			"winner": p.Winner,
+		})
+
+	case events.RecordingStarted:
+		hub.Broadcast(map[string]interface{}{
+			"type":      "recording-started",
+			"startedBy": p.StartedBy,
+			"call":      p.Call,
+		})
+
+	case events.RecordingStopped:
+		hub.Broadcast(map[string]interface{}{
+			"type": "recording-stopped",
+		})
+
+	case events.RecordingSaved:
+		hub.Broadcast(map[string]interface{}{
+			"type":      "recording-saved",
+			"recording": p.Recording,
+		})
+	}
+}
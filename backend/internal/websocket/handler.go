@@ -1,23 +1,104 @@
 package websocket
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// sendQueueSize is how many messages may wait for a client before
+	// it counts as stuck and is dropped.
+	sendQueueSize = 256
+	// writeWait bounds a single write to a client's connection.
+	writeWait = 10 * time.Second
+)
+
+var (
+	errClientGone = errors.New("client disconnected")
+	errClientSlow = errors.New("client is not keeping up")
+)
+
 type Client struct {
 	DeviceID string // Can be username or peer ID
 	Conn     *websocket.Conn
 	Session  string
+
+	send      chan interface{} // messages waiting for writePump
+	done      chan struct{}    // closed once the connection is going away
+	closeOnce sync.Once
+	limiter   *rateLimiter // per-type limits for ephemeral signals
+}
+
+func newClient(conn *websocket.Conn, deviceID, sessionID string) *Client {
+	return &Client{
+		DeviceID: deviceID,
+		Conn:     conn,
+		Session:  sessionID,
+		send:     make(chan interface{}, sendQueueSize),
+		done:     make(chan struct{}),
+		limiter:  newRateLimiter(),
+	}
+}
+
+// WriteJSON queues a message for the client without waiting on the
+// network, so one slow client never holds up a broadcast. A client whose
+// queue is full is disconnected. Safe for concurrent use.
+func (c *Client) WriteJSON(msg interface{}) error {
+	select {
+	case <-c.done:
+		return errClientGone
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return nil
+	default:
+		log.Printf("WS Client Too Slow, disconnecting: %s in Session %s", c.DeviceID, c.Session)
+		c.close()
+		return errClientSlow
+	}
+}
+
+// close drops the connection, which also ends the read loop in ServeWS.
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
+}
+
+// writePump is the connection's only writer: gorilla connections allow
+// one at a time. Each write gets writeWait to go through.
+func (c *Client) writePump() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteJSON(msg); err != nil {
+				log.Printf("WS Write Error to %s: %v", c.DeviceID, err)
+				c.close()
+				return
+			}
+		}
+	}
 }
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-func ServeWS(w http.ResponseWriter, r *http.Request, onJoin func(*Client)) {
+// ServeWS upgrades the connection and runs the session message loop.
+// onJoin runs once the client has joined its session hub; onMessage gets
+// every message type the hub doesn't handle itself and returns false if
+// it didn't recognise it either.
+func (m *SessionManager) ServeWS(w http.ResponseWriter, r *http.Request, onJoin func(*Client), onMessage func(*Client, map[string]interface{}) bool) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WS Upgrade Error: %v", err)
@@ -43,14 +124,13 @@ func ServeWS(w http.ResponseWriter, r *http.Request, onJoin func(*Client)) {
 		username = "Anonymous"
 	}
 
-	client := &Client{
-		DeviceID: username,
-		Conn:     conn,
-		Session:  sessionID,
-	}
+	client := newClient(conn, username, sessionID)
+	go client.writePump()
+	defer client.close()
 
-	hub := GlobalManager.GetHub(sessionID)
+	hub := m.GetHub(sessionID)
 	hub.Register(client)
+	defer hub.clearSignals(username)
 	defer hub.Unregister(client)
 
 	log.Printf("WS Client Connected: %s to Session %s", username, sessionID)
@@ -61,6 +141,14 @@ func ServeWS(w http.ResponseWriter, r *http.Request, onJoin func(*Client)) {
 		"message": username + " joined the session",
 	})
 
+	// Late joiners need the current hand-raise queue
+	if hands := hub.RaisedHands(); len(hands) > 0 {
+		client.WriteJSON(map[string]interface{}{
+			"type":  "hands-updated",
+			"hands": hands,
+		})
+	}
+
 	if onJoin != nil {
 		onJoin(client)
 	}
@@ -76,8 +164,14 @@ func ServeWS(w http.ResponseWriter, r *http.Request, onJoin func(*Client)) {
 
 		msgType, _ := incoming["type"].(string)
 
+		if !client.limiter.Allow(msgType) {
+			continue // drop ephemeral signals that exceed the rate limit
+		}
+
 		switch msgType {
 		case "chat":
+			// Sending a message ends the "is typing" state
+			hub.SetTyping(username, false)
 			hub.Broadcast(map[string]interface{}{
 				"type":      "chat",
 				"sender":    username,
@@ -90,6 +184,35 @@ func ServeWS(w http.ResponseWriter, r *http.Request, onJoin func(*Client)) {
 			incoming["sender"] = username
 			hub.Broadcast(incoming)
 
+		case "typing":
+			isTyping, _ := incoming["isTyping"].(bool)
+			hub.SetTyping(username, isTyping)
+
+		case "raise-hand":
+			hub.RaiseHand(username)
+
+		case "lower-hand":
+			// Lowering someone else's hand is a host action, decided upstream
+			target, _ := incoming["targetDeviceId"].(string)
+			if target != "" && target != username {
+				if onMessage == nil || !onMessage(client, incoming) {
+					log.Printf("WS lower-hand for %s ignored (sender=%s)", target, username)
+				}
+				continue
+			}
+			hub.LowerHand(username)
+
+		case "reaction":
+			emoji, _ := incoming["emoji"].(string)
+			if emoji == "" || len(emoji) > maxReactionLen {
+				continue
+			}
+			hub.Broadcast(map[string]interface{}{
+				"type":   "reaction",
+				"sender": username,
+				"emoji":  emoji,
+			})
+
 		case "offer", "answer", "ice-candidate", "renegotiate":
 			// WebRTC Signaling: Relay only to the intended peer.
 			targetPeerID, _ := incoming["targetPeerId"].(string)
@@ -104,6 +227,9 @@ func ServeWS(w http.ResponseWriter, r *http.Request, onJoin func(*Client)) {
 			}
 
 		default:
+			if onMessage != nil && onMessage(client, incoming) {
+				continue
+			}
 			log.Printf("WS Unknown Message Type: %s", msgType)
 		}
 	}
@@ -8,12 +8,14 @@ type SessionHub struct {
 	SessionID string
 	Clients   map[*Client]bool
 	mutex     sync.RWMutex
+	signals   *ephemeralState
 }
 
 func NewSessionHub(id string) *SessionHub {
 	return &SessionHub{
 		SessionID: id,
 		Clients:   make(map[*Client]bool),
+		signals:   newEphemeralState(),
 	}
 }
 
@@ -33,7 +35,7 @@ func (h *SessionHub) Broadcast(msg interface{}) {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 	for client := range h.Clients {
-		client.Conn.WriteJSON(msg)
+		client.WriteJSON(msg)
 	}
 }
 
@@ -44,17 +46,40 @@ func (h *SessionHub) BroadcastExcluding(msg interface{}, exclude *Client) {
 		if client == exclude {
 			continue
 		}
-		client.Conn.WriteJSON(msg)
+		client.WriteJSON(msg)
 	}
 }
 
+func (h *SessionHub) BroadcastExcludingDevice(msg interface{}, deviceID string) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.Clients {
+		if client.DeviceID == deviceID {
+			continue
+		}
+		client.WriteJSON(msg)
+	}
+}
+
+// HasDevice returns true if the device still has a connection in the hub.
+func (h *SessionHub) HasDevice(deviceID string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.Clients {
+		if client.DeviceID == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *SessionHub) SendToDevice(deviceID string, msg interface{}) bool {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
 	for client := range h.Clients {
 		if client.DeviceID == deviceID {
-			client.Conn.WriteJSON(msg)
+			client.WriteJSON(msg)
 			return true
 		}
 	}
@@ -84,4 +109,10 @@ func (m *SessionManager) GetHub(sessionID string) *SessionHub {
 	return hub
 }
 
-var GlobalManager = NewSessionManager()
+// existingHub returns the hub for a session, or nil if nobody ever
+// connected to it (so events don't create empty hubs).
+func (m *SessionManager) existingHub(sessionID string) *SessionHub {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.Hubs[sessionID]
+}
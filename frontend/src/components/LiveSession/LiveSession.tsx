@@ -442,6 +442,7 @@ const LiveSession: React.FC<LiveSessionProps> = ({ myDeviceId, sessionData, onLe
     try {
       const formData = new FormData()
       formData.append('sessionId', sessionData.id)
+      formData.append('deviceId', myDeviceId)
       formData.append('file', file)
 
       const resp = await fetch(`${backendBase}/stream/upload`, {
@@ -467,7 +468,7 @@ const LiveSession: React.FC<LiveSessionProps> = ({ myDeviceId, sessionData, onLe
       await fetch(`${backendBase}/stream/stop`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ sessionId: sessionData.id }),
+        body: JSON.stringify({ sessionId: sessionData.id, deviceId: myDeviceId }),
       })
       // Revoke blob URL if the host was playing locally
       if (hlsPlaylistUrl && hlsPlaylistUrl.startsWith('blob:')) {
@@ -180,10 +180,17 @@ const VideoPlayer: React.FC<VideoPlayerProps> = ({
     const onPlay = () => broadcastSync('play', video.currentTime)
     const onPause = () => broadcastSync('pause', video.currentTime)
     const onSeeked = () => broadcastSync('seek', video.currentTime)
+    // Lets the server auto-advance the media queue
+    const onEnded = () => {
+      if (ws.current?.readyState === WebSocket.OPEN) {
+        ws.current.send(JSON.stringify({ type: 'playback-ended' }))
+      }
+    }
 
     video.addEventListener('play', onPlay)
     video.addEventListener('pause', onPause)
     video.addEventListener('seeked', onSeeked)
+    video.addEventListener('ended', onEnded)
 
     // Periodic heartbeat sync so late-joiners and drifted guests stay aligned
     const heartbeat = setInterval(() => {
@@ -200,9 +207,10 @@ const VideoPlayer: React.FC<VideoPlayerProps> = ({
       video.removeEventListener('play', onPlay)
       video.removeEventListener('pause', onPause)
       video.removeEventListener('seeked', onSeeked)
+      video.removeEventListener('ended', onEnded)
       clearInterval(heartbeat)
     }
-  }, [isHost, broadcastSync])
+  }, [isHost, broadcastSync, ws])
 
   // ── Guest: listen for sync-playback + stream-stopped WS messages ──
   useEffect(() => {